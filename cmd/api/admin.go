@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/validator"
+)
+
+// recordAudit writes an entry to the audit trail for the admin making the request.
+// Failures are logged rather than returned so the admin action itself is not undone.
+func (app *application) recordAudit(r *http.Request, action string, targetUserID int64, details map[string]interface{}) {
+	admin := app.ContextGetUser(r)
+
+	entry := &data.AuditEntry{
+		ActorID:      admin.ID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Details:      details,
+	}
+
+	err := app.modelsFor(r).Audit.Insert(entry)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// fetchUserFromParam looks up the user identified by the id url parameter and
+// writes the error response itself when the user can't be loaded.
+func (app *application) fetchUserFromParam(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	user, err := app.modelsFor(r).User.GetUserByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no user found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// saveUser bumps the version of the user and persists it, writing the error response on failure.
+func (app *application) saveUser(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	user.UpdatedAt = time.Now()
+	user.Version = user.Version + 1
+
+	err := app.modelsFor(r).User.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorDuplicateEmail):
+			app.JSONError(w, errors.New("user with email already exist"), http.StatusConflict)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no user found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	return true
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user fetch success",
+		Data:    user,
+	})
+}
+
+func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		FirstName *string `json:"firstname"`
+		LastName  *string `json:"lastname"`
+		Username  *string `json:"username"`
+		Email     *string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	changes := map[string]interface{}{}
+
+	if input.FirstName != nil {
+		user.FirstName = *input.FirstName
+		changes["firstname"] = *input.FirstName
+	}
+	if input.LastName != nil {
+		user.LastName = *input.LastName
+		changes["lastname"] = *input.LastName
+	}
+	if input.Username != nil {
+		user.Username = *input.Username
+		changes["username"] = *input.Username
+	}
+	if input.Email != nil {
+		user.Email = *input.Email
+		changes["email"] = *input.Email
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.saveUser(w, r, user) {
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserUpdated, user.ID, changes)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user update success",
+		Data:    user,
+	})
+}
+
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.modelsFor(r).User.DeleteUser(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no user found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserDeleted, user.ID, map[string]interface{}{
+		"email": user.Email,
+	})
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user delete success",
+	})
+}
+
+func (app *application) adminActivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	user.Active = true
+
+	if !app.saveUser(w, r, user) {
+		return
+	}
+
+	err := app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserActivated, user.ID, nil)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user activation success",
+		Data:    user,
+	})
+}
+
+func (app *application) adminDeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	user.Active = false
+
+	if !app.saveUser(w, r, user) {
+		return
+	}
+
+	// A deactivated account must not keep working through tokens issued before.
+	err := app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserDeactivated, user.ID, nil)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user deactivation success",
+		Data:    user,
+	})
+}
+
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Replace the current password with a random one nobody knows, so the
+	// account can only be used again after going through the reset link.
+	err := user.Password.SetPlaceholder()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !app.saveUser(w, r, user) {
+		return
+	}
+
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.sendPasswordResetEmail(r, user, "password_reset.html")
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserPasswordReset, user.ID, nil)
+
+	app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Success: true,
+		Message: "password reset email sent",
+	})
+}
+
+func (app *application) revokeUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserTokensRevoked, user.ID, nil)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user tokens revoked",
+	})
+}
+
+func (app *application) listUserAuditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	entries, err := app.modelsFor(r).Audit.GetForUser(id)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "audit trail fetch success",
+		Data:    entries,
+	})
+}
+
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	term := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", 20, v)
+
+	v.Check(term != "", "q", "must be provided")
+	v.Check(len(term) <= 200, "q", "must not be more than 200 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maximum of 100")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, err := app.modelsFor(r).User.SearchUsers(term, limit)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "users search success",
+		Data:    results,
+	})
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/authz"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/validator"
+)
+
+// authzTimeout bounds a single check or expand, including every tuple read it makes.
+const authzTimeout = 5 * time.Second
+
+// maxTupleWrites bounds how many tuples a single write request may add and delete.
+const maxTupleWrites = 100
+
+/*
+authzSnapshot opens a snapshot of the tuples of the request's organization that is at least as
+fresh as the consistency token, if one was given. It writes the error response itself on failure.
+*/
+func (app *application) authzSnapshot(ctx context.Context, w http.ResponseWriter, r *http.Request, token string) (*data.RelationSnapshot, bool) {
+	var revision int64
+
+	if token != "" {
+		var err error
+
+		revision, err = authz.DecodeToken(token)
+		if err != nil {
+			app.failedValidationResponse(w, r, map[string]string{"consistency_token": "is invalid"})
+			return nil, false
+		}
+	}
+
+	snapshot, err := app.modelsFor(r).Relations.Snapshot(ctx, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorStaleSnapshot):
+			app.failedValidationResponse(w, r, map[string]string{"consistency_token": "is newer than any write"})
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return snapshot, true
+}
+
+// authzError writes the error response for a failed check or expand.
+func (app *application) authzError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, authz.ErrorUnknownNamespace), errors.Is(err, authz.ErrorUnknownRelation):
+		app.failedValidationResponse(w, r, map[string]string{"relation": err.Error()})
+	case errors.Is(err, authz.ErrorMaxDepth):
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "the relations are nested too deeply to evaluate")
+	default:
+		app.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+/*
+checkRelationHandler answers whether a subject has a relation to an object, e.g. whether
+user:10 is an editor of doc:readme. checked_at can be passed back as consistency_token.
+*/
+func (app *application) checkRelationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Object           string `json:"object"`
+		Relation         string `json:"relation"`
+		Subject          string `json:"subject"`
+		ConsistencyToken string `json:"consistency_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+
+	object, err := authz.ParseObject(input.Object)
+	v.Check(err == nil, "object", "must be written namespace:id")
+	v.Check(authz.NameRX.MatchString(input.Relation), "relation", "must be a valid relation name")
+	subject, err := authz.ParseSubject(input.Subject)
+	v.Check(err == nil, "subject", "must be written namespace:id or namespace:id#relation")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), authzTimeout)
+	defer cancel()
+
+	snapshot, ok := app.authzSnapshot(ctx, w, r, input.ConsistencyToken)
+	if !ok {
+		return
+	}
+	defer snapshot.Close()
+
+	checker := &authz.Checker{Namespaces: snapshot.Namespaces, Reader: snapshot}
+
+	allowed, err := checker.Check(ctx, object, input.Relation, subject)
+	if err != nil {
+		app.authzError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "check success",
+		Data:    envelope{"allowed": allowed, "checked_at": authz.EncodeToken(snapshot.Revision)},
+	})
+}
+
+/*
+expandRelationHandler returns the tree of usersets that make up the subjects of a relation.
+*/
+func (app *application) expandRelationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Object           string `json:"object"`
+		Relation         string `json:"relation"`
+		ConsistencyToken string `json:"consistency_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+
+	object, err := authz.ParseObject(input.Object)
+	v.Check(err == nil, "object", "must be written namespace:id")
+	v.Check(authz.NameRX.MatchString(input.Relation), "relation", "must be a valid relation name")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), authzTimeout)
+	defer cancel()
+
+	snapshot, ok := app.authzSnapshot(ctx, w, r, input.ConsistencyToken)
+	if !ok {
+		return
+	}
+	defer snapshot.Close()
+
+	checker := &authz.Checker{Namespaces: snapshot.Namespaces, Reader: snapshot}
+
+	tree, err := checker.Expand(ctx, object, input.Relation)
+	if err != nil {
+		app.authzError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "expand success",
+		Data:    envelope{"tree": tree, "expanded_at": authz.EncodeToken(snapshot.Revision)},
+	})
+}
+
+// parseTuples parses tuples for a write, checking that their relations are configured.
+func parseTuples(v *validator.Validator, key string, values []string, namespaces map[string]*authz.Namespace) []authz.Tuple {
+	tuples := make([]authz.Tuple, 0, len(values))
+
+	for _, value := range values {
+		t, err := authz.ParseTuple(value)
+		if err != nil {
+			v.AddError(key, err.Error())
+			continue
+		}
+
+		namespace, ok := namespaces[t.Object.Namespace]
+		if !ok {
+			v.AddError(key, "unknown namespace "+t.Object.Namespace)
+			continue
+		}
+
+		if _, ok := namespace.Relations[t.Relation]; !ok {
+			v.AddError(key, "unknown relation "+t.Relation+" in namespace "+t.Object.Namespace)
+			continue
+		}
+
+		tuples = append(tuples, t)
+	}
+
+	return tuples
+}
+
+/*
+writeRelationsHandler adds and deletes tuples in one transaction. The returned consistency
+token makes later checks see at least this write.
+*/
+func (app *application) writeRelationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Writes  []string `json:"writes"`
+		Deletes []string `json:"deletes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Writes)+len(input.Deletes) > 0, "writes", "at least one tuple must be written or deleted")
+	v.Check(len(input.Writes)+len(input.Deletes) <= maxTupleWrites, "writes", "must not contain more than 100 tuples along with deletes")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	namespaces, err := app.modelsFor(r).Relations.GetNamespaces()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writes := parseTuples(v, "writes", input.Writes, namespaces)
+	deletes := parseTuples(v, "deletes", input.Deletes, namespaces)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revision, err := app.modelsFor(r).Relations.Write(writes, deletes)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "relation tuples written",
+		Data:    envelope{"consistency_token": authz.EncodeToken(revision)},
+	})
+}
+
+func (app *application) listRelationsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filter := data.TupleFilter{
+		Namespace: app.readString(qs, "namespace", ""),
+		ObjectID:  app.readString(qs, "object_id", ""),
+		Relation:  app.readString(qs, "relation", ""),
+		Subject:   app.readString(qs, "subject", ""),
+	}
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "id",
+		SortSafelist: []string{"id"},
+	}
+
+	v.Check(authz.NameRX.MatchString(filter.Namespace), "namespace", "must be provided")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tuples, metadata, err := app.modelsFor(r).Relations.Read(filter, filters)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	values := make([]string, 0, len(tuples))
+	for _, t := range tuples {
+		values = append(values, t.String())
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success:  true,
+		Message:  "relation tuples fetch success",
+		Data:     values,
+		Metadata: metadata,
+	})
+}
+
+func (app *application) listNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := app.modelsFor(r).Relations.GetNamespaces()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "namespaces fetch success",
+		Data:    namespaces,
+	})
+}
+
+// putNamespaceHandler creates or replaces the configuration of the namespace named in the url.
+func (app *application) putNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	var namespace authz.Namespace
+
+	err := app.readJSON(w, r, &namespace)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	namespace.Name = httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	err = namespace.Validate()
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"relations": err.Error()})
+		return
+	}
+
+	err = app.modelsFor(r).Relations.PutNamespace(&namespace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorNamespaceInUse):
+			app.JSONError(w, errors.New("relations that still have tuples can't be removed"), http.StatusConflict)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "namespace saved",
+		Data:    namespace,
+	})
+}
+
+func (app *application) deleteNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	err := app.modelsFor(r).Relations.DeleteNamespace(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no namespace found with such name"), http.StatusNotFound)
+		case errors.Is(err, data.ErrorNamespaceInUse):
+			app.JSONError(w, errors.New("namespaces that still have tuples can't be deleted"), http.StatusConflict)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "namespace deleted",
+	})
+}
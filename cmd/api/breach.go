@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"rabitech.auth.app/internal/breach"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/passwordpolicy"
+)
+
+/*
+passwordBreached reports whether password appears in the corpus of breached passwords. Passwords
+are let through when the corpus can't be read, like requests when the rate limit store fails.
+*/
+func (app *application) passwordBreached(r *http.Request, password string) bool {
+	if app.breached == nil {
+		return false
+	}
+
+	breached, err := breach.Breached(app.breached, password)
+	if err != nil {
+		app.logError(r, err)
+		return false
+	}
+	return breached
+}
+
+// breachViolation is the violation of new passwords found in a data breach.
+var breachViolation = passwordpolicy.Violation{
+	Code:    passwordpolicy.CodeBreached,
+	Message: "has appeared in a data breach, choose another one",
+}
+
+func (app *application) passwordBreachedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this password has appeared in a data breach and must be changed, a password reset link was emailed"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+/*
+refuseBreachedLogin refuses logins of user with a password found in a data breach, when
+-breach-check-login is set. The user is marked and emailed a password reset link, unless they
+already hold an unexpired one. It writes the error response itself when it returns true.
+*/
+func (app *application) refuseBreachedLogin(w http.ResponseWriter, r *http.Request, user *data.User, password string) bool {
+	if !app.config.breach.checkLogin || !app.passwordBreached(r, password) {
+		return false
+	}
+
+	models := app.modelsFor(r)
+
+	err := models.User.FlagPasswordBreached(user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return true
+	}
+
+	app.logger.PrintInfo("login with breached password refused", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+	})
+
+	emailed, err := models.Tokens.HasActiveForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return true
+	}
+
+	if !emailed {
+		err = app.sendPasswordResetEmail(r, user, "password_breached.html")
+		if err != nil {
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return true
+		}
+	}
+
+	app.passwordBreachedResponse(w, r)
+	return true
+}
@@ -24,3 +24,24 @@ func (app *application) ContextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+const organizationContextKey = contextKey("organization")
+
+func (app *application) ContextSetOrganization(r *http.Request, organization *data.Organization) *http.Request {
+	ctx := context.WithValue(r.Context(), organizationContextKey, organization)
+
+	return r.WithContext(ctx)
+}
+
+func (app *application) ContextGetOrganization(r *http.Request) *data.Organization {
+	organization, ok := r.Context().Value(organizationContextKey).(*data.Organization)
+	if !ok {
+		panic("missing organization key value in context")
+	}
+	return organization
+}
+
+// modelsFor returns the models scoped to the organization the request was routed to.
+func (app *application) modelsFor(r *http.Request) data.Models {
+	return app.models.ForOrganization(app.ContextGetOrganization(r).ID)
+}
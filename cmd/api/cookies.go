@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+)
+
+// csrfHeader is the header browsers send the CSRF token of a cookie session in.
+const csrfHeader = "X-CSRF-Token"
+
+var errorInvalidCSRFToken = errors.New("invalid or missing CSRF token")
+
+func parseSameSite(mode string) (http.SameSite, error) {
+	switch mode {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite mode %q, must be lax, strict or none", mode)
+}
+
+/*
+csrfToken derives the CSRF token of a cookie session from its authentication token. Only the
+session's owner can compute it, since the session cookie is HttpOnly, and a cookie planted by a
+sibling subdomain can't match it.
+*/
+func csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCSRFToken reports whether the request carries the CSRF token of the session.
+func validCSRFToken(r *http.Request, sessionToken string) bool {
+	token := r.Header.Get(csrfHeader)
+	return token != "" && hmac.Equal([]byte(token), []byte(csrfToken(sessionToken)))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+/*
+needsCSRFToken reports whether a cookie-authenticated request must carry the CSRF token: every
+state-changing request but forward-auth, whose method is the one of the request it is asked about.
+Forward-auth changes nothing here and decides on the session alone; the proxied app, which the
+browser meant to call and which can't know the token, protects itself against CSRF.
+*/
+func needsCSRFToken(r *http.Request) bool {
+	return !isSafeMethod(r.Method) && r.URL.Path != forwardAuthPath
+}
+
+// csrfCookieName is the name of the cookie scripts read the CSRF token from.
+func (app *application) csrfCookieName() string {
+	return app.config.session.cookie + "_csrf"
+}
+
+/*
+setSessionCookies sets the HttpOnly session cookie holding the authentication token, and a cookie
+with its CSRF token that the web app reads and echoes in the X-CSRF-Token header.
+*/
+func (app *application) setSessionCookies(w http.ResponseWriter, token string, expiry time.Time) {
+	cfg := app.config.session
+	maxAge := int(time.Until(expiry).Seconds())
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cfg.cookie,
+		Value:    token,
+		Path:     "/",
+		Domain:   cfg.domain,
+		Expires:  expiry,
+		MaxAge:   maxAge,
+		Secure:   cfg.secure,
+		HttpOnly: true,
+		SameSite: cfg.mode,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     app.csrfCookieName(),
+		Value:    csrfToken(token),
+		Path:     "/",
+		Domain:   cfg.domain,
+		Expires:  expiry,
+		MaxAge:   maxAge,
+		Secure:   cfg.secure,
+		SameSite: cfg.mode,
+	})
+}
+
+func (app *application) clearSessionCookies(w http.ResponseWriter) {
+	cfg := app.config.session
+	if cfg.cookie == "" {
+		return
+	}
+
+	for _, name := range []string{cfg.cookie, app.csrfCookieName()} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			Domain:   cfg.domain,
+			MaxAge:   -1,
+			Secure:   cfg.secure,
+			HttpOnly: name == cfg.cookie,
+			SameSite: cfg.mode,
+		})
+	}
+}
+
+// sessionCookieToken returns the authentication token in the session cookie, if cookie sessions are enabled.
+func (app *application) sessionCookieToken(r *http.Request) string {
+	if app.config.session.cookie == "" {
+		return ""
+	}
+
+	cookie, err := r.Cookie(app.config.session.cookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// requestToken returns the authentication token of a request, from the Authorization header or the session cookie.
+func (app *application) requestToken(r *http.Request) string {
+	if r.Header.Get("Authorization") != "" {
+		return bearerToken(r)
+	}
+	return app.sessionCookieToken(r)
+}
+
+/*
+cookieSessionUser authenticates requests without an Authorization header by their session cookie.
+Unknown or expired sessions are treated as anonymous and their cookies cleared. State-changing
+requests must carry the CSRF token of the session, see needsCSRFToken. Sessions in use are extended by session-ttl.
+It writes the error response itself when it returns false.
+*/
+func (app *application) cookieSessionUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	token := app.sessionCookieToken(r)
+	if token == "" {
+		return data.AnonymusUser, true
+	}
+
+	user, err := app.modelsFor(r).User.GetUserForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.clearSessionCookies(w)
+			return data.AnonymusUser, true
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	if needsCSRFToken(r) && !validCSRFToken(r, token) {
+		app.JSONError(w, errorInvalidCSRFToken, http.StatusForbidden)
+		return nil, false
+	}
+
+	expiry, err := app.modelsFor(r).Tokens.Extend(token, app.config.session.ttl)
+	if err != nil {
+		app.logError(r, err)
+	} else if !expiry.IsZero() {
+		app.setSessionCookies(w, token, expiry)
+	}
+
+	app.touchSession(r, token)
+
+	return user, true
+}
+
+/*
+createSessionHandler logs a browser in: the authentication token goes into an HttpOnly cookie
+instead of the response body, which carries the CSRF token the web app must send back.
+*/
+func (app *application) createSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Device   string `json:"device"`
+	}
+
+	if app.config.session.cookie == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err)
+		return
+	}
+
+	user, ok := app.checkCredentials(w, r, input.Email, input.Password)
+	if !ok {
+		return
+	}
+
+	ip, userAgent, device := app.sessionMeta(r, input.Device)
+
+	token, err := app.modelsFor(r).Tokens.NewSession(user.ID, app.config.session.ttl, ip, userAgent, device)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.loadUserAccess(r, user)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.setSessionCookies(w, token.Plaintext, token.Expiry)
+
+	app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Success: true,
+		Message: "logged in",
+		Data: envelope{
+			"user":       user,
+			"csrf_token": csrfToken(token.Plaintext),
+			"expiry":     token.Expiry,
+		},
+	})
+}
+
+// deleteSessionHandler logs out the session of the request, whether it uses a cookie or a bearer token.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.modelsFor(r).Tokens.DeleteToken(data.ScopeAuthentication, app.requestToken(r))
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.clearSessionCookies(w)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "logged out",
+	})
+}
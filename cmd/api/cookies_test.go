@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidCSRFToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/sessions", nil)
+	assert.False(t, validCSRFToken(r, "session"))
+
+	r.Header.Set(csrfHeader, csrfToken("other session"))
+	assert.False(t, validCSRFToken(r, "session"))
+
+	r.Header.Set(csrfHeader, csrfToken("session"))
+	assert.True(t, validCSRFToken(r, "session"))
+}
+
+func TestNeedsCSRFToken(t *testing.T) {
+	assert.False(t, needsCSRFToken(httptest.NewRequest(http.MethodGet, "/v1/users/me/sessions", nil)))
+	assert.True(t, needsCSRFToken(httptest.NewRequest(http.MethodPut, "/v1/users/me/password", nil)))
+
+	// Traefik asks with the method of the request it forwards.
+	assert.False(t, needsCSRFToken(httptest.NewRequest(http.MethodPost, "/v1/forward-auth?role=admin", nil)))
+	assert.True(t, needsCSRFToken(httptest.NewRequest(http.MethodPost, "/v1/forward-auth/../users", nil)))
+}
+
+func TestSessionCookies(t *testing.T) {
+	app := &application{}
+	app.config.session.cookie = "session"
+	app.config.session.secure = true
+	app.config.session.mode = http.SameSiteStrictMode
+
+	rr := httptest.NewRecorder()
+	app.clearSessionCookies(rr)
+
+	cookies := rr.Result().Cookies()
+	if assert.Len(t, cookies, 2) {
+		assert.Equal(t, "session", cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, "session_csrf", cookies[1].Name)
+		assert.False(t, cookies[1].HttpOnly)
+		assert.True(t, cookies[1].Secure)
+		assert.Equal(t, -1, cookies[1].MaxAge)
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 )
 
+var (
+	errorAccountInactive = errors.New("your account must be activated to access the resource")
+	errorNotPermitted    = errors.New("your user account doesn't have the necessary permissions to access this resource")
+)
+
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
@@ -25,8 +31,20 @@ func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r
 }
 
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your account must be activated to access the resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, errorAccountInactive.Error())
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusForbidden, errorNotPermitted.Error())
+}
+
+func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+)
+
+// passwordChangeTokenTTL is how long the token handed out at logins with an expired password lasts.
+const passwordChangeTokenTTL = 15 * time.Minute
+
+// parseMaxAges parses a comma separated list of role=days, such as "admin=90,user-manager=180".
+func parseMaxAges(list string) (map[string]time.Duration, error) {
+	maxAges := map[string]time.Duration{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		role, value, ok := strings.Cut(entry, "=")
+		days, err := strconv.Atoi(value)
+		if !ok || role == "" || err != nil || days < 1 {
+			return nil, fmt.Errorf("invalid password max age %q, must be <role>=<days>", entry)
+		}
+		maxAges[role] = time.Duration(days) * 24 * time.Hour
+	}
+	return maxAges, nil
+}
+
+// passwordMaxAge returns the shortest max age of the roles, 0 when none of them makes passwords expire.
+func (app *application) passwordMaxAge(roles []string) time.Duration {
+	var maxAge time.Duration
+	for _, role := range roles {
+		age, ok := app.config.rotation.maxAge[role]
+		if ok && (maxAge == 0 || age < maxAge) {
+			maxAge = age
+		}
+	}
+	return maxAge
+}
+
+/*
+refuseExpiredPassword refuses logins of user when one of their roles has a -password-max-age
+their password is older than. The response holds a token that can only be used to change the
+password, see changeExpiredPasswordHandler. It writes the error response itself when it returns true.
+*/
+func (app *application) refuseExpiredPassword(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	if len(app.config.rotation.maxAge) == 0 || user.PasswordChangedAt == nil {
+		return false
+	}
+
+	models := app.modelsFor(r)
+
+	roles, err := models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return true
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+
+	maxAge := app.passwordMaxAge(names)
+	if maxAge == 0 || time.Since(*user.PasswordChangedAt) < maxAge {
+		return false
+	}
+
+	token, err := models.Tokens.New(user.ID, passwordChangeTokenTTL, data.ScopePasswordChange)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return true
+	}
+
+	app.writeJSON(w, http.StatusForbidden, envelope{
+		"error":                 "password_expired",
+		"message":               "your password has expired and must be changed before you can log in",
+		"password_change_token": token,
+	})
+	return true
+}
+
+/*
+changeExpiredPasswordHandler changes an expired password with the token returned by the refused
+login. The token proves the old password was known and can't be used for anything else.
+*/
+func (app *application) changeExpiredPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	models := app.modelsFor(r)
+
+	user, err := models.User.GetUserForToken(data.ScopePasswordChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("invalid or expired password change token"), http.StatusBadRequest)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !app.checkPassword(w, r, input.Password, user) {
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.prunePasswordHistory(r, user)
+
+	err = models.Tokens.DeleteAllForUser(data.ScopePasswordChange, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "password changed, log in with the new one",
+	})
+}
+
+/*
+remindPasswordExpiry emails every interval the users whose password expires within
+-password-reminder-days. Each password is reminded about once, the mark is cleared when it changes.
+*/
+func (app *application) remindPasswordExpiry(interval time.Duration) {
+	roles := make([]string, 0, len(app.config.rotation.maxAge))
+	for role := range app.config.rotation.maxAge {
+		roles = append(roles, role)
+	}
+	notice := time.Duration(app.config.rotation.reminderDays) * 24 * time.Hour
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			organizations, err := app.models.Organizations.GetAll()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			for _, organization := range organizations {
+				models := app.models.ForOrganization(organization.ID)
+
+				ages, err := models.User.GetPasswordAges(roles)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					continue
+				}
+
+				for _, age := range ages {
+					expiresAt := age.ChangedAt.Add(app.passwordMaxAge(age.Roles))
+					if age.RemindedAt != nil || time.Until(expiresAt) > notice {
+						continue
+					}
+
+					err := models.User.MarkPasswordExpiryReminded(age.UserID)
+					if err != nil {
+						app.logger.PrintError(err, nil)
+						continue
+					}
+
+					emailData := map[string]interface{}{
+						"UserName":  age.Username,
+						"expiresAt": expiresAt.Format("2 January 2006"),
+					}
+
+					email := age.Email
+					app.background(func() {
+						err := app.mailer.Send(email, "password_expiry.html", emailData)
+						if err != nil {
+							app.logger.PrintError(err, map[string]string{"email": email})
+						}
+					})
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+)
+
+// exportTimeout bounds how long a single export may keep its database cursor open.
+const exportTimeout = 30 * time.Minute
+
+func (app *application) exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	filters, ok := app.readUserFilters(w, r)
+	if !ok {
+		return
+	}
+
+	format := app.readString(r.URL.Query(), "format", data.ExportFormatCSV)
+
+	out := &trackingWriter{w: w}
+
+	ew, err := data.NewExportWriter(out, format)
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"format": "must be csv or ndjson"})
+		return
+	}
+
+	w.Header().Set("Content-Type", ew.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().UTC().Format("20060102T150405Z"), format))
+
+	flusher, _ := w.(http.Flusher)
+
+	count := 0
+	err = app.modelsFor(r).User.ExportUsers(r.Context(), filters, func(user *data.User) error {
+		err := ew.Write(user)
+		if err != nil {
+			return err
+		}
+
+		count++
+		if count%1000 == 0 && flusher != nil {
+			err = ew.Flush()
+			flusher.Flush()
+		}
+		return err
+	})
+
+	if err != nil {
+		// While nothing has reached the client a proper error response can still be sent.
+		if !out.written {
+			w.Header().Del("Content-Disposition")
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// Once rows have been streamed the status line is gone, so the error can only be logged.
+		app.logError(r, err)
+		return
+	}
+
+	err = ew.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// trackingWriter records whether anything has been written through it.
+type trackingWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.w.Write(p)
+}
+
+func (app *application) createExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.export.dir == "" {
+		app.JSONError(w, fmt.Errorf("export directory is not configured"), http.StatusServiceUnavailable)
+		return
+	}
+
+	filters, ok := app.readUserFilters(w, r)
+	if !ok {
+		return
+	}
+
+	format := app.readString(r.URL.Query(), "format", data.ExportFormatCSV)
+	if format != data.ExportFormatCSV && format != data.ExportFormatNDJSON {
+		app.failedValidationResponse(w, r, map[string]string{"format": "must be csv or ndjson"})
+		return
+	}
+
+	path := app.exportPath(app.ContextGetOrganization(r), format)
+	models := app.modelsFor(r)
+
+	app.background(func() {
+		err := app.exportUsersToFile(models, path, format, filters)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+
+	app.writeJSON(w, http.StatusAccepted, JSONResponse{
+		Success: true,
+		Message: "users export started",
+		Data:    envelope{"file": path},
+	})
+}
+
+// exportPath returns a timestamped file name for an export of the organization in the export directory.
+func (app *application) exportPath(organization *data.Organization, format string) string {
+	name := fmt.Sprintf("users-%s-%s.%s", organization.Slug, time.Now().UTC().Format("20060102T150405.000000000Z"), format)
+	return filepath.Join(app.config.export.dir, name)
+}
+
+/*
+exportUsersToFile writes an export of the users visible to models to path. The export is written to a temporary file
+first and renamed once complete, so a half-written export never appears under path.
+*/
+func (app *application) exportUsersToFile(models data.Models, path, format string, filters data.UserFilters) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".users-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	ew, err := data.NewExportWriter(f, format)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	err = models.User.ExportUsers(ctx, filters, ew.Write)
+	if err != nil {
+		return err
+	}
+
+	err = ew.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// scheduleExports writes a full export of every organization to the export directory every interval.
+func (app *application) scheduleExports(interval time.Duration, format string) {
+	filters := data.UserFilters{
+		Filters: data.Filters{Sort: "id", SortSafelist: data.UserSortSafelist},
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			organizations, err := app.models.Organizations.GetAll()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			for _, organization := range organizations {
+				path := app.exportPath(organization, format)
+				models := app.models.ForOrganization(organization.ID)
+
+				app.background(func() {
+					err := app.exportUsersToFile(models, path, format, filters)
+					if err != nil {
+						app.logger.PrintError(err, map[string]string{"file": path})
+						return
+					}
+
+					app.logger.PrintInfo("users export written", map[string]string{"file": path})
+				})
+			}
+		}
+	}()
+}
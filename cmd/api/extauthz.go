@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"rabitech.auth.app/internal/data"
+)
+
+/*
+extAuthzServer implements Envoy's external authorization service. Envoy calls Check for every
+request it proxies; allowed requests continue upstream with the identity headers added and denied
+requests are answered with the response built here.
+
+Routes require roles and permissions with the role and permission context extensions of the
+ext_authz filter, each a comma-separated list, and are pinned to the organization extension, with
+the same meaning as the query parameters of forward-auth.
+*/
+type extAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+
+	app *application
+}
+
+/*
+serveExtAuthz starts the ext_authz gRPC server in the background. It serves TLS when
+-ext-authz-tls-cert is set and plaintext otherwise, which is only safe on loopback or a network
+nothing but Envoy can reach.
+*/
+func (app *application) serveExtAuthz() (*grpc.Server, error) {
+	var options []grpc.ServerOption
+	if app.config.extAuthz.tlsCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(app.config.extAuthz.tlsCert, app.config.extAuthz.tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(app.config.extAuthz.host, strconv.Itoa(app.config.extAuthz.port)))
+	if err != nil {
+		return nil, err
+	}
+
+	srv := grpc.NewServer(options...)
+	authv3.RegisterAuthorizationServer(srv, &extAuthzServer{app: app})
+
+	go func() {
+		err := srv.Serve(listener)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"addr": listener.Addr().String()})
+		}
+	}()
+
+	app.logger.PrintInfo("starting ext_authz server", map[string]string{
+		"addr": listener.Addr().String(),
+		"tls":  strconv.FormatBool(app.config.extAuthz.tlsCert != ""),
+	})
+
+	return srv, nil
+}
+
+// extAuthzRequest turns the attributes of the request Envoy asks about into an http.Request, so
+// tenant resolution and token lookup work as they do for requests to the API.
+func extAuthzRequest(ctx context.Context, attributes *authv3.AttributeContext_HttpRequest) *http.Request {
+	header := http.Header{}
+	for name, value := range attributes.GetHeaders() {
+		if !strings.HasPrefix(name, ":") {
+			header.Set(name, value)
+		}
+	}
+
+	u, err := url.ParseRequestURI(attributes.GetPath())
+	if err != nil {
+		u = &url.URL{Path: "/"}
+	}
+
+	r := &http.Request{
+		Method:     attributes.GetMethod(),
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Host:       attributes.GetHost(),
+	}
+
+	return r.WithContext(ctx)
+}
+
+// extAuthzHeaders converts headers to Envoy header options that replace any value the client sent.
+func extAuthzHeaders(h http.Header) []*corev3.HeaderValueOption {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	options := make([]*corev3.HeaderValueOption, 0, len(names))
+	for _, name := range names {
+		options = append(options, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: strings.ToLower(name), Value: h.Get(name)},
+			Append: wrapperspb.Bool(false),
+		})
+	}
+
+	return options
+}
+
+// extAuthzDenied builds a denial that Envoy sends to the client as a JSON error response.
+func extAuthzDenied(code codes.Code, httpStatus typev3.StatusCode, message string) *authv3.CheckResponse {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if httpStatus == typev3.StatusCode_Unauthorized {
+		header.Set("WWW-Authenticate", "Bearer")
+	}
+
+	body, _ := json.Marshal(envelope{"error": message})
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(code), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: httpStatus},
+				Headers: extAuthzHeaders(header),
+				Body:    string(body),
+			},
+		},
+	}
+}
+
+// splitList splits a comma-separated context extension, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Check decides on a request proxied by Envoy.
+func (s *extAuthzServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	app := s.app
+	r := extAuthzRequest(ctx, req.GetAttributes().GetRequest().GetHttp())
+
+	organization, err := app.organizationFor(r)
+	if err != nil {
+		if errors.Is(err, data.ErrorRecordNotFound) {
+			return extAuthzDenied(codes.NotFound, typev3.StatusCode_NotFound, "unknown organization"), nil
+		}
+		return nil, s.internalError(r, err)
+	}
+	r = app.ContextSetOrganization(r, organization)
+
+	var token string
+	if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && scheme == "Bearer" {
+		token = credentials
+	} else if app.config.forwardAuth.cookie != "" {
+		if cookie, err := r.Cookie(app.config.forwardAuth.cookie); err == nil {
+			token = cookie.Value
+		}
+	}
+
+	user, err := app.tokenUser(r, token)
+	if err != nil {
+		return nil, s.internalError(r, err)
+	}
+
+	if user.IsAnonymus() {
+		return extAuthzDenied(codes.Unauthenticated, typev3.StatusCode_Unauthorized, "invalid or missing authentication token"), nil
+	}
+
+	return s.authorize(r, user, req.GetAttributes().GetContextExtensions())
+}
+
+/*
+authorize decides whether user may pass the route with extensions. The organization the request
+was routed to comes from the host or x-tenant header the client sent, so only the organization
+extension set in the Envoy config, the default organization when missing, decides whose users pass.
+*/
+func (s *extAuthzServer) authorize(r *http.Request, user *data.User, extensions map[string]string) (*authv3.CheckResponse, error) {
+	app := s.app
+
+	organizationID, err := app.routeOrganizationID(extensions["organization"])
+	if err != nil {
+		if errors.Is(err, data.ErrorRecordNotFound) {
+			return extAuthzDenied(codes.NotFound, typev3.StatusCode_NotFound, "unknown organization"), nil
+		}
+		return nil, s.internalError(r, err)
+	}
+
+	err = app.checkForwardAccess(r, user, organizationID, splitList(extensions["role"]), splitList(extensions["permission"]))
+	if err != nil {
+		switch {
+		case errors.Is(err, errorAccountInactive), errors.Is(err, errorNotPermitted):
+			return extAuthzDenied(codes.PermissionDenied, typev3.StatusCode_Forbidden, err.Error()), nil
+		default:
+			return nil, s.internalError(r, err)
+		}
+	}
+
+	identity := http.Header{}
+	setIdentityHeaders(identity, user, app.ContextGetOrganization(r))
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{Headers: extAuthzHeaders(identity)},
+		},
+	}, nil
+}
+
+// internalError logs err and returns the gRPC error Envoy handles according to its failure_mode_allow setting.
+func (s *extAuthzServer) internalError(r *http.Request, err error) error {
+	s.app.logger.PrintError(err, map[string]string{
+		"request_method": r.Method,
+		"request_host":   r.Host,
+		"request_path":   r.URL.Path,
+	})
+	return status.Error(codes.Internal, "the server encountered a problem and could not process the request")
+}
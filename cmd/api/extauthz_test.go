@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"rabitech.auth.app/internal/data"
+)
+
+func TestExtAuthzRequest(t *testing.T) {
+	r := extAuthzRequest(context.Background(), &authv3.AttributeContext_HttpRequest{
+		Method:  "GET",
+		Host:    "acme.auth.example.com",
+		Path:    "/dashboards?id=3",
+		Headers: map[string]string{":authority": "acme.auth.example.com", "authorization": "Bearer abc", "x-tenant": "acme"},
+	})
+
+	assert.Equal(t, "acme.auth.example.com", r.Host)
+	assert.Equal(t, "/dashboards", r.URL.Path)
+	assert.Equal(t, "3", r.URL.Query().Get("id"))
+	assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+	assert.Equal(t, "acme", r.Header.Get("X-Tenant"))
+	assert.Empty(t, r.Header.Get(":authority"))
+}
+
+func TestExtAuthzDenied(t *testing.T) {
+	res := extAuthzDenied(codes.Unauthenticated, typev3.StatusCode_Unauthorized, "invalid or missing authentication token")
+
+	assert.Equal(t, int32(codes.Unauthenticated), res.GetStatus().GetCode())
+
+	denied := res.GetDeniedResponse()
+	if assert.NotNil(t, denied) {
+		assert.Equal(t, typev3.StatusCode_Unauthorized, denied.GetStatus().GetCode())
+		assert.JSONEq(t, `{"error": "invalid or missing authentication token"}`, denied.GetBody())
+
+		headers := map[string]string{}
+		for _, option := range denied.GetHeaders() {
+			headers[option.GetHeader().GetKey()] = option.GetHeader().GetValue()
+			assert.False(t, option.GetAppend().GetValue())
+		}
+		assert.Equal(t, map[string]string{"content-type": "application/json", "www-authenticate": "Bearer"}, headers)
+	}
+}
+
+func TestExtAuthzOtherOrganization(t *testing.T) {
+	s := &extAuthzServer{app: &application{}}
+
+	r := extAuthzRequest(context.Background(), &authv3.AttributeContext_HttpRequest{
+		Method:  "GET",
+		Host:    "dashboards.example.com",
+		Path:    "/",
+		Headers: map[string]string{"authorization": "Bearer abc", "x-tenant": "acme"},
+	})
+
+	// A user of the tenant the client addressed, with a role of the same name as the route requires.
+	user := &data.User{ID: 7, OrganizationID: 2, Active: true, Roles: []string{"support"}}
+
+	res, err := s.authorize(r, user, map[string]string{"role": "support"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int32(codes.PermissionDenied), res.GetStatus().GetCode())
+	assert.Nil(t, res.GetOkResponse())
+	assert.Equal(t, typev3.StatusCode_Forbidden, res.GetDeniedResponse().GetStatus().GetCode())
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"admin", "support"}, splitList(" admin,, support "))
+	assert.Nil(t, splitList(""))
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"rabitech.auth.app/internal/data"
+)
+
+// forwardAuthPath is the endpoint proxies ask about the requests they forward.
+const forwardAuthPath = "/v1/forward-auth"
+
+// forwardAuthMethods are the methods the forward-auth endpoint answers. nginx and Caddy always
+// ask with GET, Traefik repeats the method of the original request.
+var forwardAuthMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// Identity headers set on successful forward-auth responses, which proxies copy to the upstream request.
+const (
+	headerAuthUserID       = "X-Auth-User-Id"
+	headerAuthEmail        = "X-Auth-Email"
+	headerAuthRoles        = "X-Auth-Roles"
+	headerAuthOrganization = "X-Auth-Organization"
+)
+
+// setIdentityHeaders sets the identity headers of user, who was authorized in organization, on h.
+func setIdentityHeaders(h http.Header, user *data.User, organization *data.Organization) {
+	h.Set(headerAuthUserID, strconv.FormatInt(user.ID, 10))
+	h.Set(headerAuthEmail, user.Email)
+	h.Set(headerAuthRoles, strings.Join(user.Roles, ","))
+	h.Set(headerAuthOrganization, organization.Slug)
+}
+
+/*
+routeOrganizationID returns the ID of the organization a protected route is pinned to, the one
+with slug or the default organization when slug is empty. Only its users pass the route, since
+roles and permissions are granted per organization and the tenant a request is addressed to is
+chosen by the client.
+*/
+func (app *application) routeOrganizationID(slug string) (int64, error) {
+	if slug == "" {
+		return data.DefaultOrganizationID, nil
+	}
+
+	organization, err := app.models.Organizations.GetBySlug(slug)
+	if err != nil {
+		return 0, err
+	}
+	return organization.ID, nil
+}
+
+/*
+forwardAuthUser returns the user a proxied request was made by. The bearer token was already checked
+by authenticate; without one the authentication token in the forward-auth cookie is used, since
+browsers visiting a dashboard can't send an Authorization header.
+*/
+func (app *application) forwardAuthUser(r *http.Request) (*data.User, error) {
+	user := app.ContextGetUser(r)
+	if !user.IsAnonymus() || app.config.forwardAuth.cookie == "" {
+		return user, nil
+	}
+
+	cookie, err := r.Cookie(app.config.forwardAuth.cookie)
+	if err != nil {
+		return user, nil
+	}
+
+	return app.tokenUser(r, cookie.Value)
+}
+
+// tokenUser returns the user of an authentication token, or the anonymous user when the token is unknown or expired.
+func (app *application) tokenUser(r *http.Request, token string) (*data.User, error) {
+	if token == "" {
+		return data.AnonymusUser, nil
+	}
+
+	user, err := app.modelsFor(r).User.GetUserForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		if errors.Is(err, data.ErrorRecordNotFound) {
+			return data.AnonymusUser, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+/*
+checkForwardAccess returns errorAccountInactive or errorNotPermitted when user may not pass a route
+of the organization with organizationID with the required roles, of which one is needed, and
+permissions, all of which are needed. It loads the roles of the user.
+*/
+func (app *application) checkForwardAccess(r *http.Request, user *data.User, organizationID int64, roles, permissions []string) error {
+	if user.OrganizationID != organizationID {
+		return errorNotPermitted
+	}
+
+	if !user.Active {
+		return errorAccountInactive
+	}
+
+	err := app.loadUserAccess(r, user)
+	if err != nil {
+		return err
+	}
+
+	if !hasAnyRole(user.Roles, roles) {
+		return errorNotPermitted
+	}
+
+	for _, code := range permissions {
+		if !user.Permissions.Include(code) {
+			return errorNotPermitted
+		}
+	}
+
+	return nil
+}
+
+// forwardedURL rebuilds the URL of the original request from the headers the proxy added.
+func forwardedURL(r *http.Request) string {
+	if original := r.Header.Get("X-Original-URL"); original != "" {
+		return original
+	}
+
+	scheme := r.Header.Get("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+
+	uri := r.Header.Get("X-Forwarded-Uri")
+	if uri == "" {
+		uri = "/"
+	}
+
+	return scheme + "://" + host + uri
+}
+
+// hasAnyRole reports whether roles include one of required. No required roles means any user will do.
+func hasAnyRole(roles, required []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	for _, want := range required {
+		for _, role := range roles {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loginRedirectURL returns the login page address with the page to return to in the rd parameter.
+func (app *application) loginRedirectURL(returnTo string) (string, error) {
+	u, err := url.Parse(app.config.forwardAuth.loginURL)
+	if err != nil {
+		return "", err
+	}
+
+	qs := u.Query()
+	qs.Set("rd", returnTo)
+	u.RawQuery = qs.Encode()
+
+	return u.String(), nil
+}
+
+/*
+forwardAuthHandler answers the authentication subrequests of nginx auth_request, Traefik ForwardAuth
+and Caddy forward_auth. Authenticated users get 200 and the identity headers. Each protected route
+can require roles with role query parameters, of which the user needs one, and permissions with
+permission query parameters, all of which the user needs. Only users of the organization query
+parameter, the default organization when missing, pass.
+
+Unauthenticated browsers are redirected to the login page when one is configured, unless the
+query has redirect=false, which nginx needs since auth_request only understands 2xx, 401 and 403.
+*/
+func (app *application) forwardAuthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	user, err := app.forwardAuthUser(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	if user.IsAnonymus() {
+		if app.config.forwardAuth.loginURL != "" && qs.Get("redirect") != "false" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			location, err := app.loginRedirectURL(forwardedURL(r))
+			if err != nil {
+				app.JSONError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	organizationID, err := app.routeOrganizationID(qs.Get("organization"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, "unknown organization")
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = app.checkForwardAccess(r, user, organizationID, qs["role"], qs["permission"])
+	if err != nil {
+		switch {
+		case errors.Is(err, errorAccountInactive):
+			app.inactiveAccountResponse(w, r)
+		case errors.Is(err, errorNotPermitted):
+			app.notPermittedResponse(w, r)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The user was found in the organization the request was routed to, which is now the route's.
+	setIdentityHeaders(w.Header(), user, app.ContextGetOrganization(r))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/data"
+)
+
+func TestForwardedURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/forward-auth", nil)
+	r.Host = "auth.internal"
+	assert.Equal(t, "http://auth.internal/", forwardedURL(r))
+
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "grafana.example.com")
+	r.Header.Set("X-Forwarded-Uri", "/d/home?orgId=1")
+	assert.Equal(t, "https://grafana.example.com/d/home?orgId=1", forwardedURL(r))
+
+	r.Header.Set("X-Original-URL", "https://kibana.example.com/app")
+	assert.Equal(t, "https://kibana.example.com/app", forwardedURL(r))
+}
+
+func TestHasAnyRole(t *testing.T) {
+	assert.True(t, hasAnyRole(nil, nil))
+	assert.True(t, hasAnyRole([]string{"support", "auditor"}, []string{"admin", "auditor"}))
+	assert.False(t, hasAnyRole([]string{"support"}, []string{"admin"}))
+}
+
+func TestForwardAuthAnonymous(t *testing.T) {
+	app := &application{}
+	app.config.forwardAuth.loginURL = "https://auth.example.com/login?app=dashboards"
+
+	r := httptest.NewRequest("GET", "/v1/forward-auth", nil)
+	r.Header.Set("Accept", "text/html")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "grafana.example.com")
+	r.Header.Set("X-Forwarded-Uri", "/d/home")
+	r = app.ContextSetUser(r, data.AnonymusUser)
+
+	rr := httptest.NewRecorder()
+	app.forwardAuthHandler(rr, r)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://auth.example.com/login?app=dashboards&rd=https%3A%2F%2Fgrafana.example.com%2Fd%2Fhome", rr.Header().Get("Location"))
+
+	r.URL.RawQuery = "redirect=false"
+	rr = httptest.NewRecorder()
+	app.forwardAuthHandler(rr, r)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestForwardAuthOtherOrganization(t *testing.T) {
+	app := &application{}
+
+	// An admin of a tenant, whose roles and permissions only apply in that tenant.
+	user := &data.User{ID: 7, OrganizationID: 2, Active: true, Roles: []string{"admin"}}
+
+	r := httptest.NewRequest("GET", "/v1/forward-auth?role=admin&permission=users:read", nil)
+	r.Header.Set("X-Tenant", "acme")
+	r = app.ContextSetUser(r, user)
+
+	rr := httptest.NewRecorder()
+	app.forwardAuthHandler(rr, r)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, rr.Header().Get("X-Auth-User-Id"))
+	assert.Empty(t, rr.Header().Get("X-Auth-Organization"))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/gateway"
+)
+
+// serveGateway starts the authenticating reverse proxy in the background.
+func (app *application) serveGateway() *http.Server {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", app.config.gateway.port),
+		Handler:           app.recoverPanic(http.HandlerFunc(app.gatewayHandler)),
+		IdleTimeout:       time.Minute,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := srv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.logger.PrintError(err, map[string]string{"addr": srv.Addr})
+		}
+	}()
+
+	app.logger.PrintInfo("starting gateway", map[string]string{"addr": srv.Addr})
+
+	return srv
+}
+
+// gatewayOrganization looks up the organization whose users may use route.
+func (app *application) gatewayOrganization(route *gateway.Route) (*data.Organization, error) {
+	if route.Organization == "" {
+		return app.models.Organizations.Get(data.DefaultOrganizationID)
+	}
+	return app.models.Organizations.GetBySlug(route.Organization)
+}
+
+// gatewayURL returns the address the client asked the gateway for.
+func gatewayURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+/*
+gatewayHandler proxies a request to the upstream of its route. Paths that aren't clean are refused,
+so the route checked is the one the upstream serves. Identity headers sent by the client
+are dropped. Unless the route is public, the user must be logged in with a bearer token or the
+forward-auth cookie and pass the route's role and permission requirements; their identity headers
+are then added and the credentials removed, so upstreams never see the user's token.
+*/
+func (app *application) gatewayHandler(w http.ResponseWriter, r *http.Request) {
+	if !gateway.Canonical(r.URL) {
+		app.errorResponse(w, r, http.StatusBadRequest, "the request path must not contain . or .. segments, repeated slashes or encoded dots")
+		return
+	}
+
+	route := app.gateway.Match(r.Host, r.URL.Path)
+	if route == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	gateway.StripIdentity(r.Header)
+
+	if route.Public {
+		route.ServeHTTP(w, r)
+		return
+	}
+
+	organization, err := app.gatewayOrganization(route)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	r = app.ContextSetOrganization(r, organization)
+
+	var token string
+	if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && scheme == "Bearer" {
+		token = credentials
+		r.Header.Del("Authorization")
+	} else if app.config.forwardAuth.cookie != "" {
+		if cookie, err := r.Cookie(app.config.forwardAuth.cookie); err == nil {
+			token = cookie.Value
+			gateway.RemoveCookie(r, app.config.forwardAuth.cookie)
+		}
+	}
+
+	user, err := app.tokenUser(r, token)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if user.IsAnonymus() {
+		if app.config.forwardAuth.loginURL != "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			location, err := app.loginRedirectURL(gatewayURL(r))
+			if err != nil {
+				app.JSONError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.checkForwardAccess(r, user, organization.ID, route.Roles, route.Permissions)
+	if err != nil {
+		switch {
+		case errors.Is(err, errorAccountInactive):
+			app.inactiveAccountResponse(w, r)
+		case errors.Is(err, errorNotPermitted):
+			app.notPermittedResponse(w, r)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setIdentityHeaders(r.Header, user, organization)
+	route.ServeHTTP(w, r)
+}
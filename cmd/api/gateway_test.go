@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/gateway"
+)
+
+func TestGatewayTraversal(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	err := os.WriteFile(path, []byte(fmt.Sprintf(`{"routes": [
+		{"path_prefix": "/admin", "upstream": %q, "roles": ["admin"]},
+		{"path_prefix": "/public", "upstream": %q, "public": true}
+	]}`, upstream.URL, upstream.URL)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{}
+	app.gateway, err = gateway.Load(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rr := httptest.NewRecorder()
+	app.gatewayHandler(rr, httptest.NewRequest("GET", "/public/img.png", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "/public/img.png", rr.Body.String())
+
+	for _, target := range []string{"/public/../admin", "/public/%2e%2e/admin", "/public//../admin"} {
+		rr := httptest.NewRecorder()
+		app.gatewayHandler(rr, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+		assert.NotContains(t, rr.Body.String(), "/admin", target)
+	}
+}
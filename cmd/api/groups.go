@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/validator"
+)
+
+// fetchGroupFromParam looks up the group identified by the id url parameter and
+// writes the error response itself when the group can't be loaded.
+func (app *application) fetchGroupFromParam(w http.ResponseWriter, r *http.Request) (*data.Group, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	group, err := app.modelsFor(r).Groups.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no group found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return group, true
+}
+
+// readInt64Param reads a numeric url parameter other than id.
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
+	value, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName(name), 10, 64)
+	if err != nil || value < 1 {
+		return 0, errors.New("invalid " + name + " parameter")
+	}
+
+	return value, nil
+}
+
+func validateGroupName(v *validator.Validator, name string) {
+	v.Check(name != "", "display_name", "must be provided")
+	v.Check(len(name) <= 200, "display_name", "must not be more than 200 characters long")
+}
+
+func (app *application) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "id",
+		SortSafelist: []string{"id"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	groups, metadata, err := app.modelsFor(r).Groups.GetAll(filters)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success:  true,
+		Message:  "groups fetch success",
+		Data:     groups,
+		Metadata: metadata,
+	})
+}
+
+func (app *application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DisplayName string  `json:"display_name"`
+		Members     []int64 `json:"members"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	if validateGroupName(v, input.DisplayName); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	group := &data.Group{DisplayName: input.DisplayName}
+	for _, id := range input.Members {
+		group.Members = append(group.Members, &data.GroupMember{UserID: id})
+	}
+
+	err = app.modelsFor(r).Groups.Insert(group)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Success: true,
+		Message: "group created",
+		Data:    group,
+	})
+}
+
+func (app *application) showGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.modelsFor(r).Roles.GetAllForGroup(group.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	group.Roles = make([]string, 0, len(roles))
+	for _, role := range roles {
+		group.Roles = append(group.Roles, role.Name)
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "group fetch success",
+		Data:    group,
+	})
+}
+
+func (app *application) updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		DisplayName *string `json:"display_name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.DisplayName != nil {
+		group.DisplayName = *input.DisplayName
+	}
+
+	v := validator.New()
+	if validateGroupName(v, group.DisplayName); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.modelsFor(r).Groups.Update(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorEditConflict):
+			app.JSONError(w, errors.New("the group was changed by another request, please try again"), http.StatusConflict)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "group update success",
+		Data:    group,
+	})
+}
+
+func (app *application) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.modelsFor(r).Groups.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no group found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "group deleted",
+	})
+}
+
+// listGroupMembersHandler lists the direct members of a group, or every member of it and its subgroups with ?transitive=true.
+func (app *application) listGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	transitive := app.readOptionalBool(r.URL.Query(), "transitive", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	members := group.Members
+
+	if transitive != nil && *transitive {
+		var err error
+
+		members, err = app.modelsFor(r).Groups.GetTransitiveMembers(group.ID)
+		if err != nil {
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "group members fetch success",
+		Data:    members,
+	})
+}
+
+func (app *application) addGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.modelsFor(r).User.GetUserByID(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"user_id": "no user with this id exists"})
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).Groups.AddMember(group.ID, input.UserID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserGroupAdded, input.UserID, map[string]interface{}{"group": group.DisplayName})
+
+	app.showGroupHandler(w, r)
+}
+
+func (app *application) removeGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := app.readInt64Param(r, "user_id")
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.modelsFor(r).Groups.RemoveMember(group.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("the user isn't a direct member of the group"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserGroupRemoved, userID, map[string]interface{}{"group": group.DisplayName})
+
+	app.showGroupHandler(w, r)
+}
+
+func (app *application) addSubgroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		GroupID int64 `json:"group_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.modelsFor(r).Groups.Get(input.GroupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"group_id": "no group with this id exists"})
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).Groups.AddSubgroup(group.ID, input.GroupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorGroupCycle):
+			app.failedValidationResponse(w, r, map[string]string{"group_id": "the group would end up containing itself"})
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.showGroupHandler(w, r)
+}
+
+func (app *application) removeSubgroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	childID, err := app.readInt64Param(r, "group_id")
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.modelsFor(r).Groups.RemoveSubgroup(group.ID, childID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("the group isn't nested in this group"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.showGroupHandler(w, r)
+}
+
+func (app *application) assignGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	role, err := app.modelsFor(r).Roles.GetByName(input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"role": "no role with this name exists"})
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !app.checkGrant(w, r, role.Permissions, role.BuiltIn) {
+		return
+	}
+
+	err = app.modelsFor(r).Roles.AssignToGroup(group.ID, role.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.showGroupHandler(w, r)
+}
+
+func (app *application) removeGroupRoleHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchGroupFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	role, err := app.modelsFor(r).Roles.GetByName(name)
+	if err == nil {
+		err = app.modelsFor(r).Roles.RemoveFromGroup(group.ID, role.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("the role isn't granted to the group"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.showGroupHandler(w, r)
+}
@@ -5,8 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/validator"
 )
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -106,3 +113,137 @@ func (app *application) JSONError(w http.ResponseWriter, err error, status ...in
 		})
 
 }
+
+// readIDParam reads the id url parameter from the request context.
+func (app *application) readIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+// readString returns a string value from the query string, or the default value if the key is missing.
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// readInt returns an int value from the query string, recording a validation error if it can't be parsed.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readOptionalInt is like readInt but returns nil when the key is missing.
+func (app *application) readOptionalInt(qs url.Values, key string, v *validator.Validator) *int {
+	if qs.Get(key) == "" {
+		return nil
+	}
+
+	i := app.readInt(qs, key, 0, v)
+	return &i
+}
+
+// readOptionalBool returns a bool value from the query string, or nil when the key is missing.
+func (app *application) readOptionalBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// readOptionalTime returns an RFC3339 timestamp from the query string, or nil when the key is missing.
+func (app *application) readOptionalTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC3339 timestamp")
+		return nil
+	}
+
+	return &t
+}
+
+// remoteIP returns the address of the peer of the connection, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (app *application) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range app.config.proxies.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+clientIP returns the address the request came from. Requests relayed by one of the trusted
+proxies are attributed to the address the proxies saw in X-Forwarded-For, read from the right so
+that clients can't spoof it by sending the header themselves.
+*/
+func (app *application) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !app.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
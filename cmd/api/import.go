@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+)
+
+// invitationDuration is how long the token in an invitation email stays valid.
+const invitationDuration = 3 * 24 * time.Hour
+
+// importFormat works out the import format from the format query parameter or the Content-Type header.
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "text/csv":
+		return data.ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson":
+		return data.ImportFormatNDJSON
+	}
+
+	return ""
+}
+
+func (app *application) importUsersHandler(w http.ResponseWriter, r *http.Request) {
+	invite, err := strconv.ParseBool(app.readString(r.URL.Query(), "invite", "false"))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"invite": "must be a boolean value"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 50<<20)
+
+	src, err := data.NewImportReader(r.Body, importFormat(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorUnsupportedImportFormat):
+			app.failedValidationResponse(w, r, map[string]string{"format": "must be csv or ndjson"})
+		default:
+			app.JSONError(w, err, http.StatusBadRequest)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), data.ImportTimeout)
+	defer cancel()
+
+	result, err := app.modelsFor(r).User.ImportUsers(ctx, src, app.importPasswordCheck(r))
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	for _, user := range result.Imported {
+		app.recordAudit(r, data.AuditUserImported, user.ID, map[string]interface{}{
+			"line": user.Line,
+		})
+	}
+
+	if invite {
+		app.sendInvitationEmails(r, result.Imported)
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "users import complete",
+		Data:    result,
+	})
+}
+
+// sendInvitationEmails emails every imported user a token to choose their password with.
+func (app *application) sendInvitationEmails(r *http.Request, users []*data.ImportedUser) {
+	app.background(func() {
+		for _, user := range users {
+			token, err := app.modelsFor(r).Tokens.New(user.ID, invitationDuration, data.ScopePasswordReset)
+			if err != nil {
+				app.logError(r, err)
+				continue
+			}
+
+			emailData := map[string]interface{}{
+				"UserName":        user.Username,
+				"invitationToken": token.Plaintext,
+				"expiryDuration":  invitationDuration,
+			}
+
+			err = app.mailer.Send(user.Email, "user_invitation.html", emailData)
+			if err != nil {
+				app.logError(r, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+)
+
+// unlockTokenTTL is how long the link of an account locked email works.
+const unlockTokenTTL = 24 * time.Hour
+
+/*
+loginBackoff returns the delay required after the failures-th failed login of a key. The first
+free failures cost nothing, the next waits base and every further one doubles it, up to max.
+*/
+func loginBackoff(failures, free int, base, max time.Duration) time.Duration {
+	n := failures - free
+	if n <= 0 || base <= 0 {
+		return 0
+	}
+
+	delay := base
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// loginWait returns how long logins of the throttle's key must wait at now.
+func loginWait(throttle *data.LoginThrottle, free int, base, max time.Duration, now time.Time) time.Duration {
+	wait := throttle.LastFailureAt.Add(loginBackoff(throttle.Failures, free, base, max)).Sub(now)
+
+	if throttle.Locked(now) && throttle.LockedUntil.Sub(now) > wait {
+		wait = throttle.LockedUntil.Sub(now)
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// ipFreeFailures is the number of failed logins from an IP address that aren't slowed down.
+func (app *application) ipFreeFailures() int {
+	if app.config.lockout.ipThreshold < 1 {
+		return 0
+	}
+	return app.config.lockout.ipThreshold - 1
+}
+
+// loginDelay returns how long the client must wait before trying to log in to email again.
+func (app *application) loginDelay(r *http.Request, email string) (time.Duration, error) {
+	cfg := app.config.lockout
+	now := time.Now()
+
+	account, err := app.modelsFor(r).Throttles.Get(data.ThrottleEmail, email)
+	if err != nil {
+		return 0, err
+	}
+
+	ip, err := app.modelsFor(r).Throttles.Get(data.ThrottleIP, app.clientIP(r))
+	if err != nil {
+		return 0, err
+	}
+
+	wait := loginWait(account, 0, cfg.backoff, cfg.maxBackoff, now)
+	if ipWait := loginWait(ip, app.ipFreeFailures(), cfg.backoff, cfg.maxBackoff, now); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait, nil
+}
+
+/*
+loginFailed counts a failed login for the email and the client's IP address. When it locks the
+account of user, which is nil for unknown emails, the user is emailed an unlock link.
+*/
+func (app *application) loginFailed(r *http.Request, user *data.User, email string) {
+	cfg := app.config.lockout
+	models := app.modelsFor(r)
+
+	_, err := models.Throttles.RecordFailure(data.ThrottleIP, app.clientIP(r), cfg.window, 0, 0)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	wasLocked := false
+	if throttle, err := models.Throttles.Get(data.ThrottleEmail, email); err == nil {
+		wasLocked = throttle.Locked(time.Now())
+	}
+
+	throttle, err := models.Throttles.RecordFailure(data.ThrottleEmail, email, cfg.window, cfg.threshold, cfg.duration)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	if user == nil || wasLocked || !throttle.Locked(time.Now()) {
+		return
+	}
+
+	app.logger.PrintInfo("account locked", map[string]string{
+		"user_id":  strconv.FormatInt(user.ID, 10),
+		"failures": strconv.Itoa(throttle.Failures),
+	})
+
+	err = app.sendUnlockEmail(r, user, throttle.LockedUntil)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// sendUnlockEmail tells a user their account was locked and emails a token that unlocks it.
+func (app *application) sendUnlockEmail(r *http.Request, user *data.User, lockedUntil *time.Time) error {
+	token, err := app.modelsFor(r).Tokens.New(user.ID, unlockTokenTTL, data.ScopeUnlock)
+	if err != nil {
+		return err
+	}
+
+	emailData := map[string]interface{}{
+		"UserName":       user.Username,
+		"unlockToken":    token.Plaintext,
+		"lockedUntil":    lockedUntil.Format(time.RFC1123),
+		"expiryDuration": unlockTokenTTL,
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "account_locked.html", emailData)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+
+	return nil
+}
+
+func (app *application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	message := "too many failed login attempts, try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// unlockUserHandler unlocks the account of an unlock token emailed when it was locked.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.modelsFor(r).User.GetUserForToken(data.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no user found with that token"), http.StatusBadRequest)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).Throttles.Reset(data.ThrottleEmail, user.Email)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeUnlock, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "account unlocked",
+	})
+}
+
+func (app *application) showUserLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	throttle, err := app.modelsFor(r).Throttles.Get(data.ThrottleEmail, user.Email)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Data: envelope{
+			"locked":          throttle.Locked(time.Now()),
+			"failures":        throttle.Failures,
+			"last_failure_at": throttle.LastFailureAt,
+			"locked_until":    throttle.LockedUntil,
+		},
+	})
+}
+
+func (app *application) adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.modelsFor(r).Throttles.Reset(data.ThrottleEmail, user.Email)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeUnlock, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserUnlocked, user.ID, nil)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "account unlocked",
+		Data:    user,
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/data"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		failures, free int
+		want           time.Duration
+	}{
+		{0, 0, 0},
+		{1, 0, time.Second},
+		{2, 0, 2 * time.Second},
+		{4, 0, 8 * time.Second},
+		{30, 0, time.Minute},
+		{19, 19, 0},
+		{21, 19, 2 * time.Second},
+	} {
+		assert.Equal(t, tt.want, loginBackoff(tt.failures, tt.free, time.Second, time.Minute), tt)
+	}
+}
+
+func TestLoginWait(t *testing.T) {
+	now := time.Now()
+	lockedUntil := now.Add(10 * time.Minute)
+
+	throttle := &data.LoginThrottle{Failures: 3, LastFailureAt: now.Add(-time.Second)}
+	assert.Equal(t, 3*time.Second, loginWait(throttle, 0, time.Second, time.Minute, now))
+
+	throttle.LastFailureAt = now.Add(-time.Hour)
+	assert.Equal(t, time.Duration(0), loginWait(throttle, 0, time.Second, time.Minute, now))
+
+	throttle.LockedUntil = &lockedUntil
+	assert.Equal(t, 10*time.Minute, loginWait(throttle, 0, time.Second, time.Minute, now))
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"runtime"
@@ -14,9 +17,14 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+	"rabitech.auth.app/internal/breach"
 	"rabitech.auth.app/internal/data"
 	"rabitech.auth.app/internal/data/mailer"
+	"rabitech.auth.app/internal/gateway"
 	"rabitech.auth.app/internal/jsonlog"
+	"rabitech.auth.app/internal/passwordpolicy"
+	"rabitech.auth.app/internal/policy"
+	"rabitech.auth.app/internal/ratelimit"
 
 	_ "github.com/lib/pq"
 )
@@ -29,16 +37,19 @@ import (
 type envelope map[string]interface{}
 
 type JSONResponse struct {
-	Error   bool        `json:"error,omitempty"`
-	Success bool        `json:"success,omitempty"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Error    bool        `json:"error,omitempty"`
+	Success  bool        `json:"success,omitempty"`
+	Message  string      `json:"message"`
+	Data     interface{} `json:"data,omitempty"`
+	Metadata interface{} `json:"metadata,omitempty"`
 }
 
 type config struct {
 	port int
 	env  string
-	db   struct {
+	// adminEmails are the users of the default organization given the admin role at startup.
+	adminEmails []string
+	db          struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -55,6 +66,78 @@ type config struct {
 	cors struct {
 		trustedURLOrigins []*url.URL
 	}
+	proxies struct {
+		trusted []*net.IPNet
+	}
+	limiter struct {
+		enabled bool
+		store   string
+	}
+	export struct {
+		dir      string
+		interval time.Duration
+		format   string
+	}
+	tenant struct {
+		domain string
+	}
+	policy struct {
+		dir      string
+		timezone string
+		location *time.Location
+	}
+	forwardAuth struct {
+		cookie   string
+		loginURL string
+	}
+	extAuthz struct {
+		host    string
+		port    int
+		tlsCert string
+		tlsKey  string
+	}
+	gateway struct {
+		port   int
+		config string
+	}
+	session struct {
+		cookie   string
+		domain   string
+		secure   bool
+		sameSite string
+		mode     http.SameSite
+		ttl      time.Duration
+	}
+	lockout struct {
+		threshold   int
+		duration    time.Duration
+		window      time.Duration
+		ipThreshold int
+		backoff     time.Duration
+		maxBackoff  time.Duration
+	}
+	password passwordpolicy.Policy
+	hasher   struct {
+		algorithm   string
+		memory      int
+		time        int
+		parallelism int
+		bcryptCost  int
+		peppers     string
+		pepperFile  string
+		pepper      int
+	}
+	rotation struct {
+		history      int
+		maxAge       map[string]time.Duration
+		reminderDays int
+	}
+	breach struct {
+		dir        string
+		bloom      string
+		minCount   int
+		checkLogin bool
+	}
 }
 type application struct {
 	config config
@@ -62,6 +145,18 @@ type application struct {
 	mailer mailer.Mailer
 	wg     sync.WaitGroup
 	logger *jsonlog.Logger
+
+	// gateway holds the routes of the reverse proxy, nil unless it is enabled.
+	gateway *gateway.Config
+
+	// policies are the access policies loaded from files, which apply to every organization.
+	policies []*policy.Policy
+
+	// limiter keeps the rate limit buckets, nil when rate limiting is disabled.
+	limiter ratelimit.Store
+
+	// breached is the corpus of breached passwords, nil unless breach screening is enabled.
+	breached breach.Corpus
 }
 
 var (
@@ -79,6 +174,15 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 4002, "API Server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment(development|staging|production)")
+	flag.Func("admin-emails", "comma separated emails of the users of the default organization given the admin role at startup", func(list string) error {
+		cfg.adminEmails = nil
+		for _, email := range strings.Split(list, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				cfg.adminEmails = append(cfg.adminEmails, email)
+			}
+		}
+		return nil
+	})
 
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DATABASE_DSN"), "database connection string")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL maximum open connections")
@@ -102,6 +206,110 @@ func main() {
 		}
 		return nil
 	})
+	// proxy flags
+	flag.Func("trusted-proxies", "space separated addresses or CIDR ranges of proxies whose X-Forwarded-For header is trusted", func(s string) error {
+		for _, proxy := range strings.Fields(s) {
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+					proxy += "/32"
+				} else {
+					proxy += "/128"
+				}
+			}
+
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				return err
+			}
+
+			cfg.proxies.trusted = append(cfg.proxies.trusted, network)
+		}
+		return nil
+	})
+
+	// limiter flags
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "rate limit logins, registrations and other sensitive endpoints")
+	flag.StringVar(&cfg.limiter.store, "limiter-store", "memory", "where rate limit counters are kept (memory|postgres), postgres shares them between replicas")
+
+	// export flags
+	flag.StringVar(&cfg.export.dir, "export-dir", os.Getenv("EXPORT_DIR"), "directory background user exports are written to")
+	flag.DurationVar(&cfg.export.interval, "export-interval", 0, "interval between scheduled user exports, 0 disables them")
+	flag.StringVar(&cfg.export.format, "export-format", "csv", "format of scheduled user exports (csv|ndjson)")
+
+	// tenant flags
+	flag.StringVar(&cfg.tenant.domain, "tenant-domain", os.Getenv("TENANT_DOMAIN"), "base domain whose subdomains select the organization, e.g. auth.example.com")
+
+	// policy flags
+	flag.StringVar(&cfg.policy.dir, "policy-dir", os.Getenv("POLICY_DIR"), "directory of access policy files that apply to every organization")
+	flag.StringVar(&cfg.policy.timezone, "policy-timezone", "UTC", "time zone of the time attributes policy conditions see")
+
+	// forward-auth flags
+	flag.StringVar(&cfg.forwardAuth.cookie, "forward-auth-cookie", "auth_token", "cookie holding the authentication token of browsers passing through forward-auth, empty disables it")
+	flag.StringVar(&cfg.forwardAuth.loginURL, "forward-auth-login-url", os.Getenv("FORWARD_AUTH_LOGIN_URL"), "login page unauthenticated browsers are redirected to by forward-auth")
+
+	// ext_authz flags
+	flag.StringVar(&cfg.extAuthz.host, "ext-authz-host", "127.0.0.1", "address the Envoy ext_authz gRPC server listens on, empty for every interface")
+	flag.IntVar(&cfg.extAuthz.port, "ext-authz-port", 0, "port of the Envoy ext_authz gRPC server, 0 disables it")
+	flag.StringVar(&cfg.extAuthz.tlsCert, "ext-authz-tls-cert", os.Getenv("EXT_AUTHZ_TLS_CERT"), "PEM certificate of the Envoy ext_authz gRPC server, empty serves plaintext")
+	flag.StringVar(&cfg.extAuthz.tlsKey, "ext-authz-tls-key", os.Getenv("EXT_AUTHZ_TLS_KEY"), "PEM private key of the -ext-authz-tls-cert certificate")
+
+	// gateway flags
+	flag.IntVar(&cfg.gateway.port, "gateway-port", 0, "port of the authenticating reverse proxy, 0 disables it")
+	flag.StringVar(&cfg.gateway.config, "gateway-config", os.Getenv("GATEWAY_CONFIG"), "JSON file with the routes of the reverse proxy")
+
+	// session flags
+	flag.StringVar(&cfg.session.cookie, "session-cookie", "session", "cookie holding the authentication token of browser sessions, empty disables cookie sessions")
+	flag.StringVar(&cfg.session.domain, "session-domain", os.Getenv("SESSION_DOMAIN"), "domain of the session cookies, the host of the request when empty")
+	flag.BoolVar(&cfg.session.secure, "session-secure", true, "send the session cookies over HTTPS only")
+	flag.StringVar(&cfg.session.sameSite, "session-samesite", "lax", "SameSite attribute of the session cookies (lax|strict|none)")
+	flag.DurationVar(&cfg.session.ttl, "session-ttl", 24*time.Hour, "idle time after which cookie sessions expire")
+
+	// lockout flags
+	flag.IntVar(&cfg.lockout.threshold, "lockout-threshold", 5, "failed logins after which an account is locked, 0 disables locking")
+	flag.DurationVar(&cfg.lockout.duration, "lockout-duration", 15*time.Minute, "how long accounts stay locked")
+	flag.DurationVar(&cfg.lockout.window, "lockout-window", time.Hour, "failed logins older than this are forgotten")
+	flag.IntVar(&cfg.lockout.ipThreshold, "login-ip-threshold", 20, "failed logins from an IP address before its logins are slowed down")
+	flag.DurationVar(&cfg.lockout.backoff, "login-backoff", time.Second, "delay after the first throttled failed login, doubled with every further one, 0 disables it")
+	flag.DurationVar(&cfg.lockout.maxBackoff, "login-max-backoff", 5*time.Minute, "longest delay between throttled logins")
+
+	// password flags
+	flag.IntVar(&cfg.password.MinLength, "password-min-length", 8, "shortest password users may choose")
+	flag.IntVar(&cfg.password.MaxLength, "password-max-length", 64, "longest password users may choose, 0 for no limit")
+	flag.Func("password-classes", "comma separated character classes passwords must contain (lower,upper,digit,symbol)", func(s string) error {
+		classes, err := passwordpolicy.ParseClasses(s)
+		if err != nil {
+			return err
+		}
+		cfg.password.Classes = classes
+		return nil
+	})
+	flag.IntVar(&cfg.password.MinScore, "password-min-score", 3, "lowest strength score (0-4) of passwords users may choose")
+
+	// hasher flags
+	flag.StringVar(&cfg.hasher.algorithm, "password-hasher", "argon2id", "algorithm new passwords are hashed with (argon2id|bcrypt), older hashes are upgraded at login")
+	flag.IntVar(&cfg.hasher.memory, "argon2-memory", 64*1024, "memory used by argon2id in KiB")
+	flag.IntVar(&cfg.hasher.time, "argon2-time", 3, "passes argon2id makes over its memory")
+	flag.IntVar(&cfg.hasher.parallelism, "argon2-parallelism", 4, "lanes argon2id uses")
+	flag.IntVar(&cfg.hasher.bcryptCost, "bcrypt-cost", 12, "cost of bcrypt hashes")
+	flag.StringVar(&cfg.hasher.peppers, "password-peppers", os.Getenv("PASSWORD_PEPPERS"), "secrets passwords are HMACed with before hashing, as <version>:<base64 secret> separated by spaces")
+	flag.StringVar(&cfg.hasher.pepperFile, "password-pepper-file", os.Getenv("PASSWORD_PEPPER_FILE"), "file of password peppers, one <version>:<base64 secret> per line, instead of -password-peppers")
+	flag.IntVar(&cfg.hasher.pepper, "password-pepper-version", 0, "version of the pepper new hashes use, the highest one when 0")
+
+	// rotation flags
+	flag.IntVar(&cfg.rotation.history, "password-history", 5, "passwords, counting the current one, a new password must differ from (0 disables)")
+	flag.Func("password-max-age", "days after which the passwords of users with a role expire, e.g. admin=90,user-manager=180", func(list string) error {
+		var err error
+		cfg.rotation.maxAge, err = parseMaxAges(list)
+		return err
+	})
+	flag.IntVar(&cfg.rotation.reminderDays, "password-reminder-days", 14, "days before a password expires its user is emailed a reminder (0 disables)")
+
+	// breach flags
+	flag.StringVar(&cfg.breach.dir, "breach-dir", os.Getenv("BREACH_DIR"), "directory of Pwned Passwords range files new passwords are screened against")
+	flag.StringVar(&cfg.breach.bloom, "breach-bloom", os.Getenv("BREACH_BLOOM"), "bloom filter built by cmd/breach new passwords are screened against, instead of -breach-dir")
+	flag.IntVar(&cfg.breach.minCount, "breach-min-count", 1, "breaches a password must have been seen in to be rejected, for -breach-dir")
+	flag.BoolVar(&cfg.breach.checkLogin, "breach-check-login", false, "refuse logins with breached passwords and email their users a password reset link")
+
 	// Version flag
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -116,6 +324,70 @@ func main() {
 		os.Exit(0)
 	}
 
+	cfg.policy.location, err = time.LoadLocation(cfg.policy.timezone)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	cfg.session.mode, err = parseSameSite(cfg.session.sameSite)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if cfg.session.mode == http.SameSiteNoneMode && !cfg.session.secure {
+		logger.PrintFatal(errors.New("-session-samesite=none requires -session-secure"), nil)
+	}
+
+	if (cfg.extAuthz.tlsCert == "") != (cfg.extAuthz.tlsKey == "") {
+		logger.PrintFatal(errors.New("-ext-authz-tls-cert and -ext-authz-tls-key must be set together"), nil)
+	}
+
+	if cfg.export.format != data.ExportFormatCSV && cfg.export.format != data.ExportFormatNDJSON {
+		logger.PrintFatal(fmt.Errorf("invalid export format %q, must be csv or ndjson", cfg.export.format), nil)
+	}
+
+	data.PasswordHasher, err = passwordHasher(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	var breached breach.Corpus
+	switch {
+	case cfg.breach.dir != "" && cfg.breach.bloom != "":
+		logger.PrintFatal(errors.New("only one of -breach-dir and -breach-bloom can be set"), nil)
+	case cfg.breach.dir != "":
+		breached, err = breach.OpenRangeDir(cfg.breach.dir, cfg.breach.minCount)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	case cfg.breach.bloom != "":
+		bloom, err := breach.LoadBloom(cfg.breach.bloom)
+		if err != nil {
+			logger.PrintFatal(err, map[string]string{"file": cfg.breach.bloom})
+		}
+		logger.PrintInfo("breached passwords loaded", map[string]string{"hashes": fmt.Sprint(bloom.Len())})
+		breached = bloom
+	}
+
+	var policies []*policy.Policy
+	if cfg.policy.dir != "" {
+		policies, err = policy.LoadDir(cfg.policy.dir)
+		if err != nil {
+			logger.PrintFatal(err, map[string]string{"dir": cfg.policy.dir})
+		}
+	}
+
+	var gatewayConfig *gateway.Config
+	if cfg.gateway.port != 0 {
+		if cfg.gateway.config == "" {
+			logger.PrintFatal(errors.New("-gateway-config must be set to enable the gateway"), nil)
+		}
+
+		gatewayConfig, err = gateway.Load(cfg.gateway.config)
+		if err != nil {
+			logger.PrintFatal(err, map[string]string{"file": cfg.gateway.config})
+		}
+	}
+
 	db, err := openDB(cfg)
 
 	if err != nil {
@@ -146,6 +418,42 @@ func main() {
 		logger: logger,
 		models: data.NewModel(db),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+
+		gateway:  gatewayConfig,
+		policies: policies,
+		breached: breached,
+	}
+
+	if len(cfg.adminEmails) > 0 {
+		err = app.bootstrapAdmins(cfg.adminEmails)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	if cfg.limiter.enabled {
+		switch cfg.limiter.store {
+		case "memory":
+			app.limiter = ratelimit.NewMemoryStore()
+		case "postgres":
+			store := ratelimit.PostgresStore{DB: db}
+			app.limiter = store
+			app.cleanRateLimits(store, 10*time.Minute)
+		default:
+			logger.PrintFatal(fmt.Errorf("invalid rate limit store %q, must be memory or postgres", cfg.limiter.store), nil)
+		}
+	}
+
+	if len(cfg.rotation.maxAge) > 0 && cfg.rotation.reminderDays > 0 {
+		app.remindPasswordExpiry(time.Hour)
+	}
+
+	if data.PasswordHasher.Peppered() {
+		app.reportPepperRotation(time.Hour)
+	}
+
+	if cfg.export.interval > 0 && cfg.export.dir != "" {
+		app.scheduleExports(cfg.export.interval, cfg.export.format)
 	}
 
 	logger.PrintInfo("stating server", map[string]string{
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"expvar"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -30,14 +31,83 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+/*
+resolveTenant routes the request to an organization. A subdomain of the configured tenant
+domain takes precedence over the X-Tenant header, and requests with neither are routed to
+the default organization.
+*/
+func (app *application) resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "X-Tenant")
+
+		organization, err := app.organizationFor(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrorRecordNotFound):
+				app.errorResponse(w, r, http.StatusNotFound, "unknown organization")
+			default:
+				app.JSONError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		r = app.ContextSetOrganization(r, organization)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// organizationFor looks up the organization the request is addressed to.
+func (app *application) organizationFor(r *http.Request) (*data.Organization, error) {
+	if slug := app.tenantSlug(r); slug != "" {
+		return app.models.Organizations.GetBySlug(slug)
+	}
+	return app.models.Organizations.Get(data.DefaultOrganizationID)
+}
+
+// tenantSlug returns the organization slug the request is addressed to, or "" for the default organization.
+func (app *application) tenantSlug(r *http.Request) string {
+	if app.config.tenant.domain != "" {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		suffix := "." + strings.ToLower(app.config.tenant.domain)
+		if subdomain := strings.TrimSuffix(host, suffix); subdomain != host && !strings.Contains(subdomain, ".") {
+			return subdomain
+		}
+	}
+
+	return strings.ToLower(r.Header.Get("X-Tenant"))
+}
+
+// requireDefaultOrganization only serves the request in the default organization, where platform
+// admins manage the other organizations. Elsewhere the resource doesn't exist.
+func (app *application) requireDefaultOrganization(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.ContextGetOrganization(r).ID != data.DefaultOrganizationID {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "Cookie")
 
 		authorizationHeader := r.Header.Get("Authorization")
 
 		if authorizationHeader == "" {
-			r = app.ContextSetUser(r, data.AnonymusUser)
+			user, ok := app.cookieSessionUser(w, r)
+			if !ok {
+				return
+			}
+
+			r = app.ContextSetUser(r, user)
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -50,7 +120,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
-		user, err := app.models.User.GetUserForToken(data.ScopeAuthentication, token)
+		user, err := app.modelsFor(r).User.GetUserForToken(data.ScopeAuthentication, token)
 
 		if err != nil {
 			switch {
@@ -62,6 +132,8 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		app.touchSession(r, token)
+
 		r = app.ContextSetUser(r, user)
 		next.ServeHTTP(w, r)
 
@@ -81,13 +153,19 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
-func (app *application) requireAdminUser(next http.HandlerFunc) http.HandlerFunc {
+// requirePermission allows the request through only if one of the user's roles grants the permission code.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.ContextGetUser(r)
 
-		if user.Role != 1 {
-			fmt.Println("user is not admin")
-			app.writeJSON(w, http.StatusBadRequest, envelope{"error": "you can't access this resource, !admin"})
+		permissions, err := app.modelsFor(r).Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
 			return
 		}
 
@@ -126,13 +204,15 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 					return
 				}
 
-				if originURL == app.config.cors.trustedURLOrigins[i] {
+				trusted := app.config.cors.trustedURLOrigins[i]
+				if originURL.Scheme == trusted.Scheme && originURL.Host == trusted.Host {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-CSRF-Token")
 
 						w.WriteHeader(http.StatusOK)
 						return
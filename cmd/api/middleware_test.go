@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantSlug(t *testing.T) {
+	app := &application{}
+	app.config.tenant.domain = "auth.example.com"
+
+	tests := []struct {
+		host   string
+		header string
+		want   string
+	}{
+		{host: "acme.auth.example.com", want: "acme"},
+		{host: "ACME.auth.example.com:4000", want: "acme"},
+		{host: "acme.auth.example.com", header: "other", want: "acme"},
+		{host: "auth.example.com", header: "Other", want: "other"},
+		{host: "a.b.auth.example.com", want: ""},
+		{host: "localhost:4000", want: ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = tt.host
+		if tt.header != "" {
+			r.Header.Set("X-Tenant", tt.header)
+		}
+
+		assert.Equal(t, tt.want, app.tenantSlug(r), tt.host)
+	}
+}
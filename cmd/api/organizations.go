@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/validator"
+)
+
+// fetchOrganizationFromParam looks up the organization identified by the id url parameter and
+// writes the error response itself when the organization can't be loaded.
+func (app *application) fetchOrganizationFromParam(w http.ResponseWriter, r *http.Request) (*data.Organization, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	organization, err := app.models.Organizations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no organization found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return organization, true
+}
+
+// organizationSaveError writes the error response for a failed organization insert or update.
+func (app *application) organizationSaveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrorDuplicateSlug):
+		app.failedValidationResponse(w, r, map[string]string{"slug": "an organization with this slug already exists"})
+	case errors.Is(err, data.ErrorRecordNotFound):
+		app.JSONError(w, errors.New("no organization found with such id"), http.StatusNotFound)
+	default:
+		app.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) listOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	organizations, err := app.models.Organizations.GetAll()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "organizations fetch success",
+		Data:    organizations,
+	})
+}
+
+/*
+createOrganizationHandler creates an organization. When an admin is given, they are created in the
+new organization with the tenant-admin role and emailed a link to choose their password. The
+organization is deleted again when its admin can't be created, since nobody could manage it.
+*/
+func (app *application) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Slug  string `json:"slug"`
+		Name  string `json:"name"`
+		Admin *struct {
+			FirstName string `json:"firstname"`
+			LastName  string `json:"lastname"`
+			Username  string `json:"username"`
+			Email     string `json:"email"`
+		} `json:"admin"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	organization := &data.Organization{Slug: input.Slug, Name: input.Name}
+
+	var admin *data.User
+	if input.Admin != nil {
+		admin = &data.User{
+			FirstName: input.Admin.FirstName,
+			LastName:  input.Admin.LastName,
+			Username:  input.Admin.Username,
+			Email:     input.Admin.Email,
+			Active:    true,
+		}
+	}
+
+	v := validator.New()
+	data.ValidateOrganization(v, organization)
+	if admin != nil {
+		av := validator.New()
+		data.ValidateUser(av, admin)
+		for key, message := range av.Errors {
+			v.AddError("admin."+key, message)
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.Insert(organization)
+	if err != nil {
+		app.organizationSaveError(w, r, err)
+		return
+	}
+
+	if admin != nil {
+		err = app.createTenantAdmin(r, organization, admin)
+		if err != nil {
+			if err := app.models.Organizations.Delete(organization.ID); err != nil {
+				app.logError(r, err)
+			}
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Success: true,
+		Message: "organization created",
+		Data:    organization,
+	})
+}
+
+// createTenantAdmin adds the first admin of a new organization. The password is random, so the
+// admin signs in for the first time through the password reset email.
+func (app *application) createTenantAdmin(r *http.Request, organization *data.Organization, admin *data.User) error {
+	models := app.models.ForOrganization(organization.ID)
+
+	err := admin.Password.SetPlaceholder()
+	if err != nil {
+		return err
+	}
+
+	err = models.User.InsertUser(admin)
+	if err != nil {
+		return err
+	}
+
+	role, err := models.Roles.GetByName("tenant-admin")
+	if err != nil {
+		return err
+	}
+
+	err = models.Roles.AssignToUser(admin.ID, role.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.sendPasswordResetEmail(r, admin, "password_reset.html")
+}
+
+func (app *application) showOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.fetchOrganizationFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "organization fetch success",
+		Data:    organization,
+	})
+}
+
+func (app *application) updateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.fetchOrganizationFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Slug *string `json:"slug"`
+		Name *string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.Slug != nil {
+		organization.Slug = *input.Slug
+	}
+	if input.Name != nil {
+		organization.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateOrganization(v, organization); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.Update(organization)
+	if err != nil {
+		app.organizationSaveError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "organization update success",
+		Data:    organization,
+	})
+}
+
+func (app *application) deleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if id == data.DefaultOrganizationID {
+		app.JSONError(w, errors.New("the default organization can't be deleted"), http.StatusConflict)
+		return
+	}
+
+	err = app.models.Organizations.Delete(id)
+	if err != nil {
+		app.organizationSaveError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "organization deleted",
+	})
+}
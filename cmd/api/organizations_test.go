@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOrganizationValidatesAdmin(t *testing.T) {
+	app := &application{}
+
+	body := `{"slug": "acme", "name": "Acme", "admin": {"username": "jane", "email": "jane@acme.com"}}`
+	rr := httptest.NewRecorder()
+	app.createOrganizationHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/organizations", strings.NewReader(body)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+	if assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response)) {
+		assert.Contains(t, response.Error, "admin.firstname")
+		assert.Contains(t, response.Error, "admin.lastname")
+		assert.NotContains(t, response.Error, "admin.email")
+	}
+}
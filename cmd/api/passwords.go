@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/passwordhash"
+	"rabitech.auth.app/internal/passwordpolicy"
+)
+
+/*
+passwordHasher returns the hasher of the -password-hasher algorithm. It verifies the hashes of
+both algorithms, whichever hashes new passwords, so that switching doesn't lock anyone out, and
+the legacy hashes of imported users. Passwords are peppered when peppers are configured.
+*/
+func passwordHasher(cfg config) (*passwordhash.Hasher, error) {
+	h := cfg.hasher
+
+	if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("-bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if h.time < 1 || h.parallelism < 1 || h.parallelism > 255 || h.memory < 8*h.parallelism {
+		return nil, errors.New("-argon2-time must be at least 1, -argon2-parallelism between 1 and 255 and -argon2-memory at least 8 KiB per lane")
+	}
+
+	argon2id := passwordhash.DefaultArgon2id()
+	argon2id.Memory = uint32(h.memory)
+	argon2id.Time = uint32(h.time)
+	argon2id.Parallelism = uint8(h.parallelism)
+
+	bcryptHasher := passwordhash.Bcrypt{Cost: h.bcryptCost}
+
+	var hasher *passwordhash.Hasher
+	switch h.algorithm {
+	case "argon2id":
+		hasher = passwordhash.New(argon2id, append([]passwordhash.Verifier{bcryptHasher}, passwordhash.Legacy()...)...)
+	case "bcrypt":
+		hasher = passwordhash.New(bcryptHasher, append([]passwordhash.Verifier{argon2id}, passwordhash.Legacy()...)...)
+	default:
+		return nil, fmt.Errorf("invalid password hasher %q, must be argon2id or bcrypt", h.algorithm)
+	}
+
+	var peppers passwordhash.Peppers
+	var err error
+	switch {
+	case h.peppers != "" && h.pepperFile != "":
+		return nil, errors.New("only one of -password-peppers and -password-pepper-file can be set")
+	case h.pepperFile != "":
+		peppers, err = passwordhash.LoadPeppers(h.pepperFile)
+	case h.peppers != "":
+		peppers, err = passwordhash.ParsePeppers(h.peppers)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if h.pepper != 0 {
+		peppers.Current = h.pepper
+	}
+
+	return hasher.WithPeppers(peppers)
+}
+
+/*
+reportPepperRotation logs every interval a rotation report: how many password hashes each pepper
+was used for. It changes no hash; the pepper is applied before hashing, so a hash can only move to
+the current pepper at its user's next login, when the password is known. An old pepper can be
+removed once the report shows none are left.
+*/
+func (app *application) reportPepperRotation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			organizations, err := app.models.Organizations.GetAll()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			totals := map[int]int{}
+			for _, organization := range organizations {
+				counts, err := app.models.ForOrganization(organization.ID).User.CountByPepperVersion()
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					continue
+				}
+				for version, count := range counts {
+					totals[version] += count
+				}
+			}
+
+			properties := map[string]string{}
+			for version, count := range totals {
+				properties["pepper_"+strconv.Itoa(version)] = strconv.Itoa(count)
+			}
+			app.logger.PrintInfo("pepper rotation report", properties)
+		}
+	}()
+}
+
+/*
+passwordResult checks a new password of user against the password policy, the corpus of breached
+passwords and the user's previous passwords. Every path that sets a password chosen by someone
+goes through it.
+*/
+func (app *application) passwordResult(r *http.Request, password string, user *data.User) passwordpolicy.Result {
+	result := app.config.password.Check(password, user.Email, user.Username, user.FirstName, user.LastName)
+	if app.passwordBreached(r, password) {
+		result.Violations = append(result.Violations, breachViolation)
+	}
+	if app.passwordReused(r, user, password) {
+		result.Violations = append(result.Violations, passwordpolicy.Violation{
+			Code:    passwordpolicy.CodeReused,
+			Message: fmt.Sprintf("must not be one of your last %d passwords", app.config.rotation.history),
+		})
+	}
+	return result
+}
+
+// importPasswordCheck checks the plaintext passwords of imported users like passwordResult.
+func (app *application) importPasswordCheck(r *http.Request) data.PasswordCheck {
+	return func(password string, user *data.User) string {
+		return app.passwordResult(r, password, user).Message()
+	}
+}
+
+/*
+checkPassword checks a new password of user with passwordResult. Rejected passwords get a 422 response whose error names the broken rules and whose
+password_feedback lists them with the strength estimate, for forms to show next to the password field.
+*/
+func (app *application) checkPassword(w http.ResponseWriter, r *http.Request, password string, user *data.User) bool {
+	result := app.passwordResult(r, password, user)
+	if result.OK() {
+		return true
+	}
+
+	app.writeJSON(w, http.StatusUnprocessableEntity, envelope{
+		"error":             map[string]string{"password": result.Message()},
+		"password_feedback": result,
+	})
+	return false
+}
+
+/*
+passwordReused reports whether password is the current password of user or one of the previous
+ones the -password-history covers. New users have none. Like breach screening, passwords are let
+through when the history can't be read.
+*/
+func (app *application) passwordReused(r *http.Request, user *data.User, password string) bool {
+	if app.config.rotation.history <= 0 || user.ID == 0 {
+		return false
+	}
+
+	match, err := user.Password.MatchPassword(password)
+	if err == nil && match {
+		return true
+	}
+	if app.config.rotation.history == 1 {
+		return false
+	}
+
+	match, err = app.modelsFor(r).History.Matches(user.ID, password, app.config.rotation.history-1)
+	if err != nil {
+		app.logError(r, err)
+		return false
+	}
+	return match
+}
+
+// prunePasswordHistory drops the previous passwords of user the -password-history no longer covers.
+func (app *application) prunePasswordHistory(r *http.Request, user *data.User) {
+	keep := app.config.rotation.history - 1
+	if keep < 0 {
+		keep = 0
+	}
+
+	err := app.modelsFor(r).History.Prune(user.ID, keep)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+/*
+rehashPassword upgrades in the background the stored hash of a password that just matched at login,
+when it was made with an outdated algorithm or parameters.
+*/
+func (app *application) rehashPassword(r *http.Request, user *data.User, password string) {
+	models, rehashed := app.modelsFor(r), *user
+
+	app.background(func() {
+		err := models.User.RehashPassword(&rehashed, password)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+/*
+changePasswordHandler changes the password of the authenticated user, who must know the current
+one. Every other session of the user is signed out.
+*/
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user := app.ContextGetUser(r)
+
+	match, err := user.Password.MatchPassword(input.CurrentPassword)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !match {
+		app.failedValidationResponse(w, r, map[string]string{"current_password": "is incorrect"})
+		return
+	}
+
+	if !app.checkPassword(w, r, input.Password, user) {
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.prunePasswordHistory(r, user)
+
+	err = app.modelsFor(r).Tokens.DeleteOtherSessionsForUser(user.ID, app.requestToken(r))
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "password changed",
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/breach"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/passwordhash"
+	"rabitech.auth.app/internal/passwordpolicy"
+)
+
+func TestCheckPassword(t *testing.T) {
+	app := &application{config: config{password: passwordpolicy.Policy{MinLength: 8, MaxLength: 64, MinScore: 3}}}
+	user := &data.User{Email: "jkamau@example.com", Username: "jkamau", FirstName: "James", LastName: "Kamau"}
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+
+	w := httptest.NewRecorder()
+	assert.True(t, app.checkPassword(w, r, "Vq9!mLp2$Rtx", user))
+
+	w = httptest.NewRecorder()
+	assert.False(t, app.checkPassword(w, r, "kamau1", user))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var body struct {
+		Error    map[string]string     `json:"error"`
+		Feedback passwordpolicy.Result `json:"password_feedback"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.NotEmpty(t, body.Error["password"])
+
+	var codes []string
+	for _, v := range body.Feedback.Violations {
+		codes = append(codes, v.Code)
+	}
+	assert.Equal(t, []string{"too_short", "contains_personal_info", "too_weak"}, codes)
+	assert.NotEmpty(t, body.Feedback.Strength.Suggestions)
+}
+
+func TestCheckPasswordBreached(t *testing.T) {
+	bloom := breach.NewBloom(1, 0.001)
+	bloom.Add(breach.HashPassword("Vq9!mLp2$Rtx"))
+
+	app := &application{breached: bloom}
+	r := httptest.NewRequest(http.MethodPost, "/v1/users", nil)
+
+	w := httptest.NewRecorder()
+	assert.False(t, app.checkPassword(w, r, "Vq9!mLp2$Rtx", &data.User{}))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"code": "breached"`)
+
+	w = httptest.NewRecorder()
+	assert.True(t, app.checkPassword(w, r, "tidy pelican remembers mangoes", &data.User{}))
+}
+
+func TestPasswordHasher(t *testing.T) {
+	var cfg config
+	cfg.hasher.algorithm = "bcrypt"
+	cfg.hasher.memory, cfg.hasher.time, cfg.hasher.parallelism, cfg.hasher.bcryptCost = 64, 1, 1, 4
+
+	h, err := passwordHasher(cfg)
+	assert.NoError(t, err)
+
+	encoded, err := h.Hash("pa55word")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$2a$04$"), encoded)
+
+	// Switching to argon2id upgrades the bcrypt hashes at login.
+	cfg.hasher.algorithm = "argon2id"
+	h, err = passwordHasher(cfg)
+	assert.NoError(t, err)
+
+	match, err := h.Verify("pa55word", encoded)
+	assert.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, h.NeedsRehash(encoded))
+
+	cfg.hasher.algorithm = "md5"
+	_, err = passwordHasher(cfg)
+	assert.Error(t, err)
+
+	cfg.hasher.algorithm, cfg.hasher.bcryptCost = "bcrypt", 40
+	_, err = passwordHasher(cfg)
+	assert.Error(t, err)
+}
+
+func TestPasswordHasherPeppers(t *testing.T) {
+	var cfg config
+	cfg.hasher.algorithm, cfg.hasher.memory, cfg.hasher.time, cfg.hasher.parallelism, cfg.hasher.bcryptCost = "bcrypt", 64, 1, 1, 4
+
+	hasher, err := passwordHasher(cfg)
+	assert.NoError(t, err)
+	assert.False(t, hasher.Peppered())
+
+	cfg.hasher.peppers = "1:" + strings.Repeat("A", 44) + " 2:" + strings.Repeat("B", 44)
+	hasher, err = passwordHasher(cfg)
+	assert.NoError(t, err)
+	encoded, err := hasher.Hash("pa55word")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, passwordhash.PepperVersion(encoded))
+
+	cfg.hasher.pepper = 1
+	hasher, err = passwordHasher(cfg)
+	assert.NoError(t, err)
+	encoded, err = hasher.Hash("pa55word")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, passwordhash.PepperVersion(encoded))
+
+	cfg.hasher.pepperFile = "peppers"
+	_, err = passwordHasher(cfg)
+	assert.Error(t, err)
+}
+
+func TestPasswordMaxAge(t *testing.T) {
+	maxAges, err := parseMaxAges("admin=90, user-manager=180")
+	assert.NoError(t, err)
+
+	app := &application{}
+	app.config.rotation.maxAge = maxAges
+	assert.Equal(t, 90*24*time.Hour, app.passwordMaxAge([]string{"user-manager", "admin"}))
+	assert.Equal(t, 180*24*time.Hour, app.passwordMaxAge([]string{"user-manager", "auditor"}))
+	assert.Equal(t, time.Duration(0), app.passwordMaxAge([]string{"auditor"}))
+
+	for _, list := range []string{"admin", "admin=0", "=90", "admin=90d"} {
+		_, err := parseMaxAges(list)
+		assert.Error(t, err, list)
+	}
+}
+
+func TestCheckPasswordReused(t *testing.T) {
+	app := &application{config: config{password: passwordpolicy.Policy{MinLength: 8}}}
+	app.config.rotation.history = 1
+	user := &data.User{ID: 1, Email: "jkamau@example.com"}
+	assert.NoError(t, user.Password.Set("Vq9!mLp2$Rtx"))
+	r := httptest.NewRequest(http.MethodPut, "/v1/users/me/password", nil)
+
+	w := httptest.NewRecorder()
+	assert.False(t, app.checkPassword(w, r, "Vq9!mLp2$Rtx", user))
+	assert.Contains(t, w.Body.String(), `"code": "reused"`)
+
+	assert.True(t, app.checkPassword(httptest.NewRecorder(), r, "Wq9!mLp2$Rtx", user))
+}
+
+func TestCheckSCIMPassword(t *testing.T) {
+	app := &application{config: config{password: passwordpolicy.Policy{MinLength: 8}}}
+	user := &data.User{Email: "jkamau@example.com", Username: "jkamau"}
+	r := httptest.NewRequest(http.MethodPost, "/scim/v2/Users", nil)
+
+	assert.NoError(t, app.checkSCIMPassword(r, "tidy pelican remembers mangoes", user))
+
+	var requestError *scimRequestError
+	assert.ErrorAs(t, app.checkSCIMPassword(r, "short", user), &requestError)
+	assert.Equal(t, "invalidValue", requestError.scimType)
+	assert.Equal(t, "password must be at least 8 characters long", requestError.detail)
+}
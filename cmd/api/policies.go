@@ -0,0 +1,418 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/policy"
+)
+
+// fetchPolicyFromParam looks up the policy identified by the id url parameter and
+// writes the error response itself when the policy can't be loaded.
+func (app *application) fetchPolicyFromParam(w http.ResponseWriter, r *http.Request) (*policy.Policy, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	p, err := app.modelsFor(r).Policies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no policy found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return p, true
+}
+
+// savePolicy validates and inserts or updates a policy, writing the error response on failure.
+func (app *application) savePolicy(w http.ResponseWriter, r *http.Request, p *policy.Policy) bool {
+	err := p.Validate()
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"policy": err.Error()})
+		return false
+	}
+
+	for _, filePolicy := range app.policies {
+		if filePolicy.Name == p.Name {
+			app.failedValidationResponse(w, r, map[string]string{"name": "a policy file already uses this name"})
+			return false
+		}
+	}
+
+	if p.ID == 0 {
+		err = app.modelsFor(r).Policies.Insert(p)
+	} else {
+		err = app.modelsFor(r).Policies.Update(p)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorDuplicatePolicyName):
+			app.failedValidationResponse(w, r, map[string]string{"name": "a policy with this name already exists"})
+		case errors.Is(err, data.ErrorEditConflict):
+			app.JSONError(w, errors.New("the policy was changed by another request, please try again"), http.StatusConflict)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	return true
+}
+
+// listPoliciesHandler lists the policies of the organization followed by the policies loaded from files.
+func (app *application) listPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := app.modelsFor(r).Policies.GetAll()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "policies fetch success",
+		Data:    append(policies, app.policies...),
+	})
+}
+
+func (app *application) createPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Effect      string   `json:"effect"`
+		Actions     []string `json:"actions"`
+		Resources   []string `json:"resources"`
+		Condition   string   `json:"condition"`
+		Mode        string   `json:"mode"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	p := &policy.Policy{
+		Name:        input.Name,
+		Description: input.Description,
+		Effect:      input.Effect,
+		Actions:     input.Actions,
+		Resources:   input.Resources,
+		Condition:   input.Condition,
+		Mode:        input.Mode,
+	}
+
+	if !app.savePolicy(w, r, p) {
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Success: true,
+		Message: "policy created",
+		Data:    p,
+	})
+}
+
+func (app *application) showPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := app.fetchPolicyFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "policy fetch success",
+		Data:    p,
+	})
+}
+
+// updatePolicyHandler changes the given fields of a policy. Switching mode from dry_run to
+// enforce is how a tested policy change is rolled out.
+func (app *application) updatePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := app.fetchPolicyFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string  `json:"name"`
+		Description *string  `json:"description"`
+		Effect      *string  `json:"effect"`
+		Actions     []string `json:"actions"`
+		Resources   []string `json:"resources"`
+		Condition   *string  `json:"condition"`
+		Mode        *string  `json:"mode"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.Name != nil {
+		p.Name = *input.Name
+	}
+	if input.Description != nil {
+		p.Description = *input.Description
+	}
+	if input.Effect != nil {
+		p.Effect = *input.Effect
+	}
+	if input.Actions != nil {
+		p.Actions = input.Actions
+	}
+	if input.Resources != nil {
+		p.Resources = input.Resources
+	}
+	if input.Condition != nil {
+		p.Condition = *input.Condition
+	}
+	if input.Mode != nil {
+		p.Mode = *input.Mode
+	}
+
+	if !app.savePolicy(w, r, p) {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "policy update success",
+		Data:    p,
+	})
+}
+
+func (app *application) deletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.modelsFor(r).Policies.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no policy found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "policy deleted",
+	})
+}
+
+func (app *application) showUserAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	attributes, err := app.modelsFor(r).User.GetAttributes(user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user attributes fetch success",
+		Data:    attributes,
+	})
+}
+
+// setUserAttributesHandler replaces the attributes of a user with the JSON object in the body.
+func (app *application) setUserAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var attributes map[string]interface{}
+
+	err := app.readJSON(w, r, &attributes)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+
+	err = app.modelsFor(r).User.SetAttributes(user.ID, attributes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no user found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user attributes update success",
+		Data:    attributes,
+	})
+}
+
+// userPolicyAttributes returns the attributes policy conditions see for a user.
+func (app *application) userPolicyAttributes(r *http.Request, user *data.User) (map[string]interface{}, error) {
+	err := app.loadUserAccess(r, user)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := app.modelsFor(r).User.GetAttributes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":              user.ID,
+		"username":        user.Username,
+		"email":           user.Email,
+		"firstname":       user.FirstName,
+		"lastname":        user.LastName,
+		"active":          user.Active,
+		"organization_id": user.OrganizationID,
+		"roles":           user.Roles,
+		"permissions":     []string(user.Permissions),
+		"groups":          user.Groups,
+		"attributes":      attributes,
+	}, nil
+}
+
+/*
+evaluatePolicyHandler decides whether a subject may perform an action on a resource. The subject
+defaults to the authenticated user. For resources of type user the attributes of that user are
+loaded, and they take precedence over attributes given in the request.
+*/
+func (app *application) evaluatePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Action    string `json:"action"`
+		SubjectID int64  `json:"subject_id"`
+		Resource  struct {
+			Type       string                 `json:"type"`
+			ID         string                 `json:"id"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"resource"`
+		Context map[string]interface{} `json:"context"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.Action == "" || input.Resource.Type == "" {
+		app.failedValidationResponse(w, r, map[string]string{"action": "action and resource.type must be provided"})
+		return
+	}
+
+	subjectUser := app.ContextGetUser(r)
+	if input.SubjectID != 0 && input.SubjectID != subjectUser.ID {
+		subjectUser, err = app.modelsFor(r).User.GetUserByID(input.SubjectID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrorRecordNotFound):
+				app.failedValidationResponse(w, r, map[string]string{"subject_id": "no user with this id exists"})
+			default:
+				app.JSONError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	subject, err := app.userPolicyAttributes(r, subjectUser)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resource := map[string]interface{}{"type": input.Resource.Type, "id": input.Resource.ID, "attributes": input.Resource.Attributes}
+
+	if userID, err := strconv.ParseInt(input.Resource.ID, 10, 64); err == nil && input.Resource.Type == "user" {
+		resourceUser, err := app.modelsFor(r).User.GetUserByID(userID)
+		if err == nil {
+			resource, err = app.userPolicyAttributes(r, resourceUser)
+		}
+		if err != nil && !errors.Is(err, data.ErrorRecordNotFound) {
+			app.JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		resource["type"] = input.Resource.Type
+	}
+
+	policies, err := app.modelsFor(r).Policies.GetAll()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	policyInput := policy.Input{
+		Action:   input.Action,
+		Subject:  subject,
+		Resource: resource,
+		Context:  input.Context,
+		Env:      policy.Env(time.Now().In(app.config.policy.location), app.clientIP(r)),
+	}
+
+	decision := policy.Evaluate(append(policies, app.policies...), policyInput)
+
+	app.logDecision(r, subjectUser, policyInput, decision)
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "policy evaluation success",
+		Data:    decision,
+	})
+}
+
+// logDecision writes a policy decision to the log, noting when dry-run policies would have decided differently.
+func (app *application) logDecision(r *http.Request, subject *data.User, input policy.Input, decision *policy.Decision) {
+	properties := map[string]string{
+		"organization":  app.ContextGetOrganization(r).Slug,
+		"action":        input.Action,
+		"subject_id":    strconv.FormatInt(subject.ID, 10),
+		"resource_type": fmt.Sprint(input.Resource["type"]),
+		"allowed":       strconv.FormatBool(decision.Allowed),
+		"reason":        decision.Reason,
+		"policies":      strings.Join(decision.Policies, ","),
+	}
+
+	if id := input.Resource["id"]; id != nil && id != "" {
+		properties["resource_id"] = fmt.Sprint(id)
+	}
+
+	if len(decision.Errors) > 0 {
+		properties["errors"] = strings.Join(decision.Errors, "; ")
+	}
+
+	if decision.DryRun != nil {
+		properties["dry_run_allowed"] = strconv.FormatBool(decision.DryRun.Allowed)
+		properties["dry_run_policies"] = strings.Join(decision.DryRun.Policies, ",")
+	}
+
+	app.logger.PrintInfo("policy decision", properties)
+}
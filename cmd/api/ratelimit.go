@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rabitech.auth.app/internal/ratelimit"
+)
+
+// rateLimitKey returns the key a request is counted by, or false for requests the limit doesn't apply to.
+type rateLimitKey func(r *http.Request) (string, bool)
+
+// byIP counts requests per client IP address.
+func (app *application) byIP(r *http.Request) (string, bool) {
+	return "ip:" + app.clientIP(r), true
+}
+
+// byUser counts requests per authenticated user, and anonymous ones per client IP address.
+func (app *application) byUser(r *http.Request) (string, bool) {
+	user := app.ContextGetUser(r)
+	if user.IsAnonymus() {
+		return app.byIP(r)
+	}
+	return "user:" + strconv.FormatInt(user.ID, 10), true
+}
+
+/*
+byEmail counts requests per email field of the JSON body, e.g. logins per account whatever address
+they come from. The body is put back for the handler. Requests without an email aren't counted.
+*/
+func (app *application) byEmail(r *http.Request) (string, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1_048_576))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return "", false
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if json.Unmarshal(body, &input) != nil || input.Email == "" {
+		return "", false
+	}
+
+	organization := app.ContextGetOrganization(r)
+	return "email:" + strconv.FormatInt(organization.ID, 10) + ":" + strings.ToLower(strings.TrimSpace(input.Email)), true
+}
+
+/*
+setRateLimitHeaders sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+When several limits apply to a route the one with the fewest remaining requests is shown.
+*/
+func setRateLimitHeaders(h http.Header, result ratelimit.Result) {
+	if remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && remaining <= result.Remaining {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(int((result.Reset+time.Second-1)/time.Second)))
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+/*
+rateLimit allows limit requests of the route name per key into next. Routes sharing a name share
+their buckets. Requests are let through when the store fails, so that an outage of the store
+doesn't take logins down with it.
+*/
+func (app *application) rateLimit(name string, limit ratelimit.Limit, key rateLimitKey, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		k, ok := key(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		result, err := app.limiter.Take(r.Context(), name+":"+k, limit)
+		if err != nil {
+			app.logError(r, err)
+			next(w, r)
+			return
+		}
+
+		setRateLimitHeaders(w.Header(), result)
+
+		if !result.Allowed {
+			app.rateLimitExceededResponse(w, r, result.RetryAfter)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// cleanRateLimits drops the full buckets of the Postgres store every interval.
+func (app *application) cleanRateLimits(store ratelimit.PostgresStore, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			_, err := store.DeleteFull(context.Background())
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/ratelimit"
+)
+
+func TestClientIP(t *testing.T) {
+	app := &application{}
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	app.config.proxies.trusted = []*net.IPNet{proxies}
+
+	for _, tt := range []struct {
+		remoteAddr, forwardedFor, want string
+	}{
+		{"203.0.113.7:5000", "", "203.0.113.7"},
+		{"203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.2:5000", "1.2.3.4, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"10.0.0.2:5000", "garbage, 10.0.0.3", "10.0.0.3"},
+		{"10.0.0.2:5000", "", "10.0.0.2"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		assert.Equal(t, tt.want, app.clientIP(r), tt)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	app := &application{limiter: ratelimit.NewMemoryStore()}
+
+	handler := app.rateLimit("login", ratelimit.PerMinute(5), app.byIP, app.rateLimit("login", ratelimit.PerMinute(2), app.byEmail, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"email": "A@example.com"}`, string(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/v1/token/authenticate", strings.NewReader(`{"email": "A@example.com"}`))
+		r = app.ContextSetOrganization(r, &data.Organization{ID: 1})
+
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		codes = append(codes, rr.Code)
+
+		if i == 1 {
+			assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+		}
+		if i == 2 {
+			assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+		}
+	}
+
+	assert.Equal(t, []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests}, codes)
+}
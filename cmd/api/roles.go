@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/validator"
+)
+
+// errorBuiltInRoleGrant is returned for assignments of built-in roles by users without organizations:manage.
+var errorBuiltInRoleGrant = errors.New("only users with the organizations:manage permission can assign built-in roles")
+
+/*
+grantError returns why a user holding the permissions held can't grant the permissions of a role,
+or nil when they can. Nobody can grant a permission they don't hold themselves, so that roles:write
+can't be used to escalate privileges, and built-in roles, which are shared by every organization,
+can only be assigned by holders of organizations:manage.
+*/
+func grantError(held, permissions data.Permissions, builtIn bool) error {
+	if builtIn && !held.Include(data.PermissionOrganizationsManage) {
+		return errorBuiltInRoleGrant
+	}
+
+	for _, code := range permissions {
+		if !held.Include(code) {
+			return fmt.Errorf("you can't grant the %s permission, which you don't hold", code)
+		}
+	}
+	return nil
+}
+
+// checkGrant checks with grantError that the user of the request can grant the permissions. It writes the 403 response itself.
+func (app *application) checkGrant(w http.ResponseWriter, r *http.Request, permissions data.Permissions, builtIn bool) bool {
+	held, err := app.modelsFor(r).Permissions.GetAllForUser(app.ContextGetUser(r).ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return false
+	}
+
+	err = grantError(held, permissions, builtIn)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusForbidden, err.Error())
+		return false
+	}
+	return true
+}
+
+/*
+bootstrapAdmins assigns the built-in admin role to the users of the default organization with the
+emails of -admin-emails, so that a new deployment has someone to manage it.
+*/
+func (app *application) bootstrapAdmins(emails []string) error {
+	role, err := app.models.Roles.GetByName("admin")
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		user, err := app.models.User.GetUserByEmail(email)
+		if err != nil {
+			if errors.Is(err, data.ErrorRecordNotFound) {
+				app.logger.PrintError(errors.New("no user with an -admin-emails email exists"), map[string]string{"email": email})
+				continue
+			}
+			return err
+		}
+
+		err = app.models.Roles.AssignToUser(user.ID, role.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadUserAccess fills in the roles, effective permissions and groups of user so they can be returned to the client.
+func (app *application) loadUserAccess(r *http.Request, user *data.User) error {
+	roles, err := app.modelsFor(r).Roles.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.Roles = make([]string, 0, len(roles))
+	for _, role := range roles {
+		user.Roles = append(user.Roles, role.Name)
+	}
+
+	user.Permissions, err = app.modelsFor(r).Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.Groups, err = app.modelsFor(r).Groups.GetNamesForUser(user.ID)
+	return err
+}
+
+// fetchRoleFromParam looks up the role identified by the id url parameter and
+// writes the error response itself when the role can't be loaded.
+func (app *application) fetchRoleFromParam(w http.ResponseWriter, r *http.Request) (*data.Role, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	role, err := app.modelsFor(r).Roles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no role found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return role, true
+}
+
+// roleSaveError writes the error response for a failed role insert or update.
+func (app *application) roleSaveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrorDuplicateRoleName):
+		app.failedValidationResponse(w, r, map[string]string{"name": "a role with this name already exists"})
+	case errors.Is(err, data.ErrorUnknownPermission):
+		app.failedValidationResponse(w, r, map[string]string{"permissions": "must only contain existing permission codes"})
+	case errors.Is(err, data.ErrorBuiltInRole):
+		app.JSONError(w, err, http.StatusConflict)
+	case errors.Is(err, data.ErrorRecordNotFound):
+		app.JSONError(w, errors.New("no role found with such id"), http.StatusNotFound)
+	default:
+		app.JSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.modelsFor(r).Permissions.GetAll()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "permissions fetch success",
+		Data:    permissions,
+	})
+}
+
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.modelsFor(r).Roles.GetAll()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "roles fetch success",
+		Data:    roles,
+	})
+}
+
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string           `json:"name"`
+		Description string           `json:"description"`
+		Permissions data.Permissions `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	role := &data.Role{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+	if role.Permissions == nil {
+		role.Permissions = data.Permissions{}
+	}
+
+	v := validator.New()
+	if data.ValidateRole(v, role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkGrant(w, r, role.Permissions, false) {
+		return
+	}
+
+	err = app.modelsFor(r).Roles.Insert(role)
+	if err != nil {
+		app.roleSaveError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Success: true,
+		Message: "role created",
+		Data:    role,
+	})
+}
+
+func (app *application) showRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role, ok := app.fetchRoleFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "role fetch success",
+		Data:    role,
+	})
+}
+
+func (app *application) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role, ok := app.fetchRoleFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string           `json:"name"`
+		Description *string           `json:"description"`
+		Permissions *data.Permissions `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.Name != nil {
+		role.Name = *input.Name
+	}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if input.Permissions != nil {
+		role.Permissions = *input.Permissions
+	}
+
+	v := validator.New()
+	if data.ValidateRole(v, role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Permissions != nil && !app.checkGrant(w, r, role.Permissions, false) {
+		return
+	}
+
+	err = app.modelsFor(r).Roles.Update(role)
+	if err != nil {
+		app.roleSaveError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "role update success",
+		Data:    role,
+	})
+}
+
+func (app *application) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role, ok := app.fetchRoleFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	if role.BuiltIn {
+		app.JSONError(w, data.ErrorBuiltInRole, http.StatusConflict)
+		return
+	}
+
+	err := app.modelsFor(r).Roles.Delete(role.ID)
+	if err != nil {
+		app.roleSaveError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "role deleted",
+	})
+}
+
+func (app *application) listUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.loadUserAccess(r, user)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "user roles fetch success",
+		Data:    envelope{"roles": user.Roles, "permissions": user.Permissions, "groups": user.Groups},
+	})
+}
+
+func (app *application) assignUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.Role == "" {
+		app.failedValidationResponse(w, r, map[string]string{"role": "must be provided"})
+		return
+	}
+
+	role, err := app.modelsFor(r).Roles.GetByName(input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"role": "no role with this name exists"})
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !app.checkGrant(w, r, role.Permissions, role.BuiltIn) {
+		return
+	}
+
+	err = app.modelsFor(r).Roles.AssignToUser(user.ID, role.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserRoleAssigned, user.ID, map[string]interface{}{"role": role.Name})
+
+	app.listUserRolesHandler(w, r)
+}
+
+func (app *application) removeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	role, err := app.modelsFor(r).Roles.GetByName(name)
+	if err == nil {
+		err = app.modelsFor(r).Roles.RemoveFromUser(user.ID, role.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("the role isn't assigned directly to the user"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.recordAudit(r, data.AuditUserRoleRemoved, user.ID, map[string]interface{}{"role": role.Name})
+
+	app.listUserRolesHandler(w, r)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/data"
+)
+
+func TestGrantError(t *testing.T) {
+	manager := data.Permissions{data.PermissionUsersRead, data.PermissionUsersWrite, data.PermissionRolesWrite}
+	admin := append(data.Permissions{data.PermissionOrganizationsManage, data.PermissionUsersDelete}, manager...)
+
+	assert.NoError(t, grantError(manager, data.Permissions{data.PermissionUsersRead}, false))
+
+	// Built-in roles such as admin need organizations:manage.
+	assert.ErrorIs(t, grantError(manager, data.Permissions{data.PermissionUsersRead}, true), errorBuiltInRoleGrant)
+	assert.NoError(t, grantError(admin, data.Permissions{data.PermissionUsersRead}, true))
+
+	// Custom roles can't carry permissions the granting user doesn't hold.
+	err := grantError(manager, data.Permissions{data.PermissionUsersRead, data.PermissionUsersDelete}, false)
+	assert.EqualError(t, err, "you can't grant the users:delete permission, which you don't hold")
+	assert.NoError(t, grantError(admin, data.Permissions{data.PermissionUsersDelete}, false))
+}
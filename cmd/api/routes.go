@@ -5,20 +5,130 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/ratelimit"
 )
 
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
+	// Logins are limited per address and per account, token and cookie logins sharing the buckets.
+	limitLogin := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.rateLimit("login", ratelimit.PerMinute(30), app.byIP, app.rateLimit("login", ratelimit.PerMinute(10), app.byEmail, next))
+	}
+
 	router.HandlerFunc(http.MethodGet, "/", app.requireActivatedUser(app.status))
 	router.HandlerFunc(http.MethodPost, "/api/v1/user", app.fetchUserHandler)
 	// router.HandlerFunc(http.MethodPost, "/api/v1/user", app.requireActivatedUser(app.fetchUserHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/users", app.requireAdminUser(app.listUsersHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/token/authenticate", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users", app.requirePermission(data.PermissionUsersRead, app.listUsersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.rateLimit("register", ratelimit.PerHour(20), app.byIP, app.registerUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/activated", app.rateLimit("activate", ratelimit.PerMinute(10), app.byIP, app.activateUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/unlocked", app.rateLimit("unlock", ratelimit.PerMinute(10), app.byIP, app.unlockUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/token/authenticate", limitLogin(app.createAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/sessions", limitLogin(app.createSessionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/sessions", app.requireAuthenticatedUser(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.rateLimit("password-reset", ratelimit.PerMinute(10), app.byIP, app.resetUserPasswordHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/password/expired", app.rateLimit("password-expired", ratelimit.PerMinute(10), app.byIP, app.changeExpiredPasswordHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireActivatedUser(app.rateLimit("password-change", ratelimit.PerMinute(10), app.byUser, app.changePasswordHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireActivatedUser(app.listMySessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireActivatedUser(app.deleteMySessionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.staticOrID(map[string]http.HandlerFunc{
+		"search": app.requirePermission(data.PermissionUsersRead, app.searchUsersHandler),
+		"export": app.requirePermission(data.PermissionUsersExport, app.rateLimit("export", ratelimit.PerMinute(5), app.byUser, app.exportUsersHandler)),
+	}, app.requirePermission(data.PermissionUsersRead, app.showUserHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id", app.staticOrID(map[string]http.HandlerFunc{
+		"import": app.requirePermission(data.PermissionUsersImport, app.rateLimit("import", ratelimit.PerHour(20), app.byUser, app.importUsersHandler)),
+		"export": app.requirePermission(data.PermissionUsersExport, app.rateLimit("export", ratelimit.PerMinute(5), app.byUser, app.createExportJobHandler)),
+	}, app.notFoundResponse))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/users/:id", app.requirePermission(data.PermissionUsersWrite, app.updateUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id", app.requirePermission(data.PermissionUsersDelete, app.deleteUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activate", app.requirePermission(data.PermissionUsersWrite, app.adminActivateUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/deactivate", app.requirePermission(data.PermissionUsersWrite, app.adminDeactivateUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/lockout", app.requirePermission(data.PermissionUsersRead, app.showUserLockoutHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/lockout", app.requirePermission(data.PermissionUsersWrite, app.adminUnlockUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission(data.PermissionUsersWrite, app.forcePasswordResetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/tokens", app.requirePermission(data.PermissionUsersWrite, app.revokeUserTokensHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/sessions", app.requirePermission(data.PermissionUsersRead, app.listUserSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/sessions/:session_id", app.requirePermission(data.PermissionUsersWrite, app.deleteUserSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/audit", app.requirePermission(data.PermissionAuditRead, app.listUserAuditHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/roles", app.requirePermission(data.PermissionRolesRead, app.listUserRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission(data.PermissionRolesWrite, app.assignUserRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermission(data.PermissionRolesWrite, app.removeUserRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/attributes", app.requirePermission(data.PermissionUsersRead, app.showUserAttributesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/attributes", app.requirePermission(data.PermissionPoliciesWrite, app.setUserAttributesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission(data.PermissionRolesRead, app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/roles", app.requirePermission(data.PermissionRolesWrite, app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles/:id", app.requirePermission(data.PermissionRolesRead, app.showRoleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/roles/:id", app.requirePermission(data.PermissionRolesWrite, app.updateRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/roles/:id", app.requirePermission(data.PermissionRolesWrite, app.deleteRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions", app.requirePermission(data.PermissionRolesRead, app.listPermissionsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/groups", app.requirePermission(data.PermissionGroupsRead, app.listGroupsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups", app.requirePermission(data.PermissionGroupsWrite, app.createGroupHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/groups/:id", app.requirePermission(data.PermissionGroupsRead, app.showGroupHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/groups/:id", app.requirePermission(data.PermissionGroupsWrite, app.updateGroupHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id", app.requirePermission(data.PermissionGroupsWrite, app.deleteGroupHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/groups/:id/members", app.requirePermission(data.PermissionGroupsRead, app.listGroupMembersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups/:id/members", app.requirePermission(data.PermissionGroupsWrite, app.addGroupMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id/members/:user_id", app.requirePermission(data.PermissionGroupsWrite, app.removeGroupMemberHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups/:id/groups", app.requirePermission(data.PermissionGroupsWrite, app.addSubgroupHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id/groups/:group_id", app.requirePermission(data.PermissionGroupsWrite, app.removeSubgroupHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups/:id/roles", app.requirePermission(data.PermissionRolesWrite, app.assignGroupRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id/roles/:role", app.requirePermission(data.PermissionRolesWrite, app.removeGroupRoleHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/scim/clients", app.requirePermission(data.PermissionSCIMManage, app.createSCIMClientHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/scim/clients", app.requirePermission(data.PermissionSCIMManage, app.listSCIMClientsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/scim/clients/:id", app.requirePermission(data.PermissionSCIMManage, app.deleteSCIMClientHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/organizations", app.requireDefaultOrganization(app.requirePermission(data.PermissionOrganizationsManage, app.listOrganizationsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/organizations", app.requireDefaultOrganization(app.requirePermission(data.PermissionOrganizationsManage, app.createOrganizationHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/organizations/:id", app.requireDefaultOrganization(app.requirePermission(data.PermissionOrganizationsManage, app.showOrganizationHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/organizations/:id", app.requireDefaultOrganization(app.requirePermission(data.PermissionOrganizationsManage, app.updateOrganizationHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/organizations/:id", app.requireDefaultOrganization(app.requirePermission(data.PermissionOrganizationsManage, app.deleteOrganizationHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/authz/check", app.requirePermission(data.PermissionAuthzCheck, app.checkRelationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/authz/expand", app.requirePermission(data.PermissionAuthzCheck, app.expandRelationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authz/tuples", app.requirePermission(data.PermissionAuthzCheck, app.listRelationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/authz/tuples", app.requirePermission(data.PermissionAuthzWrite, app.writeRelationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authz/namespaces", app.requirePermission(data.PermissionAuthzCheck, app.listNamespacesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/authz/namespaces/:name", app.requirePermission(data.PermissionAuthzWrite, app.putNamespaceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/authz/namespaces/:name", app.requirePermission(data.PermissionAuthzWrite, app.deleteNamespaceHandler))
+
+	for _, method := range forwardAuthMethods {
+		router.HandlerFunc(method, forwardAuthPath, app.forwardAuthHandler)
+	}
+
+	router.HandlerFunc(http.MethodPost, "/v1/authz/evaluate", app.requirePermission(data.PermissionAuthzCheck, app.evaluatePolicyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/policies", app.requirePermission(data.PermissionPoliciesRead, app.listPoliciesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/policies", app.requirePermission(data.PermissionPoliciesWrite, app.createPolicyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/policies/:id", app.requirePermission(data.PermissionPoliciesRead, app.showPolicyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/policies/:id", app.requirePermission(data.PermissionPoliciesWrite, app.updatePolicyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/policies/:id", app.requirePermission(data.PermissionPoliciesWrite, app.deletePolicyHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	return app.metrics(app.recoverPanic(app.enableCORS(app.authenticate(router))))
+	// SCIM clients authenticate with their own bearer tokens, so the SCIM API sits outside app.authenticate.
+	mux := http.NewServeMux()
+	mux.Handle(scimPrefix+"/", app.scimRoutes())
+	mux.Handle("/", app.authenticate(router))
+
+	return app.metrics(app.recoverPanic(app.enableCORS(app.resolveTenant(mux))))
+}
+
+// staticOrID lets static paths such as /v1/admin/users/search live next to
+// /v1/admin/users/:id, which httprouter refuses to register as separate routes.
+// Requests whose :id segment matches a key in static are sent to that handler.
+func (app *application) staticOrID(static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+		if handler, ok := static[name]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
 }
@@ -0,0 +1,1285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/scim"
+	"rabitech.auth.app/internal/validator"
+)
+
+// scimPrefix is the path the SCIM API is served under.
+const scimPrefix = "/scim/v2"
+
+// scimUserColumns maps the filterable SCIM user attributes onto auth_user columns.
+var scimUserColumns = scim.Columns{
+	"id":                {SQL: "id", Type: scim.ColumnID},
+	"externalid":        {SQL: "external_id", Type: scim.ColumnCaseExactString},
+	"username":          {SQL: "username", Type: scim.ColumnString},
+	"name.givenname":    {SQL: "firstname", Type: scim.ColumnString},
+	"name.familyname":   {SQL: "lastname", Type: scim.ColumnString},
+	"displayname":       {SQL: "(firstname || ' ' || lastname)", Type: scim.ColumnString},
+	"emails":            {SQL: "email", Type: scim.ColumnString},
+	"emails.value":      {SQL: "email", Type: scim.ColumnString},
+	"active":            {SQL: "active", Type: scim.ColumnBool},
+	"meta.created":      {SQL: "CreatedAt", Type: scim.ColumnTime},
+	"meta.lastmodified": {SQL: "UpdatedAt", Type: scim.ColumnTime},
+}
+
+// scimGroupColumns maps the filterable SCIM group attributes onto groups columns.
+var scimGroupColumns = scim.Columns{
+	"id":                {SQL: "id", Type: scim.ColumnID},
+	"externalid":        {SQL: "external_id", Type: scim.ColumnCaseExactString},
+	"displayname":       {SQL: "display_name", Type: scim.ColumnString},
+	"meta.created":      {SQL: "CreatedAt", Type: scim.ColumnTime},
+	"meta.lastmodified": {SQL: "UpdatedAt", Type: scim.ColumnTime},
+}
+
+// scimRequestError is an error that maps onto a SCIM error response.
+type scimRequestError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimRequestError) Error() string {
+	return e.detail
+}
+
+func badSCIMRequest(scimType, format string, args ...interface{}) error {
+	return &scimRequestError{status: http.StatusBadRequest, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+func (app *application) scimRoutes() http.Handler {
+	router := httprouter.New()
+
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.scimErrorResponse(w, r, http.StatusNotFound, "", "the requested resource could not be found")
+	})
+
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/ServiceProviderConfig", app.scimServiceProviderConfigHandler)
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/Schemas", app.scimSchemasHandler)
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/Schemas/:id", app.scimSchemasHandler)
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/ResourceTypes", app.scimResourceTypesHandler)
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/ResourceTypes/:id", app.scimResourceTypesHandler)
+
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/Users", app.requireSCIMClient(app.scimListUsersHandler))
+	router.HandlerFunc(http.MethodPost, scimPrefix+"/Users", app.requireSCIMClient(app.scimCreateUserHandler))
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/Users/:id", app.requireSCIMClient(app.scimShowUserHandler))
+	router.HandlerFunc(http.MethodPut, scimPrefix+"/Users/:id", app.requireSCIMClient(app.scimReplaceUserHandler))
+	router.HandlerFunc(http.MethodPatch, scimPrefix+"/Users/:id", app.requireSCIMClient(app.scimPatchUserHandler))
+	router.HandlerFunc(http.MethodDelete, scimPrefix+"/Users/:id", app.requireSCIMClient(app.scimDeleteUserHandler))
+
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/Groups", app.requireSCIMClient(app.scimListGroupsHandler))
+	router.HandlerFunc(http.MethodPost, scimPrefix+"/Groups", app.requireSCIMClient(app.scimCreateGroupHandler))
+	router.HandlerFunc(http.MethodGet, scimPrefix+"/Groups/:id", app.requireSCIMClient(app.scimShowGroupHandler))
+	router.HandlerFunc(http.MethodPut, scimPrefix+"/Groups/:id", app.requireSCIMClient(app.scimReplaceGroupHandler))
+	router.HandlerFunc(http.MethodPatch, scimPrefix+"/Groups/:id", app.requireSCIMClient(app.scimPatchGroupHandler))
+	router.HandlerFunc(http.MethodDelete, scimPrefix+"/Groups/:id", app.requireSCIMClient(app.scimDeleteGroupHandler))
+
+	return router
+}
+
+// requireSCIMClient authenticates the request with a SCIM client bearer token.
+func (app *application) requireSCIMClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		headerParts := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.scimErrorResponse(w, r, http.StatusUnauthorized, "", "invalid or missing authentication token")
+			return
+		}
+
+		_, err := app.modelsFor(r).SCIMClients.GetForToken(headerParts[1])
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrorRecordNotFound):
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				app.scimErrorResponse(w, r, http.StatusUnauthorized, "", "invalid or missing authentication token")
+			default:
+				app.scimServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (app *application) writeSCIM(w http.ResponseWriter, status int, v interface{}) {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", scim.ContentType)
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+func (app *application) scimErrorResponse(w http.ResponseWriter, r *http.Request, status int, scimType, detail string) {
+	app.writeSCIM(w, status, scim.NewError(status, scimType, detail))
+}
+
+func (app *application) scimServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	app.scimErrorResponse(w, r, http.StatusInternalServerError, "", "the server encountered a problem and could not process your request")
+}
+
+// scimRequestErrorResponse writes err as a SCIM error, treating anything other than a *scimRequestError as a server error.
+func (app *application) scimRequestErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var requestError *scimRequestError
+	if errors.As(err, &requestError) {
+		app.scimErrorResponse(w, r, requestError.status, requestError.scimType, requestError.detail)
+		return
+	}
+
+	app.scimServerErrorResponse(w, r, err)
+}
+
+// readSCIM decodes a SCIM request body. Unknown attributes are allowed since clients send extension schemas.
+func (app *application) readSCIM(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err != nil {
+		return badSCIMRequest("invalidSyntax", "request body could not be parsed: %s", err)
+	}
+
+	return nil
+}
+
+func scimBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + scimPrefix
+}
+
+// checkIfMatch enforces the If-Match header against the current resource version.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == scim.ETag(version) {
+			return true
+		}
+	}
+
+	app.scimErrorResponse(w, r, http.StatusPreconditionFailed, "", "resource has been modified")
+	return false
+}
+
+// readSCIMPage reads the startIndex and count query parameters. startIndex is 1-based.
+func (app *application) readSCIMPage(r *http.Request) (int, int, error) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	startIndex := app.readInt(qs, "startIndex", 1, v)
+	count := app.readInt(qs, "count", 100, v)
+
+	if !v.Valid() {
+		return 0, 0, badSCIMRequest("invalidValue", "startIndex and count must be integers")
+	}
+
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scim.MaxResults {
+		count = scim.MaxResults
+	}
+
+	return startIndex, count, nil
+}
+
+// readSCIMFilter translates the filter query parameter into an SQL condition.
+func (app *application) readSCIMFilter(r *http.Request, columns scim.Columns) (string, []interface{}, error) {
+	filter := r.URL.Query().Get("filter")
+	if filter == "" {
+		return "", nil, nil
+	}
+
+	expr, err := scim.ParseFilter(filter)
+	if err != nil {
+		return "", nil, badSCIMRequest("invalidFilter", "%s", err)
+	}
+
+	var args []interface{}
+
+	where, err := scim.ToSQL(expr, columns, &args)
+	if err != nil {
+		return "", nil, badSCIMRequest("invalidFilter", "%s", err)
+	}
+
+	return where, args, nil
+}
+
+// readSCIMID reads the numeric id url parameter; resources with other ids can't exist.
+func (app *application) readSCIMID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.scimErrorResponse(w, r, http.StatusNotFound, "", "resource not found")
+		return 0, false
+	}
+	return id, true
+}
+
+func (app *application) scimServiceProviderConfigHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeSCIM(w, http.StatusOK, scim.ServiceProviderConfig(scimBaseURL(r)))
+}
+
+func (app *application) scimSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	schemas := scim.Schemas(scimBaseURL(r))
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
+		app.writeSCIM(w, http.StatusOK, scim.NewListResponse(schemas, len(schemas), len(schemas), 1))
+		return
+	}
+
+	for _, schema := range schemas {
+		if schema["id"] == id {
+			app.writeSCIM(w, http.StatusOK, schema)
+			return
+		}
+	}
+
+	app.scimErrorResponse(w, r, http.StatusNotFound, "", "schema not found")
+}
+
+func (app *application) scimResourceTypesHandler(w http.ResponseWriter, r *http.Request) {
+	resourceTypes := scim.ResourceTypes(scimBaseURL(r))
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
+		app.writeSCIM(w, http.StatusOK, scim.NewListResponse(resourceTypes, len(resourceTypes), len(resourceTypes), 1))
+		return
+	}
+
+	for _, resourceType := range resourceTypes {
+		if resourceType["id"] == id {
+			app.writeSCIM(w, http.StatusOK, resourceType)
+			return
+		}
+	}
+
+	app.scimErrorResponse(w, r, http.StatusNotFound, "", "resource type not found")
+}
+
+// ---- Users ----
+
+func scimUserFromUser(r *http.Request, user *data.User) scim.User {
+	active := user.Active
+	location := fmt.Sprintf("%s/Users/%d", scimBaseURL(r), user.ID)
+
+	return scim.User{
+		Schemas:    []string{scim.UserSchema},
+		ID:         strconv.FormatInt(user.ID, 10),
+		ExternalID: user.ExternalID,
+		UserName:   user.Username,
+		Name: &scim.Name{
+			Formatted:  strings.TrimSpace(user.FirstName + " " + user.LastName),
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Emails:      []scim.MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     location,
+			Version:      scim.ETag(user.Version),
+		},
+	}
+}
+
+func (app *application) writeSCIMUser(w http.ResponseWriter, r *http.Request, status int, user *data.User) {
+	resource := scimUserFromUser(r, user)
+
+	w.Header().Set("ETag", resource.Meta.Version)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", resource.Meta.Location)
+	}
+
+	app.writeSCIM(w, status, resource)
+}
+
+// fetchSCIMUser loads the user from the id url parameter, writing the error response itself on failure.
+func (app *application) fetchSCIMUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, ok := app.readSCIMID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := app.modelsFor(r).User.GetUserByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.scimErrorResponse(w, r, http.StatusNotFound, "", "user not found")
+		default:
+			app.scimServerErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// checkUsernameAvailable returns a uniqueness error if another user already has the username.
+func (app *application) checkUsernameAvailable(r *http.Request, username string, userID int64) error {
+	users, _, err := app.modelsFor(r).User.QueryUsers("lower(username) = lower($1) AND id <> $2", []interface{}{username, userID}, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(users) > 0 {
+		return &scimRequestError{status: http.StatusConflict, scimType: "uniqueness", detail: "userName is already taken"}
+	}
+
+	return nil
+}
+
+// checkSCIMPassword checks a password set through SCIM with passwordResult, like every other new password.
+func (app *application) checkSCIMPassword(r *http.Request, password string, user *data.User) error {
+	result := app.passwordResult(r, password, user)
+	if !result.OK() {
+		return badSCIMRequest("invalidValue", "password %s", result.Message())
+	}
+	return nil
+}
+
+/*
+saveSCIMUser persists a user changed through SCIM. A password is only set when one was provided
+and passes the password checks, and deactivating the user revokes their authentication tokens.
+*/
+func (app *application) saveSCIMUser(r *http.Request, user *data.User, password string) error {
+	if user.Username == "" {
+		return badSCIMRequest("invalidValue", "userName is required")
+	}
+
+	if !validator.Matches(user.Email, validator.EmailRX) {
+		return badSCIMRequest("invalidValue", "a valid email is required")
+	}
+
+	err := app.checkUsernameAvailable(r, user.Username, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if password != "" {
+		err = app.checkSCIMPassword(r, password, user)
+		if err != nil {
+			return err
+		}
+
+		err = user.Password.Set(password)
+		if err != nil {
+			return err
+		}
+	}
+
+	user.UpdatedAt = time.Now()
+	user.Version = user.Version + 1
+
+	err = app.modelsFor(r).User.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorDuplicateEmail):
+			return &scimRequestError{status: http.StatusConflict, scimType: "uniqueness", detail: "email is already taken"}
+		default:
+			return err
+		}
+	}
+
+	if password != "" {
+		app.prunePasswordHistory(r, user)
+	}
+
+	err = app.modelsFor(r).User.SetExternalID(user)
+	if err != nil {
+		return err
+	}
+
+	if !user.Active {
+		return app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	}
+
+	return nil
+}
+
+// applySCIMUser copies the writable attributes of a SCIM user onto user, replacing them.
+func applySCIMUser(user *data.User, resource *scim.User) {
+	user.Username = resource.UserName
+	user.ExternalID = resource.ExternalID
+
+	user.FirstName, user.LastName = "", ""
+	if resource.Name != nil {
+		user.FirstName = resource.Name.GivenName
+		user.LastName = resource.Name.FamilyName
+	}
+
+	user.Email = resource.PrimaryEmail()
+	if user.Email == "" && validator.Matches(resource.UserName, validator.EmailRX) {
+		user.Email = resource.UserName
+	}
+
+	user.Active = true
+	if resource.Active != nil {
+		user.Active = *resource.Active
+	}
+}
+
+func (app *application) scimListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, err := app.readSCIMPage(r)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	where, args, err := app.readSCIMFilter(r, scimUserColumns)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	users, total, err := app.modelsFor(r).User.QueryUsers(where, args, startIndex-1, count)
+	if err != nil {
+		app.scimServerErrorResponse(w, r, err)
+		return
+	}
+
+	// With count=0 no rows come back, so the total has to be counted separately.
+	if count == 0 {
+		_, total, err = app.modelsFor(r).User.QueryUsers(where, args, 0, scim.MaxResults)
+		if err != nil {
+			app.scimServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	resources := make([]scim.User, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, scimUserFromUser(r, user))
+	}
+
+	app.writeSCIM(w, http.StatusOK, scim.NewListResponse(resources, len(resources), total, startIndex))
+}
+
+func (app *application) scimCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var resource scim.User
+
+	err := app.readSCIM(w, r, &resource)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	user := &data.User{}
+	applySCIMUser(user, &resource)
+
+	if user.Username == "" {
+		app.scimErrorResponse(w, r, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	if !validator.Matches(user.Email, validator.EmailRX) {
+		app.scimErrorResponse(w, r, http.StatusBadRequest, "invalidValue", "a valid email is required")
+		return
+	}
+
+	err = app.checkUsernameAvailable(r, user.Username, 0)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	if resource.Password != "" {
+		err = app.checkSCIMPassword(r, resource.Password, user)
+		if err != nil {
+			app.scimRequestErrorResponse(w, r, err)
+			return
+		}
+
+		err = user.Password.Set(resource.Password)
+	} else {
+		// Provisioned users sign in through the identity provider, so nobody needs to know this password.
+		err = user.Password.SetPlaceholder()
+	}
+	if err != nil {
+		app.scimServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.modelsFor(r).User.InsertUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorDuplicateEmail):
+			app.scimErrorResponse(w, r, http.StatusConflict, "uniqueness", "email is already taken")
+		default:
+			app.scimServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.modelsFor(r).User.SetExternalID(user)
+	if err != nil {
+		app.scimServerErrorResponse(w, r, err)
+		return
+	}
+
+	created, err := app.modelsFor(r).User.GetUserByID(user.ID)
+	if err != nil {
+		app.scimServerErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSCIMUser(w, r, http.StatusCreated, created)
+}
+
+func (app *application) scimShowUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchSCIMUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == scim.ETag(user.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	app.writeSCIMUser(w, r, http.StatusOK, user)
+}
+
+func (app *application) scimReplaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchSCIMUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, user.Version) {
+		return
+	}
+
+	var resource scim.User
+
+	err := app.readSCIM(w, r, &resource)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	applySCIMUser(user, &resource)
+
+	err = app.saveSCIMUser(r, user, resource.Password)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSCIMUser(w, r, http.StatusOK, user)
+}
+
+func (app *application) scimPatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchSCIMUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, user.Version) {
+		return
+	}
+
+	var patch scim.PatchOp
+
+	err := app.readSCIM(w, r, &patch)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	var password string
+
+	for _, op := range patch.Operations {
+		err = op.Normalise()
+		if err != nil {
+			app.scimErrorResponse(w, r, http.StatusBadRequest, "invalidSyntax", err.Error())
+			return
+		}
+
+		err = patchSCIMUser(user, op.Op, op.Path, op.Value, &password)
+		if err != nil {
+			app.scimRequestErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.saveSCIMUser(r, user, password)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSCIMUser(w, r, http.StatusOK, user)
+}
+
+/*
+patchSCIMUser applies a single PATCH operation to user. Operations without a path carry an
+object whose keys are attribute paths, and are applied key by key.
+*/
+func patchSCIMUser(user *data.User, op, path string, value json.RawMessage, password *string) error {
+	if path == "" {
+		if op == "remove" {
+			return badSCIMRequest("noTarget", "remove requires a path")
+		}
+
+		var attributes map[string]json.RawMessage
+		err := json.Unmarshal(value, &attributes)
+		if err != nil {
+			return badSCIMRequest("invalidValue", "value must be an object when no path is given")
+		}
+
+		for key, attributeValue := range attributes {
+			err = patchSCIMUser(user, op, key, attributeValue, password)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attribute := scim.NormalisePath(path)
+
+	// emails[type eq "work"].value addresses the single email the service stores.
+	if strings.HasPrefix(attribute, "emails[") {
+		attribute = "emails.value"
+	}
+
+	if op == "remove" {
+		switch attribute {
+		case "externalid":
+			user.ExternalID = ""
+		case "name.givenname":
+			user.FirstName = ""
+		case "name.familyname":
+			user.LastName = ""
+		case "name":
+			user.FirstName, user.LastName = "", ""
+		default:
+			return badSCIMRequest("mutability", "%s can't be removed", path)
+		}
+		return nil
+	}
+
+	switch attribute {
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+
+	case "username":
+		return scimString(value, &user.Username)
+
+	case "externalid":
+		return scimString(value, &user.ExternalID)
+
+	case "password":
+		return scimString(value, password)
+
+	case "name.givenname":
+		return scimString(value, &user.FirstName)
+
+	case "name.familyname":
+		return scimString(value, &user.LastName)
+
+	case "name":
+		var name scim.Name
+		err := json.Unmarshal(value, &name)
+		if err != nil {
+			return badSCIMRequest("invalidValue", "name must be an object")
+		}
+		user.FirstName, user.LastName = name.GivenName, name.FamilyName
+
+	case "emails":
+		var emails []scim.MultiValue
+		err := json.Unmarshal(value, &emails)
+		if err != nil {
+			return badSCIMRequest("invalidValue", "emails must be an array")
+		}
+
+		resource := scim.User{Emails: emails}
+		if email := resource.PrimaryEmail(); email != "" {
+			user.Email = email
+		}
+
+	case "emails.value":
+		return scimString(value, &user.Email)
+
+	case "displayname", "name.formatted":
+		// Derived from the given and family name, so there is nothing to store.
+
+	default:
+		return badSCIMRequest("invalidPath", "unsupported attribute %s", path)
+	}
+
+	return nil
+}
+
+// scimString decodes a string value into dst.
+func scimString(value json.RawMessage, dst *string) error {
+	err := json.Unmarshal(value, dst)
+	if err != nil {
+		return badSCIMRequest("invalidValue", "value must be a string")
+	}
+	return nil
+}
+
+// scimBool decodes a boolean value, accepting "True" and "False" strings as sent by some providers.
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if json.Unmarshal(value, &b) == nil {
+		return b, nil
+	}
+
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		b, err := strconv.ParseBool(s)
+		if err == nil {
+			return b, nil
+		}
+	}
+
+	return false, badSCIMRequest("invalidValue", "value must be a boolean")
+}
+
+func (app *application) scimDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchSCIMUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, user.Version) {
+		return
+	}
+
+	err := app.modelsFor(r).User.DeleteUser(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.scimErrorResponse(w, r, http.StatusNotFound, "", "user not found")
+		default:
+			app.scimServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---- Groups ----
+
+func scimGroupFromGroup(r *http.Request, group *data.Group) scim.Group {
+	baseURL := scimBaseURL(r)
+
+	members := make([]scim.MultiValue, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, scim.MultiValue{
+			Value:   strconv.FormatInt(member.UserID, 10),
+			Display: member.Username,
+			Ref:     fmt.Sprintf("%s/Users/%d", baseURL, member.UserID),
+		})
+	}
+
+	return scim.Group{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          strconv.FormatInt(group.ID, 10),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     members,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     fmt.Sprintf("%s/Groups/%d", baseURL, group.ID),
+			Version:      scim.ETag(group.Version),
+		},
+	}
+}
+
+func (app *application) writeSCIMGroup(w http.ResponseWriter, r *http.Request, status int, group *data.Group) {
+	resource := scimGroupFromGroup(r, group)
+
+	w.Header().Set("ETag", resource.Meta.Version)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", resource.Meta.Location)
+	}
+
+	app.writeSCIM(w, status, resource)
+}
+
+// fetchSCIMGroup loads the group from the id url parameter, writing the error response itself on failure.
+func (app *application) fetchSCIMGroup(w http.ResponseWriter, r *http.Request) (*data.Group, bool) {
+	id, ok := app.readSCIMID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	group, err := app.modelsFor(r).Groups.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.scimErrorResponse(w, r, http.StatusNotFound, "", "group not found")
+		default:
+			app.scimServerErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return group, true
+}
+
+// scimMembers converts SCIM member values into group members.
+func scimMembers(values []scim.MultiValue) ([]*data.GroupMember, error) {
+	members := make([]*data.GroupMember, 0, len(values))
+
+	for _, value := range values {
+		id, err := strconv.ParseInt(value.Value, 10, 64)
+		if err != nil {
+			return nil, badSCIMRequest("invalidValue", "unknown member %q", value.Value)
+		}
+		members = append(members, &data.GroupMember{UserID: id})
+	}
+
+	return members, nil
+}
+
+func (app *application) scimListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, err := app.readSCIMPage(r)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	where, args, err := app.readSCIMFilter(r, scimGroupColumns)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	groups, total, err := app.modelsFor(r).Groups.Query(where, args, startIndex-1, count)
+	if err != nil {
+		app.scimServerErrorResponse(w, r, err)
+		return
+	}
+
+	if count == 0 {
+		_, total, err = app.modelsFor(r).Groups.Query(where, args, 0, scim.MaxResults)
+		if err != nil {
+			app.scimServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	resources := make([]scim.Group, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, scimGroupFromGroup(r, group))
+	}
+
+	app.writeSCIM(w, http.StatusOK, scim.NewListResponse(resources, len(resources), total, startIndex))
+}
+
+func (app *application) scimCreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var resource scim.Group
+
+	err := app.readSCIM(w, r, &resource)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	if resource.DisplayName == "" {
+		app.scimErrorResponse(w, r, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	members, err := scimMembers(resource.Members)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{
+		DisplayName: resource.DisplayName,
+		ExternalID:  resource.ExternalID,
+		Members:     members,
+	}
+
+	err = app.modelsFor(r).Groups.Insert(group)
+	if err != nil {
+		app.scimServerErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSCIMGroup(w, r, http.StatusCreated, group)
+}
+
+func (app *application) scimShowGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchSCIMGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == scim.ETag(group.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	app.writeSCIMGroup(w, r, http.StatusOK, group)
+}
+
+// saveSCIMGroup persists a group changed through SCIM, writing the response.
+func (app *application) saveSCIMGroup(w http.ResponseWriter, r *http.Request, group *data.Group) {
+	if group.DisplayName == "" {
+		app.scimErrorResponse(w, r, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	err := app.modelsFor(r).Groups.Update(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorEditConflict):
+			app.scimErrorResponse(w, r, http.StatusPreconditionFailed, "", "resource has been modified")
+		default:
+			app.scimServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeSCIMGroup(w, r, http.StatusOK, group)
+}
+
+func (app *application) scimReplaceGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchSCIMGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, group.Version) {
+		return
+	}
+
+	var resource scim.Group
+
+	err := app.readSCIM(w, r, &resource)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	members, err := scimMembers(resource.Members)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	group.DisplayName = resource.DisplayName
+	group.ExternalID = resource.ExternalID
+	group.Members = members
+
+	app.saveSCIMGroup(w, r, group)
+}
+
+func (app *application) scimPatchGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchSCIMGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, group.Version) {
+		return
+	}
+
+	var patch scim.PatchOp
+
+	err := app.readSCIM(w, r, &patch)
+	if err != nil {
+		app.scimRequestErrorResponse(w, r, err)
+		return
+	}
+
+	for _, op := range patch.Operations {
+		err = op.Normalise()
+		if err != nil {
+			app.scimErrorResponse(w, r, http.StatusBadRequest, "invalidSyntax", err.Error())
+			return
+		}
+
+		err = patchSCIMGroup(group, op.Op, op.Path, op.Value)
+		if err != nil {
+			app.scimRequestErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.saveSCIMGroup(w, r, group)
+}
+
+/*
+patchSCIMGroup applies a single PATCH operation to group. Members can be removed
+individually with a path such as members[value eq "42"].
+*/
+func patchSCIMGroup(group *data.Group, op, path string, value json.RawMessage) error {
+	if path == "" {
+		if op == "remove" {
+			return badSCIMRequest("noTarget", "remove requires a path")
+		}
+
+		var attributes map[string]json.RawMessage
+		err := json.Unmarshal(value, &attributes)
+		if err != nil {
+			return badSCIMRequest("invalidValue", "value must be an object when no path is given")
+		}
+
+		for key, attributeValue := range attributes {
+			err = patchSCIMGroup(group, op, key, attributeValue)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attribute := scim.NormalisePath(path)
+
+	if strings.HasPrefix(attribute, "members[") {
+		if op != "remove" {
+			return badSCIMRequest("invalidPath", "members can only be removed by filter")
+		}
+
+		expr, err := scim.ParseFilter(strings.TrimSuffix(path[strings.Index(path, "[")+1:], "]"))
+		if err != nil {
+			return badSCIMRequest("invalidFilter", "%s", err)
+		}
+
+		ids := map[int64]bool{}
+		err = memberFilterIDs(expr, ids)
+		if err != nil {
+			return err
+		}
+
+		removeMembers(group, ids)
+		return nil
+	}
+
+	switch attribute {
+	case "displayname":
+		if op == "remove" {
+			return badSCIMRequest("mutability", "displayName can't be removed")
+		}
+		return scimString(value, &group.DisplayName)
+
+	case "externalid":
+		if op == "remove" {
+			group.ExternalID = ""
+			return nil
+		}
+		return scimString(value, &group.ExternalID)
+
+	case "members":
+		var values []scim.MultiValue
+		if len(value) > 0 {
+			err := json.Unmarshal(value, &values)
+			if err != nil {
+				return badSCIMRequest("invalidValue", "members must be an array")
+			}
+		}
+
+		members, err := scimMembers(values)
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case "replace":
+			group.Members = members
+		case "add":
+			existing := map[int64]bool{}
+			for _, member := range group.Members {
+				existing[member.UserID] = true
+			}
+			for _, member := range members {
+				if !existing[member.UserID] {
+					group.Members = append(group.Members, member)
+				}
+			}
+		case "remove":
+			if len(values) == 0 {
+				group.Members = []*data.GroupMember{}
+				return nil
+			}
+
+			ids := map[int64]bool{}
+			for _, member := range members {
+				ids[member.UserID] = true
+			}
+			removeMembers(group, ids)
+		}
+
+	default:
+		return badSCIMRequest("invalidPath", "unsupported attribute %s", path)
+	}
+
+	return nil
+}
+
+// memberFilterIDs collects the ids from a members filter made of value eq "id" expressions joined by or.
+func memberFilterIDs(expr scim.Expression, ids map[int64]bool) error {
+	switch e := expr.(type) {
+	case *scim.LogicalExpression:
+		if e.Operator != "or" {
+			break
+		}
+		err := memberFilterIDs(e.Left, ids)
+		if err != nil {
+			return err
+		}
+		return memberFilterIDs(e.Right, ids)
+
+	case *scim.AttributeExpression:
+		value, ok := e.Value.(string)
+		if !ok || e.Operator != "eq" || scim.NormalisePath(e.Path) != "value" {
+			break
+		}
+
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			ids[id] = true
+		}
+		return nil
+	}
+
+	return badSCIMRequest("invalidFilter", "members can only be filtered by value eq")
+}
+
+func removeMembers(group *data.Group, ids map[int64]bool) {
+	members := []*data.GroupMember{}
+	for _, member := range group.Members {
+		if !ids[member.UserID] {
+			members = append(members, member)
+		}
+	}
+	group.Members = members
+}
+
+func (app *application) scimDeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.fetchSCIMGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, group.Version) {
+		return
+	}
+
+	err := app.modelsFor(r).Groups.Delete(group.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.scimErrorResponse(w, r, http.StatusNotFound, "", "group not found")
+		default:
+			app.scimServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---- SCIM client administration ----
+
+func (app *application) createSCIMClientHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if input.Name == "" {
+		app.failedValidationResponse(w, r, map[string]string{"name": "must be provided"})
+		return
+	}
+
+	client, token, err := app.modelsFor(r).SCIMClients.New(input.Name)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, JSONResponse{
+		Success: true,
+		Message: "scim client created, the token will not be shown again",
+		Data:    envelope{"client": client, "token": token},
+	})
+}
+
+func (app *application) listSCIMClientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients, err := app.modelsFor(r).SCIMClients.GetAll()
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "scim clients fetch success",
+		Data:    clients,
+	})
+}
+
+func (app *application) deleteSCIMClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.modelsFor(r).SCIMClients.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no scim client found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "scim client deleted",
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 func (app *application) serve() error {
@@ -20,6 +22,20 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	var extAuthz *grpc.Server
+	if app.config.extAuthz.port != 0 {
+		var err error
+		extAuthz, err = app.serveExtAuthz()
+		if err != nil {
+			return err
+		}
+	}
+
+	var gateway *http.Server
+	if app.gateway != nil {
+		gateway = app.serveGateway()
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -34,6 +50,17 @@ func (app *application) serve() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
 
+		if extAuthz != nil {
+			extAuthz.GracefulStop()
+		}
+
+		if gateway != nil {
+			err := gateway.Shutdown(ctx)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"addr": gateway.Addr})
+			}
+		}
+
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
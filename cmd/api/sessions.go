@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"rabitech.auth.app/internal/data"
+)
+
+// maxUserAgentLength bounds the user agent stored with each session.
+const maxUserAgentLength = 512
+
+// bearerToken returns the token of the request's Authorization header, if any.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != "Bearer" {
+		return ""
+	}
+	return token
+}
+
+/*
+deviceLabel makes a short description such as "Firefox on Windows" out of a user agent, for
+clients that don't name their device when logging in.
+*/
+func deviceLabel(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"Go-http-client/", "Go client"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+
+	// Unknown clients are named by their product token, e.g. "okhttp" for "okhttp/4.9.0".
+	product, _, _ := strings.Cut(userAgent, "/")
+	product, _, _ = strings.Cut(product, " ")
+	return product
+}
+
+// sessionMeta returns the client details stored with a new session.
+func (app *application) sessionMeta(r *http.Request, device string) (ip, userAgent, label string) {
+	userAgent = r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	label = strings.TrimSpace(device)
+	if label == "" {
+		label = deviceLabel(userAgent)
+	}
+
+	return app.clientIP(r), userAgent, label
+}
+
+// touchSession records in the background that the request's token was used.
+func (app *application) touchSession(r *http.Request, token string) {
+	models, ip := app.modelsFor(r), app.clientIP(r)
+
+	app.background(func() {
+		err := models.Tokens.Touch(token, ip)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+// readSessionIDParam returns the session id url parameter.
+func (app *application) readSessionIDParam(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid session id parameter")
+	}
+	return id, nil
+}
+
+func (app *application) writeSessions(w http.ResponseWriter, r *http.Request, userID int64) {
+	sessions, err := app.modelsFor(r).Tokens.GetSessionsForUser(userID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if token := app.requestToken(r); token != "" {
+		hash := sha256.Sum256([]byte(token))
+		for _, session := range sessions {
+			session.Current = bytes.Equal(session.Hash, hash[:])
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Data:    sessions,
+	})
+}
+
+func (app *application) deleteSession(w http.ResponseWriter, r *http.Request, userID int64, param string) (int64, bool) {
+	id, err := app.readSessionIDParam(r, param)
+	if err != nil {
+		app.JSONError(w, err, http.StatusNotFound)
+		return 0, false
+	}
+
+	err = app.modelsFor(r).Tokens.DeleteSessionForUser(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("no session found with such id"), http.StatusNotFound)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return 0, false
+	}
+
+	app.writeJSON(w, http.StatusOK, JSONResponse{
+		Success: true,
+		Message: "session revoked",
+	})
+	return id, true
+}
+
+func (app *application) listMySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeSessions(w, r, app.ContextGetUser(r).ID)
+}
+
+func (app *application) deleteMySessionHandler(w http.ResponseWriter, r *http.Request) {
+	app.deleteSession(w, r, app.ContextGetUser(r).ID, "id")
+}
+
+func (app *application) listUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeSessions(w, r, user.ID)
+}
+
+func (app *application) deleteUserSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.fetchUserFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := app.deleteSession(w, r, user.ID, "session_id")
+	if ok {
+		app.recordAudit(r, data.AuditUserSessionRevoked, user.ID, map[string]interface{}{"session_id": id})
+	}
+}
@@ -1,61 +1,121 @@
 package main
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"time"
 
 	"rabitech.auth.app/internal/data"
 )
 
-func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+/*
+checkCredentials returns the activated user with the email and password. It writes the error
+response itself when the credentials don't match. Failed logins are counted per email and per
+client IP address and slow down further attempts; unknown emails and wrong passwords get the same
+response, so that it doesn't reveal which emails have accounts.
+*/
+func (app *application) checkCredentials(w http.ResponseWriter, r *http.Request, email, password string) (*data.User, bool) {
+	wait, err := app.loginDelay(r, email)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return nil, false
 	}
 
-	err := app.readJSON(w, r, &input)
+	if wait > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return nil, false
+	}
 
+	user, err := app.modelsFor(r).User.GetUserByEmail(email)
 	if err != nil {
-		app.writeJSON(w, http.StatusBadRequest, envelope{"error": err.Error()})
-		return
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			data.MatchNoPassword(password)
+			app.loginFailed(r, nil, email)
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.JSONError(w, err, http.StatusInternalServerError)
+		}
+		return nil, false
 	}
 
-	user, err := app.models.User.GetUserByEmail(input.Email)
+	passwordMatch, err := user.Password.MatchPassword(password)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
 
+	if !passwordMatch {
+		app.loginFailed(r, user, email)
+		app.invalidCredentialsResponse(w, r)
+		return nil, false
+	}
+
+	err = app.modelsFor(r).Throttles.Reset(data.ThrottleEmail, email)
 	if err != nil {
-		app.writeJSON(w, http.StatusBadRequest, envelope{"error": err.Error()})
-		return
+		app.logError(r, err)
+	}
+
+	if user.Password.NeedsRehash() {
+		app.rehashPassword(r, user, password)
 	}
 
 	if !user.Active {
 		app.writeJSON(w, http.StatusBadRequest, envelope{"error": "account not activated"})
-		return
+		return nil, false
 	}
 
-	fmt.Println(input.Password, user.Password)
+	if app.refuseBreachedLogin(w, r, user, password) {
+		return nil, false
+	}
+
+	if app.refuseExpiredPassword(w, r, user) {
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Device   string `json:"device"`
+	}
 
-	passwordMatch, err := user.Password.MatchPassword(input.Password)
+	err := app.readJSON(w, r, &input)
 
 	if err != nil {
-		fmt.Println("Error here")
 		app.writeJSON(w, http.StatusBadRequest, envelope{"error": err.Error()})
 		return
 	}
 
-	if !passwordMatch {
-		app.writeJSON(w, http.StatusBadRequest, envelope{"error": "passwords doesn't match"})
+	user, ok := app.checkCredentials(w, r, input.Email, input.Password)
+	if !ok {
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 1*24*time.Hour, data.ScopeAuthentication)
+	ip, userAgent, device := app.sessionMeta(r, input.Device)
+
+	token, err := app.modelsFor(r).Tokens.NewSession(user.ID, 1*24*time.Hour, ip, userAgent, device)
 
 	if err != nil {
 		app.writeJSON(w, http.StatusBadRequest, envelope{"error": err.Error()})
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token})
+	err = app.loadUserAccess(r, user)
+	if err != nil {
+		app.writeJSON(w, http.StatusInternalServerError, envelope{"error": err.Error()})
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{
+		"authentication_token": token,
+		"roles":                user.Roles,
+		"permissions":          user.Permissions,
+		"groups":               user.Groups,
+	})
 	if err != nil {
 		app.writeJSON(w, http.StatusBadRequest, envelope{"error": err.Error()})
 		return
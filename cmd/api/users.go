@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/validator"
 )
 
 func (app *application) status(w http.ResponseWriter, r *http.Request) {
@@ -24,18 +25,24 @@ func (app *application) status(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
-	users, err := app.models.User.GetUsers()
+	filters, ok := app.readUserFilters(w, r)
+	if !ok {
+		return
+	}
+
+	users, metadata, err := app.modelsFor(r).User.GetUsers(filters)
 
 	if err != nil {
-		fmt.Println(err)
+		app.JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK,
 		JSONResponse{
-			Success: true,
-			Message: "users fetch success",
-			Data:    users,
+			Success:  true,
+			Message:  "users fetch success",
+			Data:     users,
+			Metadata: metadata,
 		})
 
 	if err != nil {
@@ -44,6 +51,33 @@ func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// readUserFilters parses the user list query string parameters, writing the
+// validation error response itself when they are invalid.
+func (app *application) readUserFilters(w http.ResponseWriter, r *http.Request) (data.UserFilters, bool) {
+	var filters data.UserFilters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Search = app.readString(qs, "q", "")
+	filters.Active = app.readOptionalBool(qs, "active", v)
+	filters.Role = app.readOptionalInt(qs, "role", v)
+	filters.CreatedAfter = app.readOptionalTime(qs, "created_after", v)
+	filters.CreatedBefore = app.readOptionalTime(qs, "created_before", v)
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "id")
+	filters.SortSafelist = data.UserSortSafelist
+
+	if data.ValidateUserFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return filters, false
+	}
+
+	return filters, true
+}
+
 func (app *application) fetchUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
@@ -56,7 +90,7 @@ func (app *application) fetchUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := app.models.User.GetUserForToken(data.ScopeAuthentication, input.TokenPlaintext)
+	user, err := app.modelsFor(r).User.GetUserForToken(data.ScopeAuthentication, input.TokenPlaintext)
 
 	if err != nil {
 		switch {
@@ -69,10 +103,24 @@ func (app *application) fetchUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	err = app.loadUserAccess(r, user)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// The expiry lets clients know how long they may cache the result.
+	expiry, err := app.modelsFor(r).Tokens.GetExpiry(data.ScopeAuthentication, input.TokenPlaintext)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
 	app.writeJSON(w, http.StatusOK, JSONResponse{
-		Success: true,
-		Message: "users fetch success",
-		Data:    user,
+		Success:  true,
+		Message:  "users fetch success",
+		Data:     user,
+		Metadata: envelope{"token_expiry": expiry},
 	})
 }
 
@@ -100,6 +148,16 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Active:    false,
 	}
 
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPassword(w, r, input.Password, user) {
+		return
+	}
+
 	err = user.Password.Set(input.Password)
 
 	if err != nil {
@@ -107,12 +165,12 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.User.InsertUser(user)
+	err = app.modelsFor(r).User.InsertUser(user)
 
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrorDuplicateEmail):
-			app.JSONError(w, errors.New("user with email already exist"), http.StatusBadRequest)
+			app.JSONError(w, errors.New("user with email already exist"), http.StatusConflict)
 		default:
 			app.JSONError(w, errors.New("rror inserting user to database"), http.StatusBadRequest)
 		}
@@ -120,7 +178,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 	duration := 1 * 24 * time.Hour
 
-	token, err := app.models.Tokens.New(user.ID, duration, data.ScopeActivation)
+	token, err := app.modelsFor(r).Tokens.New(user.ID, duration, data.ScopeActivation)
 	if err != nil {
 		app.JSONError(w, err, http.StatusBadRequest)
 		return
@@ -170,7 +228,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user, err := app.models.User.GetUserForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.modelsFor(r).User.GetUserForToken(data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case err.Error() == "sql: no rows in result set":
@@ -187,14 +245,14 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	user.UpdatedAt = time.Now()
 	user.Version = user.Version + 1
 
-	err = app.models.User.UpdateUser(user)
+	err = app.modelsFor(r).User.UpdateUser(user)
 
 	if err != nil {
 		app.JSONError(w, err, http.StatusBadRequest)
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
 	if err != nil {
 		app.JSONError(w, err, http.StatusBadRequest)
 		return
@@ -207,3 +265,92 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 			Data:    user,
 		})
 }
+
+// sendPasswordResetEmail issues a password reset token for the user and emails it in the background with the template.
+func (app *application) sendPasswordResetEmail(r *http.Request, user *data.User, template string) error {
+	duration := 1 * time.Hour
+
+	token, err := app.modelsFor(r).Tokens.New(user.ID, duration, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	emailData := map[string]interface{}{
+		"UserName":           user.Username,
+		"passwordResetToken": token.Plaintext,
+		"expiryDuration":     duration,
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(user.Email, template, emailData)
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+
+	return nil
+}
+
+func (app *application) resetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.modelsFor(r).User.GetUserForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.JSONError(w, errors.New("invalid or expired password reset token"), http.StatusBadRequest)
+		default:
+			app.JSONError(w, err, http.StatusBadRequest)
+		}
+		return
+	}
+
+	if !app.checkPassword(w, r, input.Password, user) {
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user.UpdatedAt = time.Now()
+	user.Version = user.Version + 1
+
+	err = app.modelsFor(r).User.UpdateUser(user)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+	app.prunePasswordHistory(r, user)
+
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Whoever made the user reset their password must lose the sessions they may have taken over.
+	err = app.modelsFor(r).Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK,
+		JSONResponse{
+			Success: true,
+			Message: "password reset success",
+		})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/jsonlog"
+)
+
+// testDB opens the migrated database named by TEST_DB_DSN, skipping the test when it isn't set.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestResetPasswordRevokesTokens(t *testing.T) {
+	db := testDB(t)
+
+	app := &application{logger: jsonlog.New(io.Discard, jsonlog.LevelOff), models: data.NewModel(db)}
+	models := app.models.ForOrganization(data.DefaultOrganizationID)
+
+	user := &data.User{
+		FirstName: "Reset",
+		LastName:  "Test",
+		Username:  "reset-test",
+		Email:     fmt.Sprintf("reset-test-%d@example.com", time.Now().UnixNano()),
+		Active:    true,
+	}
+	if err := user.Password.Set("old correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.User.InsertUser(user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.User.DeleteUser(user.ID) })
+
+	session, err := models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := models.Tokens.New(user.ID, time.Hour, data.ScopePasswordReset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := app.routes()
+
+	body := fmt.Sprintf(`{"password": "new correct horse battery", "token": %q}`, reset.Plaintext)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/users/password", strings.NewReader(body)))
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/me/sessions", nil)
+	r.Header.Set("Authorization", "Bearer "+session.Plaintext)
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, r)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"rabitech.auth.app/internal/breach"
+	"rabitech.auth.app/internal/jsonlog"
+)
+
+type config struct {
+	in       string
+	out      string
+	fpRate   float64
+	minCount int
+}
+
+/*
+The breach command builds the bloom filter the API screens passwords with (-breach-bloom) out of a
+Pwned Passwords download, either the directory of range files or a single file of HASH:COUNT lines.
+
+	go run ./cmd/breach -in=./pwnedpasswords -out=breached.bloom -fp-rate=0.001
+
+The corpus is read twice, first to size the filter and then to fill it.
+*/
+func main() {
+	var cfg config
+
+	flag.StringVar(&cfg.in, "in", "", "directory of Pwned Passwords range files, or a file of HASH:COUNT lines")
+	flag.StringVar(&cfg.out, "out", "breached.bloom", "file the bloom filter is written to")
+	flag.Float64Var(&cfg.fpRate, "fp-rate", 0.001, "rate of passwords wrongly reported as breached")
+	flag.IntVar(&cfg.minCount, "min-count", 1, "leave out passwords seen in fewer breaches")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stderr, jsonlog.LevelInfo)
+
+	if cfg.in == "" {
+		logger.PrintFatal(errors.New("-in must be set"), nil)
+	}
+	if cfg.fpRate <= 0 || cfg.fpRate >= 1 {
+		logger.PrintFatal(errors.New("-fp-rate must be between 0 and 1"), nil)
+	}
+
+	var n uint64
+	err := breach.Walk(cfg.in, cfg.minCount, func(breach.Hash) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		logger.PrintFatal(err, map[string]string{"in": cfg.in})
+	}
+
+	bloom := breach.NewBloom(n, cfg.fpRate)
+
+	err = breach.Walk(cfg.in, cfg.minCount, func(hash breach.Hash) error {
+		bloom.Add(hash)
+		return nil
+	})
+	if err != nil {
+		logger.PrintFatal(err, map[string]string{"in": cfg.in})
+	}
+
+	f, err := os.Create(cfg.out)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	w := bufio.NewWriterSize(f, 1<<20)
+
+	_, err = bloom.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		logger.PrintFatal(err, map[string]string{"out": cfg.out})
+	}
+
+	logger.PrintInfo("bloom filter written", map[string]string{
+		"out":    cfg.out,
+		"hashes": fmt.Sprint(bloom.Len()),
+		"bytes":  fmt.Sprint(bloom.Size()),
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"rabitech.auth.app/internal/breach"
+	"rabitech.auth.app/internal/data"
+	"rabitech.auth.app/internal/data/mailer"
+	"rabitech.auth.app/internal/jsonlog"
+	"rabitech.auth.app/internal/passwordpolicy"
+
+	_ "github.com/lib/pq"
+)
+
+// invitationDuration is how long the token in an invitation email stays valid.
+const invitationDuration = 3 * 24 * time.Hour
+
+type config struct {
+	dsn    string
+	file   string
+	format string
+	invite bool
+	tenant string
+
+	password passwordpolicy.Policy
+	breach   struct {
+		dir   string
+		bloom string
+	}
+
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+}
+
+/*
+The import command bulk loads users from a CSV or NDJSON file into auth_user.
+
+	go run ./cmd/import -file=users.csv -invite -tenant=acme
+
+The result, including the per-row errors, is written to stdout as JSON.
+*/
+func main() {
+	err := godotenv.Load(".env")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Env variables not loaded")
+	}
+
+	var cfg config
+
+	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("DATABASE_DSN"), "database connection string")
+	flag.StringVar(&cfg.file, "file", "-", "file to import, - reads from stdin")
+	flag.StringVar(&cfg.format, "format", "", "import format (csv|ndjson), defaults to the file extension")
+	flag.BoolVar(&cfg.invite, "invite", false, "email imported users an invitation to choose their password")
+	flag.StringVar(&cfg.tenant, "tenant", "default", "slug of the organization the users are imported into")
+
+	flag.IntVar(&cfg.password.MinLength, "password-min-length", 8, "minimum length of imported plaintext passwords")
+	flag.IntVar(&cfg.password.MaxLength, "password-max-length", 64, "maximum length of imported plaintext passwords")
+	flag.IntVar(&cfg.password.MinScore, "password-min-score", 3, "minimum strength score, from 0 to 4, of imported plaintext passwords")
+	flag.StringVar(&cfg.breach.dir, "breach-dir", os.Getenv("BREACH_DIR"), "directory of Pwned Passwords range files imported plaintext passwords are screened against")
+	flag.StringVar(&cfg.breach.bloom, "breach-bloom", os.Getenv("BREACH_BLOOM"), "bloom filter built by cmd/breach imported plaintext passwords are screened against, instead of -breach-dir")
+
+	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMPT port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP Username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stderr, jsonlog.LevelInfo)
+
+	if cfg.format == "" {
+		cfg.format = strings.TrimPrefix(filepath.Ext(cfg.file), ".")
+	}
+
+	var in io.Reader = os.Stdin
+	if cfg.file != "-" {
+		f, err := os.Open(cfg.file)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := sql.Open("postgres", cfg.dsn)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer db.Close()
+
+	models := data.NewModel(db)
+
+	organization, err := models.Organizations.GetBySlug(cfg.tenant)
+	if err != nil {
+		logger.PrintFatal(err, map[string]string{"tenant": cfg.tenant})
+	}
+
+	models = models.ForOrganization(organization.ID)
+
+	src, err := data.NewImportReader(in, cfg.format)
+	if err != nil {
+		logger.PrintFatal(err, map[string]string{"format": cfg.format})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), data.ImportTimeout)
+	defer cancel()
+
+	var breached breach.Corpus
+	switch {
+	case cfg.breach.dir != "":
+		breached, err = breach.OpenRangeDir(cfg.breach.dir, 1)
+	case cfg.breach.bloom != "":
+		breached, err = breach.LoadBloom(cfg.breach.bloom)
+	}
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	result, err := models.User.ImportUsers(ctx, src, passwordCheck(cfg.password, breached))
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	logger.PrintInfo("users import complete", map[string]string{
+		"imported": fmt.Sprint(len(result.Imported)),
+		"errors":   fmt.Sprint(len(result.Errors)),
+	})
+
+	if cfg.invite {
+		m := mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+
+		for _, user := range result.Imported {
+			token, err := models.Tokens.New(user.ID, invitationDuration, data.ScopePasswordReset)
+			if err != nil {
+				logger.PrintError(err, map[string]string{"email": user.Email})
+				continue
+			}
+
+			emailData := map[string]interface{}{
+				"UserName":        user.Username,
+				"invitationToken": token.Plaintext,
+				"expiryDuration":  invitationDuration,
+			}
+
+			err = m.Send(user.Email, "user_invitation.html", emailData)
+			if err != nil {
+				logger.PrintError(err, map[string]string{"email": user.Email})
+			}
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	err = enc.Encode(result)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+}
+
+// passwordCheck checks imported plaintext passwords against the policy and, when it isn't nil, the corpus of breached passwords.
+func passwordCheck(policy passwordpolicy.Policy, breached breach.Corpus) data.PasswordCheck {
+	return func(password string, user *data.User) string {
+		result := policy.Check(password, user.Email, user.Username, user.FirstName, user.LastName)
+		if breached != nil {
+			found, err := breach.Breached(breached, password)
+			if err == nil && found {
+				result.Violations = append(result.Violations, passwordpolicy.Violation{
+					Code:    passwordpolicy.CodeBreached,
+					Message: "has appeared in a data breach, choose another one",
+				})
+			}
+		}
+		return result.Message()
+	}
+}
@@ -0,0 +1,320 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxDepth bounds how many relations a check or expand may follow before giving up.
+const DefaultMaxDepth = 25
+
+var (
+	ErrorUnknownNamespace = errors.New("unknown namespace")
+	ErrorUnknownRelation  = errors.New("unknown relation")
+	ErrorMaxDepth         = errors.New("maximum depth exceeded")
+)
+
+/*
+TupleReader reads relation tuples. Every read of one check is expected to come from the same
+snapshot, so a check never sees half of a concurrent write.
+*/
+type TupleReader interface {
+	// Subjects returns the subjects of the tuples object#relation@subject.
+	Subjects(ctx context.Context, object Object, relation string) ([]Subject, error)
+}
+
+/*
+Checker evaluates checks and expands against namespace configurations and tuples.
+*/
+type Checker struct {
+	Namespaces map[string]*Namespace
+	Reader     TupleReader
+	MaxDepth   int
+}
+
+func (c *Checker) rewrite(object Object, relation string) (*Rewrite, error) {
+	namespace, ok := c.Namespaces[object.Namespace]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrorUnknownNamespace, object.Namespace)
+	}
+
+	rewrite, ok := namespace.rewrite(relation)
+	if !ok {
+		return nil, fmt.Errorf("%w %q in namespace %q", ErrorUnknownRelation, relation, object.Namespace)
+	}
+
+	return rewrite, nil
+}
+
+func (c *Checker) maxDepth() int {
+	if c.MaxDepth > 0 {
+		return c.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+/*
+Check reports whether subject has relation to object, either through a tuple or through
+the rewrite rules of the relation.
+*/
+func (c *Checker) Check(ctx context.Context, object Object, relation string, subject Subject) (bool, error) {
+	ch := &check{Checker: c, subject: subject, results: map[Subject]bool{}, pending: map[Subject]bool{}}
+	return ch.check(ctx, Subject{Object: object, Relation: relation}, 0)
+}
+
+/*
+check is the state of a single Check call. A userset that is still being evaluated counts as not
+matching, which stops cycles. Results are memoized per userset, except for negative results that
+depended on such a cycle, since they may turn out differently once the cycle is resolved.
+*/
+type check struct {
+	*Checker
+	subject Subject
+	results map[Subject]bool
+	pending map[Subject]bool
+	cycles  int
+}
+
+func (ch *check) check(ctx context.Context, userset Subject, depth int) (bool, error) {
+	if userset == ch.subject {
+		return true, nil
+	}
+
+	if result, ok := ch.results[userset]; ok {
+		return result, nil
+	}
+
+	if ch.pending[userset] {
+		ch.cycles++
+		return false, nil
+	}
+
+	if depth > ch.maxDepth() {
+		return false, ErrorMaxDepth
+	}
+
+	rewrite, err := ch.rewrite(userset.Object, userset.Relation)
+	if err != nil {
+		// Usersets that aren't configured, such as user:10#member, have no subjects. Only the
+		// relation being checked has to exist.
+		if depth > 0 && (errors.Is(err, ErrorUnknownNamespace) || errors.Is(err, ErrorUnknownRelation)) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	cycles := ch.cycles
+	ch.pending[userset] = true
+
+	result, err := ch.evaluate(ctx, userset.Object, userset.Relation, rewrite, depth)
+	delete(ch.pending, userset)
+	if err != nil {
+		return false, err
+	}
+
+	if result || ch.cycles == cycles {
+		ch.results[userset] = result
+	}
+
+	return result, nil
+}
+
+func (ch *check) evaluate(ctx context.Context, object Object, relation string, r *Rewrite, depth int) (bool, error) {
+	switch {
+	case r.This != nil:
+		subjects, err := ch.Reader.Subjects(ctx, object, relation)
+		if err != nil {
+			return false, err
+		}
+
+		for _, s := range subjects {
+			if s == ch.subject {
+				return true, nil
+			}
+		}
+
+		for _, s := range subjects {
+			if s.Relation == "" {
+				continue
+			}
+
+			ok, err := ch.check(ctx, s, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+
+		return false, nil
+
+	case r.ComputedUserset != nil:
+		return ch.check(ctx, Subject{Object: object, Relation: r.ComputedUserset.Relation}, depth+1)
+
+	case r.TupleToUserset != nil:
+		subjects, err := ch.Reader.Subjects(ctx, object, r.TupleToUserset.Tupleset.Relation)
+		if err != nil {
+			return false, err
+		}
+
+		for _, s := range subjects {
+			ok, err := ch.check(ctx, Subject{Object: s.Object, Relation: r.TupleToUserset.ComputedUserset.Relation}, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+
+		return false, nil
+
+	case r.Union != nil:
+		for _, child := range r.Union {
+			ok, err := ch.evaluate(ctx, object, relation, child, depth)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+
+		return false, nil
+
+	case r.Intersection != nil:
+		for _, child := range r.Intersection {
+			ok, err := ch.evaluate(ctx, object, relation, child, depth)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		return true, nil
+
+	case r.Exclusion != nil:
+		ok, err := ch.evaluate(ctx, object, relation, r.Exclusion.Base, depth)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		excluded, err := ch.evaluate(ctx, object, relation, r.Exclusion.Subtract, depth)
+		if err != nil {
+			return false, err
+		}
+
+		return !excluded, nil
+	}
+
+	return false, nil
+}
+
+/*
+Tree is the expansion of a userset. Leaves list the subjects of tuples, which may themselves be
+usersets the caller can expand further; the other nodes combine their children.
+*/
+type Tree struct {
+	Operation string   `json:"operation"`
+	Userset   string   `json:"userset,omitempty"`
+	Subjects  []string `json:"subjects,omitempty"`
+	Children  []*Tree  `json:"children,omitempty"`
+}
+
+// Tree operations.
+const (
+	OperationLeaf         = "leaf"
+	OperationUnion        = "union"
+	OperationIntersection = "intersection"
+	OperationExclusion    = "exclusion"
+)
+
+/*
+Expand returns the tree of rewrite rules and tuples that make up the subjects of object#relation.
+*/
+func (c *Checker) Expand(ctx context.Context, object Object, relation string) (*Tree, error) {
+	return c.expand(ctx, Subject{Object: object, Relation: relation}, 0)
+}
+
+func (c *Checker) expand(ctx context.Context, userset Subject, depth int) (*Tree, error) {
+	if depth > c.maxDepth() {
+		return nil, ErrorMaxDepth
+	}
+
+	rewrite, err := c.rewrite(userset.Object, userset.Relation)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.expandRewrite(ctx, userset, rewrite, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	tree.Userset = userset.String()
+	return tree, nil
+}
+
+func (c *Checker) expandRewrite(ctx context.Context, userset Subject, r *Rewrite, depth int) (*Tree, error) {
+	switch {
+	case r.This != nil:
+		subjects, err := c.Reader.Subjects(ctx, userset.Object, userset.Relation)
+		if err != nil {
+			return nil, err
+		}
+
+		tree := &Tree{Operation: OperationLeaf, Subjects: []string{}}
+		for _, s := range subjects {
+			tree.Subjects = append(tree.Subjects, s.String())
+		}
+
+		return tree, nil
+
+	case r.ComputedUserset != nil:
+		child, err := c.expand(ctx, Subject{Object: userset.Object, Relation: r.ComputedUserset.Relation}, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Tree{Operation: OperationUnion, Children: []*Tree{child}}, nil
+
+	case r.TupleToUserset != nil:
+		subjects, err := c.Reader.Subjects(ctx, userset.Object, r.TupleToUserset.Tupleset.Relation)
+		if err != nil {
+			return nil, err
+		}
+
+		tree := &Tree{Operation: OperationUnion}
+		for _, s := range subjects {
+			child, err := c.expand(ctx, Subject{Object: s.Object, Relation: r.TupleToUserset.ComputedUserset.Relation}, depth+1)
+			if err != nil {
+				if errors.Is(err, ErrorUnknownNamespace) || errors.Is(err, ErrorUnknownRelation) {
+					continue
+				}
+				return nil, err
+			}
+
+			tree.Children = append(tree.Children, child)
+		}
+
+		return tree, nil
+
+	case r.Union != nil:
+		return c.expandChildren(ctx, OperationUnion, userset, r.Union, depth)
+
+	case r.Intersection != nil:
+		return c.expandChildren(ctx, OperationIntersection, userset, r.Intersection, depth)
+
+	case r.Exclusion != nil:
+		return c.expandChildren(ctx, OperationExclusion, userset, []*Rewrite{r.Exclusion.Base, r.Exclusion.Subtract}, depth)
+	}
+
+	return &Tree{Operation: OperationLeaf, Subjects: []string{}}, nil
+}
+
+func (c *Checker) expandChildren(ctx context.Context, operation string, userset Subject, rules []*Rewrite, depth int) (*Tree, error) {
+	tree := &Tree{Operation: operation}
+
+	for _, rule := range rules {
+		child, err := c.expandRewrite(ctx, userset, rule, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		tree.Children = append(tree.Children, child)
+	}
+
+	return tree, nil
+}
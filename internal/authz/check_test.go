@@ -0,0 +1,158 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryReader []Tuple
+
+func (m memoryReader) Subjects(ctx context.Context, object Object, relation string) ([]Subject, error) {
+	var subjects []Subject
+	for _, t := range m {
+		if t.Object == object && t.Relation == relation {
+			subjects = append(subjects, t.Subject)
+		}
+	}
+	return subjects, nil
+}
+
+func testChecker(t *testing.T, tuples ...string) *Checker {
+	var namespaces []*Namespace
+	err := json.Unmarshal([]byte(`[
+		{"name": "doc", "relations": {
+			"parent": {},
+			"banned": {},
+			"owner": {},
+			"editor": {"rewrite": {"union": [{"this": {}}, {"computed_userset": {"relation": "owner"}}]}},
+			"viewer": {"rewrite": {"exclusion": {
+				"base": {"union": [
+					{"this": {}},
+					{"computed_userset": {"relation": "editor"}},
+					{"tuple_to_userset": {"tupleset": {"relation": "parent"}, "computed_userset": {"relation": "viewer"}}}
+				]},
+				"subtract": {"computed_userset": {"relation": "banned"}}
+			}}}
+		}},
+		{"name": "folder", "relations": {"viewer": {}}},
+		{"name": "group", "relations": {"member": {}}}
+	]`), &namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Checker{Namespaces: map[string]*Namespace{}}
+	for _, n := range namespaces {
+		if !assert.NoError(t, n.Validate(), n.Name) {
+			t.FailNow()
+		}
+		c.Namespaces[n.Name] = n
+	}
+
+	var reader memoryReader
+	for _, s := range tuples {
+		tuple, err := ParseTuple(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = append(reader, tuple)
+	}
+	c.Reader = reader
+
+	return c
+}
+
+func TestCheck(t *testing.T) {
+	c := testChecker(t,
+		"doc:readme#owner@user:1",
+		"doc:readme#editor@group:eng#member",
+		"group:eng#member@user:2",
+		"group:eng#member@group:ops#member",
+		"group:ops#member@user:3",
+		"group:ops#member@group:eng#member",
+		"doc:readme#parent@folder:root",
+		"folder:root#viewer@user:4",
+		"doc:readme#banned@user:5",
+		"group:eng#member@user:5",
+	)
+
+	tests := []struct {
+		relation string
+		subject  string
+		want     bool
+	}{
+		{"owner", "user:1", true},
+		{"editor", "user:1", true},
+		{"viewer", "user:1", true},
+		{"editor", "user:2", true},
+		{"editor", "user:3", true},
+		{"editor", "group:eng#member", true},
+		{"viewer", "user:4", true},
+		{"editor", "user:4", false},
+		{"editor", "user:5", true},
+		{"viewer", "user:5", false},
+		{"viewer", "user:6", false},
+	}
+
+	readme := Object{Namespace: "doc", ID: "readme"}
+
+	for _, tt := range tests {
+		subject, err := ParseSubject(tt.subject)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		ok, err := c.Check(context.Background(), readme, tt.relation, subject)
+		if assert.NoError(t, err, tt.relation+"@"+tt.subject) {
+			assert.Equal(t, tt.want, ok, tt.relation+"@"+tt.subject)
+		}
+	}
+
+	_, err := c.Check(context.Background(), readme, "admin", Subject{Object: Object{Namespace: "user", ID: "1"}})
+	assert.ErrorIs(t, err, ErrorUnknownRelation)
+}
+
+func TestExpand(t *testing.T) {
+	c := testChecker(t, "doc:readme#owner@user:1", "doc:readme#editor@group:eng#member")
+
+	tree, err := c.Expand(context.Background(), Object{Namespace: "doc", ID: "readme"}, "editor")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, OperationUnion, tree.Operation)
+	assert.Equal(t, "doc:readme#editor", tree.Userset)
+	assert.Equal(t, []string{"group:eng#member"}, tree.Children[0].Subjects)
+	assert.Equal(t, []string{"user:1"}, tree.Children[1].Children[0].Subjects)
+}
+
+func TestParseTuple(t *testing.T) {
+	tuple, err := ParseTuple("doc:readme#viewer@group:eng#member")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "doc:readme#viewer@group:eng#member", tuple.String())
+	}
+
+	for _, s := range []string{"doc:readme#viewer", "doc:readme@user:1", "Doc:readme#viewer@user:1", "doc:read me#viewer@user:1", "doc:readme#viewer@user"} {
+		_, err := ParseTuple(s)
+		assert.ErrorIs(t, err, ErrorInvalidTuple, s)
+	}
+}
+
+func TestNamespaceValidate(t *testing.T) {
+	tests := []string{
+		`{"name": "doc", "relations": {}}`,
+		`{"name": "doc", "relations": {"editor": {"rewrite": {"computed_userset": {"relation": "owner"}}}}}`,
+		`{"name": "doc", "relations": {"editor": {"rewrite": {"this": {}, "union": [{"this": {}}]}}}}`,
+		`{"name": "doc", "relations": {"editor": {"rewrite": {"union": []}}}}`,
+	}
+
+	for _, tt := range tests {
+		var n Namespace
+		if assert.NoError(t, json.Unmarshal([]byte(tt), &n)) {
+			assert.ErrorIs(t, n.Validate(), ErrorInvalidNamespace, tt)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorInvalidNamespace is wrapped by every error returned while validating a namespace configuration.
+var ErrorInvalidNamespace = errors.New("invalid namespace configuration")
+
+/*
+Namespace configures the relations of the objects in a namespace, e.g.
+
+	{
+		"name": "doc",
+		"relations": {
+			"owner": {},
+			"editor": {"rewrite": {"union": [{"this": {}}, {"computed_userset": {"relation": "owner"}}]}},
+			"viewer": {"rewrite": {"union": [
+				{"this": {}},
+				{"computed_userset": {"relation": "editor"}},
+				{"tuple_to_userset": {"tupleset": {"relation": "parent"}, "computed_userset": {"relation": "viewer"}}}
+			]}}
+		}
+	}
+
+Tuples can only be written for relations that are configured.
+*/
+type Namespace struct {
+	Name      string               `json:"name"`
+	Relations map[string]*Relation `json:"relations"`
+}
+
+/*
+Relation configures how the subjects of a relation are computed. Without a rewrite the
+relation only has the subjects of its own tuples.
+*/
+type Relation struct {
+	Rewrite *Rewrite `json:"rewrite,omitempty"`
+}
+
+/*
+Rewrite is a userset rewrite rule. Exactly one of its fields is set:
+
+  - this: the subjects of the tuples of the relation itself
+  - computed_userset: the subjects of another relation of the same object
+  - tuple_to_userset: for every object related by the tupleset relation, the subjects of
+    the computed_userset relation of that object, e.g. the viewers of a document's parent folder
+  - union, intersection and exclusion combine other rules
+*/
+type Rewrite struct {
+	This            *struct{}        `json:"this,omitempty"`
+	ComputedUserset *ComputedUserset `json:"computed_userset,omitempty"`
+	TupleToUserset  *TupleToUserset  `json:"tuple_to_userset,omitempty"`
+	Union           []*Rewrite       `json:"union,omitempty"`
+	Intersection    []*Rewrite       `json:"intersection,omitempty"`
+	Exclusion       *Exclusion       `json:"exclusion,omitempty"`
+}
+
+/*
+ComputedUserset refers to another relation of the object being evaluated.
+*/
+type ComputedUserset struct {
+	Relation string `json:"relation"`
+}
+
+/*
+TupleToUserset follows the tuples of the tupleset relation and evaluates the computed
+userset on the objects they point to.
+*/
+type TupleToUserset struct {
+	Tupleset        ComputedUserset `json:"tupleset"`
+	ComputedUserset ComputedUserset `json:"computed_userset"`
+}
+
+/*
+Exclusion is the subjects of base that aren't subjects of subtract.
+*/
+type Exclusion struct {
+	Base     *Rewrite `json:"base"`
+	Subtract *Rewrite `json:"subtract"`
+}
+
+/*
+Validate checks that the namespace only uses valid names and that every rewrite rule
+is well formed and refers to relations of the namespace.
+*/
+func (n *Namespace) Validate() error {
+	if !NameRX.MatchString(n.Name) {
+		return fmt.Errorf("%w: %q is not a valid namespace name", ErrorInvalidNamespace, n.Name)
+	}
+
+	if len(n.Relations) == 0 {
+		return fmt.Errorf("%w: at least one relation must be configured", ErrorInvalidNamespace)
+	}
+
+	for name, relation := range n.Relations {
+		if !NameRX.MatchString(name) {
+			return fmt.Errorf("%w: %q is not a valid relation name", ErrorInvalidNamespace, name)
+		}
+
+		if relation == nil || relation.Rewrite == nil {
+			continue
+		}
+
+		err := n.validateRewrite(relation.Rewrite)
+		if err != nil {
+			return fmt.Errorf("%w: relation %q: %s", ErrorInvalidNamespace, name, err)
+		}
+	}
+
+	return nil
+}
+
+func (n *Namespace) validateRewrite(r *Rewrite) error {
+	if r == nil {
+		return errors.New("rewrite rules can't be empty")
+	}
+
+	set := 0
+	for _, ok := range []bool{r.This != nil, r.ComputedUserset != nil, r.TupleToUserset != nil, r.Union != nil, r.Intersection != nil, r.Exclusion != nil} {
+		if ok {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return errors.New("every rewrite rule must have exactly one of this, computed_userset, tuple_to_userset, union, intersection or exclusion")
+	}
+
+	switch {
+	case r.ComputedUserset != nil:
+		return n.checkRelation(r.ComputedUserset.Relation)
+
+	case r.TupleToUserset != nil:
+		// The computed userset is evaluated on objects of other namespaces, so only its name can be checked.
+		if !NameRX.MatchString(r.TupleToUserset.ComputedUserset.Relation) {
+			return fmt.Errorf("%q is not a valid relation name", r.TupleToUserset.ComputedUserset.Relation)
+		}
+		return n.checkRelation(r.TupleToUserset.Tupleset.Relation)
+
+	case r.Union != nil || r.Intersection != nil:
+		children := r.Union
+		if r.Intersection != nil {
+			children = r.Intersection
+		}
+
+		if len(children) == 0 {
+			return errors.New("union and intersection need at least one rule")
+		}
+
+		for _, child := range children {
+			err := n.validateRewrite(child)
+			if err != nil {
+				return err
+			}
+		}
+
+	case r.Exclusion != nil:
+		err := n.validateRewrite(r.Exclusion.Base)
+		if err != nil {
+			return err
+		}
+		return n.validateRewrite(r.Exclusion.Subtract)
+	}
+
+	return nil
+}
+
+func (n *Namespace) checkRelation(name string) error {
+	if _, ok := n.Relations[name]; !ok {
+		return fmt.Errorf("unknown relation %q", name)
+	}
+	return nil
+}
+
+// rewrite returns the rewrite rule of a relation, defaulting to this.
+func (n *Namespace) rewrite(relation string) (*Rewrite, bool) {
+	r, ok := n.Relations[relation]
+	if !ok {
+		return nil, false
+	}
+
+	if r == nil || r.Rewrite == nil {
+		return &Rewrite{This: &struct{}{}}, true
+	}
+
+	return r.Rewrite, true
+}
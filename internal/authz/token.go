@@ -0,0 +1,35 @@
+package authz
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrorInvalidToken = errors.New("invalid consistency token")
+
+const tokenPrefix = "r1."
+
+/*
+EncodeToken returns the consistency token of a tuple revision. Writes return one, and a check
+given the token is evaluated against tuples at least as fresh as that write.
+*/
+func EncodeToken(revision int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(tokenPrefix + strconv.FormatInt(revision, 10)))
+}
+
+// DecodeToken returns the revision of a consistency token.
+func DecodeToken(token string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(b), tokenPrefix) {
+		return 0, ErrorInvalidToken
+	}
+
+	revision, err := strconv.ParseInt(strings.TrimPrefix(string(b), tokenPrefix), 10, 64)
+	if err != nil || revision < 0 {
+		return 0, ErrorInvalidToken
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,130 @@
+/*
+Package authz implements relationship-based authorization in the style of Google's Zanzibar.
+
+Permissions are derived from relation tuples such as doc:readme#owner@user:10, "user 10 is an
+owner of document readme", and from namespace configurations that describe how relations are
+computed from each other, e.g. every owner of a document is also an editor.
+*/
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrorInvalidTuple is wrapped by every error returned while parsing a tuple, object or subject.
+var ErrorInvalidTuple = errors.New("invalid relation tuple")
+
+var (
+	// NameRX restricts namespace and relation names.
+	NameRX = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+	// ObjectIDRX restricts object ids. ':', '#' and '@' separate the parts of a tuple so they can't be used.
+	ObjectIDRX = regexp.MustCompile(`^[A-Za-z0-9_.|/=+\-]{1,128}$`)
+)
+
+/*
+Object is an object in a namespace, written namespace:id.
+*/
+type Object struct {
+	Namespace string
+	ID        string
+}
+
+func (o Object) String() string {
+	return o.Namespace + ":" + o.ID
+}
+
+/*
+Subject is who a tuple relates an object to. It is either an object, such as user:10, or a userset,
+such as group:eng#member, which stands for every subject with that relation to the object.
+*/
+type Subject struct {
+	Object
+	Relation string
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Object.String()
+	}
+	return s.Object.String() + "#" + s.Relation
+}
+
+/*
+Tuple relates an object to a subject, written object#relation@subject.
+*/
+type Tuple struct {
+	Object   Object
+	Relation string
+	Subject  Subject
+}
+
+func (t Tuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// ParseObject parses namespace:id.
+func ParseObject(s string) (Object, error) {
+	namespace, id, ok := strings.Cut(s, ":")
+	if !ok {
+		return Object{}, fmt.Errorf("%w: %q must be written namespace:id", ErrorInvalidTuple, s)
+	}
+
+	if !NameRX.MatchString(namespace) {
+		return Object{}, fmt.Errorf("%w: %q is not a valid namespace name", ErrorInvalidTuple, namespace)
+	}
+
+	if !ObjectIDRX.MatchString(id) {
+		return Object{}, fmt.Errorf("%w: %q is not a valid object id", ErrorInvalidTuple, id)
+	}
+
+	return Object{Namespace: namespace, ID: id}, nil
+}
+
+// ParseSubject parses namespace:id or namespace:id#relation.
+func ParseSubject(s string) (Subject, error) {
+	object, relation, hasRelation := strings.Cut(s, "#")
+
+	o, err := ParseObject(object)
+	if err != nil {
+		return Subject{}, err
+	}
+
+	if hasRelation && !NameRX.MatchString(relation) {
+		return Subject{}, fmt.Errorf("%w: %q is not a valid relation name", ErrorInvalidTuple, relation)
+	}
+
+	return Subject{Object: o, Relation: relation}, nil
+}
+
+// ParseTuple parses namespace:id#relation@subject.
+func ParseTuple(s string) (Tuple, error) {
+	objectRelation, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %q must be written object#relation@subject", ErrorInvalidTuple, s)
+	}
+
+	object, relation, ok := strings.Cut(objectRelation, "#")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %q must be written object#relation@subject", ErrorInvalidTuple, s)
+	}
+
+	o, err := ParseObject(object)
+	if err != nil {
+		return Tuple{}, err
+	}
+
+	if !NameRX.MatchString(relation) {
+		return Tuple{}, fmt.Errorf("%w: %q is not a valid relation name", ErrorInvalidTuple, relation)
+	}
+
+	sub, err := ParseSubject(subject)
+	if err != nil {
+		return Tuple{}, err
+	}
+
+	return Tuple{Object: o, Relation: relation, Subject: sub}, nil
+}
@@ -0,0 +1,139 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// bloomMagic starts bloom filter files, followed by the version of the format.
+const bloomMagic = "PWBLOOM1"
+
+var errorInvalidBloom = errors.New("invalid bloom filter file")
+
+/*
+Bloom is a bloom filter of password hashes. It never misses a hash that was added, and wrongly
+reports hashes that weren't at the false positive rate it was sized for. Since SHA-1 hashes are
+already uniformly distributed, the bit positions are taken from the hash itself.
+*/
+type Bloom struct {
+	k    uint32
+	m    uint64
+	n    uint64
+	bits []byte
+}
+
+// NewBloom returns an empty filter sized for n hashes at the false positive rate fpRate.
+func NewBloom(n uint64, fpRate float64) *Bloom {
+	if n == 0 {
+		n = 1
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Bloom{k: k, m: m, bits: make([]byte, (m+7)/8)}
+}
+
+// positions calls fn with the k bit positions of hash, by double hashing two halves of it.
+func (b *Bloom) positions(hash Hash, fn func(pos uint64) bool) bool {
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !fn((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add adds hash to the filter.
+func (b *Bloom) Add(hash Hash) {
+	b.positions(hash, func(pos uint64) bool {
+		b.bits[pos/8] |= 1 << (pos % 8)
+		return true
+	})
+	b.n++
+}
+
+// Contains reports whether hash was probably added to the filter.
+func (b *Bloom) Contains(hash Hash) (bool, error) {
+	return b.positions(hash, func(pos uint64) bool {
+		return b.bits[pos/8]&(1<<(pos%8)) != 0
+	}), nil
+}
+
+// Len returns the number of hashes added to the filter.
+func (b *Bloom) Len() uint64 {
+	return b.n
+}
+
+// Size returns the size of the filter's bit array in bytes.
+func (b *Bloom) Size() int {
+	return len(b.bits)
+}
+
+// WriteTo writes the filter to w: the magic, k, m and n as big endian integers, then the bits.
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomMagic)+4+8+8)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[8:], b.k)
+	binary.BigEndian.PutUint64(header[12:], b.m)
+	binary.BigEndian.PutUint64(header[20:], b.n)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(b.bits)
+	return int64(n + m), err
+}
+
+// ReadBloom reads a filter written by WriteTo.
+func ReadBloom(r io.Reader) (*Bloom, error) {
+	header := make([]byte, len(bloomMagic)+4+8+8)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil || string(header[:8]) != bloomMagic {
+		return nil, errorInvalidBloom
+	}
+
+	b := &Bloom{
+		k: binary.BigEndian.Uint32(header[8:]),
+		m: binary.BigEndian.Uint64(header[12:]),
+		n: binary.BigEndian.Uint64(header[20:]),
+	}
+
+	if b.k == 0 || b.m == 0 {
+		return nil, errorInvalidBloom
+	}
+
+	b.bits = make([]byte, (b.m+7)/8)
+
+	_, err = io.ReadFull(r, b.bits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errorInvalidBloom, err)
+	}
+
+	return b, nil
+}
+
+// LoadBloom reads the filter in the file at path into memory.
+func LoadBloom(path string) (*Bloom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadBloom(bufio.NewReaderSize(f, 1<<20))
+}
@@ -0,0 +1,181 @@
+/*
+Package breach checks passwords against a corpus of passwords leaked in data breaches, such as
+Have I Been Pwned's Pwned Passwords, kept on local disk so that no password or hash of one ever
+leaves the service.
+
+The corpus is either the SHA-1 range files of the Pwned Passwords downloader, one file per
+five hex digit prefix holding the SUFFIX:COUNT lines of the hashes starting with it, or a bloom
+filter built from them by cmd/breach, which is much smaller at the cost of rare false positives.
+*/
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength is the number of hex digits of the hash that name its range file.
+const prefixLength = 5
+
+// Hash is the SHA-1 hash of a password, which the corpus is keyed by.
+type Hash [sha1.Size]byte
+
+// HashPassword returns the SHA-1 hash of password.
+func HashPassword(password string) Hash {
+	return sha1.Sum([]byte(password))
+}
+
+// Corpus is a set of breached password hashes.
+type Corpus interface {
+	Contains(hash Hash) (bool, error)
+}
+
+// Breached reports whether password appears in the corpus.
+func Breached(corpus Corpus, password string) (bool, error) {
+	return corpus.Contains(HashPassword(password))
+}
+
+/*
+parseLine parses a HASH:COUNT line of the corpus, where hash is the part of the hash following
+prefix, e.g. the suffix in a range file. Lines of the padded downloads have a count of 0.
+*/
+func parseLine(prefix, line string) (Hash, int, error) {
+	var hash Hash
+
+	hexHash, count, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok {
+		return hash, 0, fmt.Errorf("invalid corpus line %q", line)
+	}
+
+	b, err := hex.DecodeString(prefix + hexHash)
+	if err != nil || len(b) != len(hash) {
+		return hash, 0, fmt.Errorf("invalid hash in corpus line %q", line)
+	}
+	copy(hash[:], b)
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return hash, 0, fmt.Errorf("invalid count in corpus line %q", line)
+	}
+
+	return hash, n, nil
+}
+
+// RangeDir is a directory of Pwned Passwords range files. Hashes seen fewer than MinCount times are ignored.
+type RangeDir struct {
+	Dir      string
+	MinCount int
+}
+
+// OpenRangeDir returns the range files in dir, after checking that it holds them.
+func OpenRangeDir(dir string, minCount int) (RangeDir, error) {
+	_, err := os.Stat(filepath.Join(dir, "00000.txt"))
+	if err != nil {
+		return RangeDir{}, fmt.Errorf("%s doesn't hold Pwned Passwords range files: %w", dir, err)
+	}
+	return RangeDir{Dir: dir, MinCount: minCount}, nil
+}
+
+// Contains reads the range file of the hash's prefix, like the k-anonymity API answers a range query.
+func (d RangeDir) Contains(hash Hash) (bool, error) {
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := hexHash[:prefixLength], hexHash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(d.Dir, prefix+".txt"))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			return false, fmt.Errorf("invalid count in range file %s: %q", prefix, scanner.Text())
+		}
+		return n > 0 && n >= d.MinCount, nil
+	}
+
+	return false, scanner.Err()
+}
+
+/*
+Walk calls fn with every hash seen at least minCount times in the corpus at path, which is either
+a directory of range files or a single file of HASH:COUNT lines.
+*/
+func Walk(path string, minCount int, fn func(hash Hash) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return walkFile(path, "", minCount, fn)
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.txt"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		prefix := strings.TrimSuffix(filepath.Base(file), ".txt")
+		if len(prefix) != prefixLength {
+			continue
+		}
+
+		err = walkFile(file, prefix, minCount, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkFile(path, prefix string, minCount int, fn func(hash Hash) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return walkLines(f, prefix, minCount, fn)
+}
+
+func walkLines(r io.Reader, prefix string, minCount int, fn func(hash Hash) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		hash, count, err := parseLine(prefix, scanner.Text())
+		if err != nil {
+			return err
+		}
+
+		if count == 0 || count < minCount {
+			continue
+		}
+
+		err = fn(hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,102 @@
+package breach
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeRangeDir writes the range files of the passwords, seen count times each, and an empty 00000.txt.
+func writeRangeDir(t *testing.T, passwords map[string]int) string {
+	dir := t.TempDir()
+	files := map[string]string{"00000": ""}
+
+	for password, count := range passwords {
+		hash := HashPassword(password)
+		hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+		files[hexHash[:5]] += hexHash[5:] + ":" + strconv.Itoa(count) + "\r\n"
+	}
+
+	for prefix, lines := range files {
+		err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(lines), 0o644)
+		assert.NoError(t, err)
+	}
+
+	return dir
+}
+
+func TestRangeDir(t *testing.T) {
+	dir := writeRangeDir(t, map[string]int{"password": 9545824, "P@ssw0rd": 2, "padding": 0})
+
+	corpus, err := OpenRangeDir(dir, 1)
+	assert.NoError(t, err)
+
+	breached, err := Breached(corpus, "password")
+	assert.NoError(t, err)
+	assert.True(t, breached)
+
+	breached, _ = Breached(corpus, "padding")
+	assert.False(t, breached)
+
+	// Hashes whose range file is missing point at an incomplete download.
+	_, err = Breached(corpus, "tidy pelican remembers mangoes")
+	assert.Error(t, err)
+
+	corpus.MinCount = 10
+	breached, _ = Breached(corpus, "P@ssw0rd")
+	assert.False(t, breached)
+
+	_, err = OpenRangeDir(t.TempDir(), 1)
+	assert.Error(t, err)
+}
+
+func TestBloom(t *testing.T) {
+	passwords := map[string]int{"password": 9545824, "123456": 37359195, "P@ssw0rd": 2}
+	dir := writeRangeDir(t, passwords)
+
+	bloom := NewBloom(uint64(len(passwords)), 0.001)
+	err := Walk(dir, 3, func(hash Hash) error {
+		bloom.Add(hash)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), bloom.Len())
+
+	var buf bytes.Buffer
+	_, err = bloom.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	loaded, err := ReadBloom(&buf)
+	assert.NoError(t, err)
+
+	for password, want := range map[string]bool{"password": true, "123456": true, "P@ssw0rd": false} {
+		breached, err := Breached(loaded, password)
+		assert.NoError(t, err)
+		assert.Equal(t, want, breached, password)
+	}
+
+	_, err = ReadBloom(strings.NewReader("not a bloom filter"))
+	assert.Error(t, err)
+}
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	bloom := NewBloom(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		bloom.Add(HashPassword("breached-" + strconv.Itoa(i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if ok, _ := Breached(bloom, "safe-"+strconv.Itoa(i)); ok {
+			falsePositives++
+		}
+	}
+
+	assert.Less(t, falsePositives, 200)
+}
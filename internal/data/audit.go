@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+/*
+Actions recorded in the audit trail for admin operations on user accounts.
+*/
+const (
+	AuditUserUpdated        = "user.updated"
+	AuditUserDeleted        = "user.deleted"
+	AuditUserActivated      = "user.activated"
+	AuditUserDeactivated    = "user.deactivated"
+	AuditUserRoleAssigned   = "user.role_assigned"
+	AuditUserRoleRemoved    = "user.role_removed"
+	AuditUserGroupAdded     = "user.group_added"
+	AuditUserGroupRemoved   = "user.group_removed"
+	AuditUserPasswordReset  = "user.password_reset_forced"
+	AuditUserTokensRevoked  = "user.tokens_revoked"
+	AuditUserSessionRevoked = "user.session_revoked"
+	AuditUserImported       = "user.imported"
+	AuditUserUnlocked       = "user.unlocked"
+)
+
+/*
+AuditEntry records a single admin action against a user account.
+ActorID is the id of the admin that performed the action.
+*/
+type AuditEntry struct {
+	ID           int64                  `json:"id"`
+	ActorID      int64                  `json:"actor_id"`
+	Action       string                 `json:"action"`
+	TargetUserID int64                  `json:"target_user_id"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	CreatedAt    time.Time              `json:"CreatedAt"`
+}
+
+/*
+AuditModel struct
+*/
+type AuditModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+/*
+Insert writes an audit entry to the audit_log table.
+*/
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+
+	if entry.Details == nil {
+		details = []byte("{}")
+	}
+
+	query := `
+	INSERT INTO audit_log (actor_id, action, target_user_id, details, organization_id)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, CreatedAt`
+
+	args := []interface{}{
+		entry.ActorID, entry.Action, entry.TargetUserID, details, m.OrganizationID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+/*
+GetForUser retrieves the audit entries recorded against a user, newest first.
+*/
+func (m AuditModel) GetForUser(userID int64) ([]*AuditEntry, error) {
+	query := `
+	SELECT id, actor_id, action, target_user_id, details, CreatedAt
+	FROM audit_log
+	WHERE target_user_id = $1 AND organization_id = $2
+	ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var details []byte
+
+		err = rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.TargetUserID,
+			&details,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(details, &entry.Details)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
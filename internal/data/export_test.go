@@ -0,0 +1,21 @@
+package data
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportWriterCSVFormulas(t *testing.T) {
+	var buf bytes.Buffer
+
+	ew, err := NewExportWriter(&buf, ExportFormatCSV)
+	assert.NoError(t, err)
+
+	err = ew.Write(&User{ID: 7, FirstName: "=HYPERLINK(\"http://evil\")", LastName: "-Kamau", Username: "@jkamau", Email: "jkamau@example.com"})
+	assert.NoError(t, err)
+	assert.NoError(t, ew.Flush())
+
+	assert.Contains(t, buf.String(), `7,"'=HYPERLINK(""http://evil"")",'-Kamau,'@jkamau,jkamau@example.com,`)
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"rabitech.auth.app/internal/validator"
+)
+
+/*
+Filters holds the pagination and sorting parameters for list queries.
+SortSafelist contains the sort values the caller may use; a leading "-" sorts descending.
+*/
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+}
+
+/*
+UserFilters narrows down a user list query.
+Nil pointer fields and an empty Search are not applied.
+*/
+type UserFilters struct {
+	Filters
+	Search        string
+	Active        *bool
+	Role          *int
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+/*
+Metadata describes the page of results returned from a list query.
+*/
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records"`
+}
+
+// UserSortSafelist lists the columns a user list can be sorted on.
+var UserSortSafelist = []string{
+	"id", "firstname", "lastname", "email", "username", "CreatedAt",
+	"-id", "-firstname", "-lastname", "-email", "-username", "-CreatedAt",
+}
+
+// ValidateFilters checks the pagination and sort parameters.
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+}
+
+// ValidateUserFilters checks the pagination, sort and date range parameters of a user list.
+func ValidateUserFilters(v *validator.Validator, f UserFilters) {
+	ValidateFilters(v, f.Filters)
+
+	if f.CreatedAfter != nil && f.CreatedBefore != nil {
+		v.Check(!f.CreatedBefore.Before(*f.CreatedAfter), "created_before", "must not be before created_after")
+	}
+}
+
+/*
+sortColumn returns the column to sort by. It panics on values outside the safelist
+since those would otherwise end up interpolated into the query.
+*/
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
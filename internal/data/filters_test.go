@@ -0,0 +1,34 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/validator"
+)
+
+func TestCalculateMetadata(t *testing.T) {
+	metadata := calculateMetadata(45, 2, 20)
+
+	assert.Equal(t, Metadata{CurrentPage: 2, PageSize: 20, FirstPage: 1, LastPage: 3, TotalRecords: 45}, metadata)
+	assert.Equal(t, Metadata{}, calculateMetadata(0, 1, 20))
+}
+
+func TestValidateFilters(t *testing.T) {
+	v := validator.New()
+	ValidateFilters(v, Filters{Page: 0, PageSize: 500, Sort: "password_hash", SortSafelist: UserSortSafelist})
+
+	assert.Contains(t, v.Errors, "page")
+	assert.Contains(t, v.Errors, "page_size")
+	assert.Contains(t, v.Errors, "sort")
+}
+
+func TestFiltersSort(t *testing.T) {
+	f := Filters{Sort: "-CreatedAt", SortSafelist: UserSortSafelist}
+
+	assert.Equal(t, "CreatedAt", f.sortColumn())
+	assert.Equal(t, "DESC", f.sortDirection())
+
+	f.Sort = "id; DROP TABLE auth_user"
+	assert.Panics(t, func() { f.sortColumn() })
+}
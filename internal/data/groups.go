@@ -0,0 +1,573 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrorGroupCycle is returned when nesting a group would make it a member of itself.
+var ErrorGroupCycle = errors.New("group cycle")
+
+/*
+Group is a named set of users and other groups. Members of a subgroup are
+members of every group the subgroup is nested in.
+*/
+type Group struct {
+	ID          int64          `json:"id"`
+	DisplayName string         `json:"display_name"`
+	ExternalID  string         `json:"external_id,omitempty"`
+	Members     []*GroupMember `json:"members"`
+	Subgroups   []*Subgroup    `json:"groups"`
+	CreatedAt   time.Time      `json:"CreatedAt"`
+	UpdatedAt   time.Time      `json:"UpdatedAt"`
+	Version     int            `json:"-"`
+
+	// Roles is only loaded when the group is returned by the admin API.
+	Roles []string `json:"roles,omitempty"`
+}
+
+/*
+GroupMember is a user belonging to a group.
+*/
+type GroupMember struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+/*
+Subgroup is a group nested directly in another group.
+*/
+type Subgroup struct {
+	GroupID     int64  `json:"group_id"`
+	DisplayName string `json:"display_name"`
+}
+
+/*
+GroupModel struct
+*/
+type GroupModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+// memberIDs returns the user ids of the group members.
+func (g *Group) memberIDs() []int64 {
+	ids := make([]int64, 0, len(g.Members))
+	for _, member := range g.Members {
+		ids = append(ids, member.UserID)
+	}
+	return ids
+}
+
+/*
+replaceMembers sets the members of a group within tx. Ids that don't belong to a user of the organization are ignored.
+*/
+func replaceMembers(ctx context.Context, tx *sql.Tx, organizationID int64, group *Group) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = $1`, group.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO group_members (group_id, user_id)
+		SELECT $1, id FROM auth_user WHERE id = ANY($2) AND organization_id = $3
+		ON CONFLICT DO NOTHING`, group.ID, pq.Array(group.memberIDs()), organizationID)
+
+	return err
+}
+
+/*
+Insert creates a group along with its members.
+*/
+func (m GroupModel) Insert(group *Group) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO groups (display_name, external_id, organization_id)
+	VALUES ($1, NULLIF($2, ''), $3)
+	RETURNING id, CreatedAt, UpdatedAt, version`
+
+	err = tx.QueryRowContext(ctx, query, group.DisplayName, group.ExternalID, m.OrganizationID).Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt, &group.Version)
+	if err != nil {
+		return err
+	}
+
+	err = replaceMembers(ctx, tx, m.OrganizationID, group)
+	if err != nil {
+		return err
+	}
+
+	err = m.loadMembers(ctx, tx, []*Group{group})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+Get retrieves a group and its members.
+*/
+func (m GroupModel) Get(id int64) (*Group, error) {
+	groups, _, err := m.Query("id = $1", []interface{}{id}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) == 0 {
+		return nil, ErrorRecordNotFound
+	}
+
+	return groups[0], nil
+}
+
+/*
+Update saves the display name, external id and members of a group. The update only
+applies if the group is still at group.Version, otherwise ErrorEditConflict is returned.
+*/
+func (m GroupModel) Update(group *Group) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE groups
+	SET display_name = $1, external_id = NULLIF($2, ''), UpdatedAt = NOW(), version = version + 1
+	WHERE id = $3 AND version = $4 AND organization_id = $5
+	RETURNING UpdatedAt, version`
+
+	args := []interface{}{group.DisplayName, group.ExternalID, group.ID, group.Version, m.OrganizationID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&group.UpdatedAt, &group.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = replaceMembers(ctx, tx, m.OrganizationID, group)
+	if err != nil {
+		return err
+	}
+
+	err = m.loadMembers(ctx, tx, []*Group{group})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+Delete removes a group. Memberships are removed by the foreign key cascade.
+*/
+func (m GroupModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM groups WHERE id = $1 AND organization_id = $2`, id, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+/*
+Query returns a page of groups matching the condition, along with the total number of matches.
+The condition must only reference the groups table and use numbered placeholders for args.
+An empty condition matches every group.
+*/
+func (m GroupModel) Query(condition string, args []interface{}, offset, limit int) ([]*Group, int, error) {
+	if condition == "" {
+		condition = "TRUE"
+	}
+
+	args = append(args, m.OrganizationID)
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, display_name, COALESCE(external_id, ''), CreatedAt, UpdatedAt, version
+	FROM groups
+	WHERE organization_id = $%d AND (%s)
+	ORDER BY id
+	LIMIT %d OFFSET %d`, len(args), condition, limit, offset)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	groups := []*Group{}
+	for rows.Next() {
+		var group Group
+
+		err = rows.Scan(&total, &group.ID, &group.DisplayName, &group.ExternalID, &group.CreatedAt, &group.UpdatedAt, &group.Version)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		groups = append(groups, &group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	err = m.loadMembers(ctx, m.DB, groups)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return groups, total, nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadMembers fills in the member users and direct subgroups of each group.
+func (m GroupModel) loadMembers(ctx context.Context, q querier, groups []*Group) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Group, len(groups))
+	ids := make([]int64, 0, len(groups))
+	for _, group := range groups {
+		group.Members = []*GroupMember{}
+		group.Subgroups = []*Subgroup{}
+		byID[group.ID] = group
+		ids = append(ids, group.ID)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT group_members.group_id, auth_user.id, auth_user.username
+		FROM group_members
+		INNER JOIN auth_user ON auth_user.id = group_members.user_id
+		WHERE group_members.group_id = ANY($1)
+		ORDER BY auth_user.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupID int64
+		var member GroupMember
+
+		err = rows.Scan(&groupID, &member.UserID, &member.Username)
+		if err != nil {
+			return err
+		}
+
+		byID[groupID].Members = append(byID[groupID].Members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	subgroupRows, err := q.QueryContext(ctx, `
+		SELECT group_groups.parent_id, groups.id, groups.display_name
+		FROM group_groups
+		INNER JOIN groups ON groups.id = group_groups.child_id
+		WHERE group_groups.parent_id = ANY($1)
+		ORDER BY groups.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer subgroupRows.Close()
+
+	for subgroupRows.Next() {
+		var groupID int64
+		var subgroup Subgroup
+
+		err = subgroupRows.Scan(&groupID, &subgroup.GroupID, &subgroup.DisplayName)
+		if err != nil {
+			return err
+		}
+
+		byID[groupID].Subgroups = append(byID[groupID].Subgroups, &subgroup)
+	}
+
+	return subgroupRows.Err()
+}
+
+/*
+userGroupsCTE is a recursive common table expression selecting the ids of every group
+user $1 belongs to, either directly or through a group nested in it. UNION rather than
+UNION ALL stops the recursion should a cycle ever exist.
+*/
+const userGroupsCTE = `
+	user_groups(id) AS (
+		SELECT group_id FROM group_members WHERE user_id = $1
+		UNION
+		SELECT group_groups.parent_id
+		FROM group_groups
+		INNER JOIN user_groups ON user_groups.id = group_groups.child_id
+	)`
+
+/*
+subgroupsCTE selects the id of group $1 and of every group nested in it at any depth.
+*/
+const subgroupsCTE = `
+	subgroups(id) AS (
+		SELECT $1::BIGINT
+		UNION
+		SELECT group_groups.child_id
+		FROM group_groups
+		INNER JOIN subgroups ON subgroups.id = group_groups.parent_id
+	)`
+
+/*
+GetAll returns a page of groups ordered by id.
+*/
+func (m GroupModel) GetAll(filters Filters) ([]*Group, Metadata, error) {
+	groups, total, err := m.Query("", nil, filters.offset(), filters.limit())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return groups, calculateMetadata(total, filters.Page, filters.PageSize), nil
+}
+
+/*
+AddMember adds a user to a group. Adding an existing member is not an error, but the
+group and the user must both belong to the organization.
+*/
+func (m GroupModel) AddMember(groupID, userID int64) error {
+	query := `
+	INSERT INTO group_members (group_id, user_id)
+	SELECT groups.id, auth_user.id
+	FROM groups, auth_user
+	WHERE groups.id = $1 AND auth_user.id = $2
+	AND groups.organization_id = $3 AND auth_user.organization_id = $3
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, userID, m.OrganizationID)
+	return err
+}
+
+/*
+RemoveMember removes a user from a group.
+*/
+func (m GroupModel) RemoveMember(groupID, userID int64) error {
+	return m.deleteLink(`
+		DELETE FROM group_members
+		USING groups
+		WHERE groups.id = group_members.group_id AND groups.organization_id = $3
+		AND group_members.group_id = $1 AND group_members.user_id = $2`, groupID, userID, m.OrganizationID)
+}
+
+/*
+AddSubgroup nests child in parent. ErrorGroupCycle is returned if parent is child itself
+or already nested in child, since the membership graph must stay acyclic.
+*/
+func (m GroupModel) AddSubgroup(parentID, childID int64) error {
+	if parentID == childID {
+		return ErrorGroupCycle
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT count(*) FROM groups
+		WHERE id IN ($1, $2) AND organization_id = $3`, parentID, childID, m.OrganizationID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != 2 {
+		return ErrorRecordNotFound
+	}
+
+	// Serialise nesting changes so two concurrent inserts can't form a cycle together.
+	_, err = tx.ExecContext(ctx, `LOCK TABLE group_groups IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	WITH RECURSIVE ` + subgroupsCTE + `
+	SELECT EXISTS (SELECT 1 FROM subgroups WHERE id = $2)`
+
+	var cycle bool
+
+	err = tx.QueryRowContext(ctx, query, childID, parentID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+
+	if cycle {
+		return ErrorGroupCycle
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO group_groups (parent_id, child_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, parentID, childID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+RemoveSubgroup removes child from parent.
+*/
+func (m GroupModel) RemoveSubgroup(parentID, childID int64) error {
+	return m.deleteLink(`
+		DELETE FROM group_groups
+		USING groups
+		WHERE groups.id = group_groups.parent_id AND groups.organization_id = $3
+		AND group_groups.parent_id = $1 AND group_groups.child_id = $2`, parentID, childID, m.OrganizationID)
+}
+
+func (m GroupModel) deleteLink(query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+/*
+GetTransitiveMembers retrieves every user in a group, including the members of nested groups.
+*/
+func (m GroupModel) GetTransitiveMembers(groupID int64) ([]*GroupMember, error) {
+	query := `
+	WITH RECURSIVE ` + subgroupsCTE + `
+	SELECT DISTINCT auth_user.id, auth_user.username
+	FROM group_members
+	INNER JOIN auth_user ON auth_user.id = group_members.user_id
+	WHERE group_members.group_id IN (SELECT id FROM subgroups)
+	AND auth_user.organization_id = $2
+	ORDER BY auth_user.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, groupID, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*GroupMember{}
+	for rows.Next() {
+		var member GroupMember
+
+		err = rows.Scan(&member.UserID, &member.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+/*
+GetNamesForUser retrieves the display names of every group a user belongs to, directly or through nesting.
+*/
+func (m GroupModel) GetNamesForUser(userID int64) ([]string, error) {
+	query := `
+	WITH RECURSIVE ` + userGroupsCTE + `
+	SELECT display_name
+	FROM groups
+	WHERE id IN (SELECT id FROM user_groups) AND organization_id = $2
+	ORDER BY display_name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
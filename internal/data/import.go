@@ -0,0 +1,426 @@
+package data
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"rabitech.auth.app/internal/validator"
+)
+
+/*
+Formats accepted by NewImportReader.
+*/
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// ImportTimeout bounds how long a single import may hold its transaction open.
+const ImportTimeout = 10 * time.Minute
+
+// ErrorUnsupportedImportFormat is returned for formats other than csv and ndjson.
+var ErrorUnsupportedImportFormat = errors.New("unsupported import format")
+
+/*
+ImportRow is a single user read from an import file.
+Either Password (plaintext) or PasswordHash (an existing hash PasswordHasher verifies) may be set. When both are
+empty the user is created with a random password and has to set one through an invitation email.
+*/
+type ImportRow struct {
+	Line         int    `json:"-"`
+	FirstName    string `json:"firstname"`
+	LastName     string `json:"lastname"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	PasswordHash string `json:"password_hash"`
+	Active       *bool  `json:"active"`
+	Role         *int   `json:"role"`
+}
+
+/*
+ImportRowError describes why a line of the import file was not imported.
+*/
+type ImportRowError struct {
+	Line   int               `json:"line"`
+	Email  string            `json:"email,omitempty"`
+	Errors map[string]string `json:"errors"`
+}
+
+/*
+ImportedUser is a user created by ImportUsers.
+*/
+type ImportedUser struct {
+	ID       int64  `json:"id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Line     int    `json:"line"`
+}
+
+/*
+ImportResult summarises an import run.
+*/
+type ImportResult struct {
+	Imported []*ImportedUser  `json:"imported"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+/*
+ImportReader streams ImportRows from a CSV file with a header line or from NDJSON.
+*/
+type ImportReader struct {
+	format string
+	line   int
+	csv    *csv.Reader
+	header []string
+	json   *json.Decoder
+}
+
+// importCSVColumns lists the columns allowed in the CSV header.
+var importCSVColumns = []string{"firstname", "lastname", "username", "email", "password", "password_hash", "active", "role"}
+
+// NewImportReader returns a reader for the given format.
+func NewImportReader(r io.Reader, format string) (*ImportReader, error) {
+	switch format {
+	case ImportFormatCSV:
+		reader := csv.NewReader(r)
+		reader.TrimLeadingSpace = true
+
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("reading csv header: %w", err)
+		}
+
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+			if !validator.PermittedValue(header[i], importCSVColumns...) {
+				return nil, fmt.Errorf("csv header contains unknown column %q", header[i])
+			}
+		}
+
+		reader.FieldsPerRecord = len(header)
+
+		return &ImportReader{format: format, line: 1, csv: reader, header: header}, nil
+
+	case ImportFormatNDJSON:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+
+		return &ImportReader{format: format, json: decoder}, nil
+
+	default:
+		return nil, ErrorUnsupportedImportFormat
+	}
+}
+
+/*
+Next returns the next row. It returns io.EOF once the input is exhausted.
+A row that can't be parsed is returned along with a *ImportRowError so the caller can record it and continue.
+*/
+func (ir *ImportReader) Next() (*ImportRow, error) {
+	ir.line++
+
+	if ir.format == ImportFormatNDJSON {
+		var row ImportRow
+
+		err := ir.json.Decode(&row)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) {
+				// The decoder can't resynchronise after a syntax error.
+				return nil, fmt.Errorf("line %d: %w", ir.line, err)
+			}
+
+			return &ImportRow{Line: ir.line}, &ImportRowError{Line: ir.line, Errors: map[string]string{"row": err.Error()}}
+		}
+
+		row.Line = ir.line
+		return &row, nil
+	}
+
+	record, err := ir.csv.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) && errors.Is(parseError.Err, csv.ErrFieldCount) {
+			return &ImportRow{Line: ir.line}, &ImportRowError{Line: ir.line, Errors: map[string]string{"row": "wrong number of fields"}}
+		}
+
+		return nil, err
+	}
+
+	row := &ImportRow{Line: ir.line}
+	rowErrors := map[string]string{}
+
+	for i, column := range ir.header {
+		value := record[i]
+
+		switch column {
+		case "firstname":
+			row.FirstName = value
+		case "lastname":
+			row.LastName = value
+		case "username":
+			row.Username = value
+		case "email":
+			row.Email = value
+		case "password":
+			row.Password = value
+		case "password_hash":
+			row.PasswordHash = value
+		case "active":
+			if value == "" {
+				continue
+			}
+			active, err := strconv.ParseBool(value)
+			if err != nil {
+				rowErrors["active"] = "must be a boolean value"
+				continue
+			}
+			row.Active = &active
+		case "role":
+			if value == "" {
+				continue
+			}
+			role, err := strconv.Atoi(value)
+			if err != nil {
+				rowErrors["role"] = "must be an integer value"
+				continue
+			}
+			row.Role = &role
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		return row, &ImportRowError{Line: row.Line, Email: row.Email, Errors: rowErrors}
+	}
+
+	return row, nil
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("line %d: invalid row", e.Line)
+}
+
+// ValidateImportRow checks the fields of a row before it is loaded.
+func ValidateImportRow(v *validator.Validator, row *ImportRow) {
+	v.Check(row.FirstName != "", "firstname", "must be provided")
+	v.Check(row.LastName != "", "lastname", "must be provided")
+	v.Check(row.Username != "", "username", "must be provided")
+	v.Check(row.Email != "", "email", "must be provided")
+	v.Check(validator.Matches(row.Email, validator.EmailRX), "email", "must be a valid email address")
+
+	v.Check(row.Password == "" || row.PasswordHash == "", "password", "must not be provided together with password_hash")
+
+	if row.PasswordHash != "" {
+		v.Check(PasswordHasher.Recognizes(row.PasswordHash), "password_hash", "must be a hash of a supported algorithm")
+	}
+}
+
+/*
+checkImportRow validates row, whose email must not be one of seen, the lower-cased emails of the
+earlier rows, and checks its plaintext password with checkPassword.
+*/
+func checkImportRow(row *ImportRow, seen map[string]int, checkPassword PasswordCheck) *validator.Validator {
+	v := validator.New()
+	ValidateImportRow(v, row)
+
+	if line, exists := seen[strings.ToLower(row.Email)]; exists {
+		v.AddError("email", fmt.Sprintf("duplicates the email on line %d", line))
+	}
+
+	if row.Password != "" && checkPassword != nil {
+		user := &User{FirstName: row.FirstName, LastName: row.LastName, Username: row.Username, Email: row.Email}
+		if message := checkPassword(row.Password, user); message != "" {
+			v.AddError("password", message)
+		}
+	}
+
+	return v
+}
+
+// PasswordCheck returns why the new password of user is refused, or "" when it is accepted.
+type PasswordCheck func(password string, user *User) string
+
+/*
+ImportUsers validates the rows read from src, loads the valid ones into a temporary staging
+table with COPY and merges them into auth_user in a single transaction. Plaintext passwords must
+pass checkPassword, when it isn't nil. Rows whose email already exists, or which repeat an
+earlier email in the same file, ignoring case, are reported in the result rather than failing
+the whole import. Imported users get no role unless the row sets one.
+*/
+func (m UserModel) ImportUsers(ctx context.Context, src *ImportReader, checkPassword PasswordCheck) (*ImportResult, error) {
+	result := &ImportResult{
+		Imported: []*ImportedUser{},
+		Errors:   []ImportRowError{},
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE auth_user_import (
+			line INTEGER NOT NULL,
+			firstname TEXT NOT NULL,
+			lastname TEXT NOT NULL,
+			email TEXT NOT NULL,
+			username TEXT NOT NULL,
+			password_hash BYTEA NOT NULL,
+			password_placeholder BOOLEAN NOT NULL,
+			active BOOLEAN NOT NULL,
+			role INTEGER NOT NULL
+		) ON COMMIT DROP`)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("auth_user_import",
+		"line", "firstname", "lastname", "email", "username", "password_hash", "password_placeholder", "active", "role"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]int{}
+	staged := map[string]int{}
+
+	for {
+		row, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowError *ImportRowError
+		if errors.As(err, &rowError) {
+			result.Errors = append(result.Errors, *rowError)
+			continue
+		}
+		if err != nil {
+			stmt.Close()
+			return nil, err
+		}
+
+		v := checkImportRow(row, seen, checkPassword)
+		if !v.Valid() {
+			result.Errors = append(result.Errors, ImportRowError{Line: row.Line, Email: row.Email, Errors: v.Errors})
+			continue
+		}
+
+		seen[strings.ToLower(row.Email)] = row.Line
+
+		var p password
+		switch {
+		case row.PasswordHash != "":
+			p.hash = []byte(row.PasswordHash)
+		case row.Password != "":
+			err = p.Set(row.Password)
+		default:
+			err = p.SetPlaceholder()
+		}
+		if err != nil {
+			stmt.Close()
+			return nil, err
+		}
+
+		active := true
+		if row.Active != nil {
+			active = *row.Active
+		}
+
+		role := 0
+		if row.Role != nil {
+			role = *row.Role
+		}
+
+		_, err = stmt.ExecContext(ctx, row.Line, row.FirstName, row.LastName, row.Email, row.Username, p.hash, p.placeholder, active, role)
+		if err != nil {
+			stmt.Close()
+			return nil, err
+		}
+
+		staged[row.Email] = row.Line
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return nil, err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO auth_user (firstname, lastname, email, username, password_hash, password_placeholder, active, role, version, organization_id)
+		SELECT firstname, lastname, email, username, password_hash, password_placeholder, active, role, 1, $1
+		FROM auth_user_import
+		WHERE NOT EXISTS (
+			SELECT 1 FROM auth_user
+			WHERE auth_user.organization_id = $1 AND lower(auth_user.email) = lower(auth_user_import.email)
+		)
+		ORDER BY line
+		ON CONFLICT (organization_id, email) DO NOTHING
+		RETURNING id, email, username`, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var user ImportedUser
+
+		err = rows.Scan(&user.ID, &user.Email, &user.Username)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		user.Line = staged[user.Email]
+		delete(staged, user.Email)
+
+		result.Imported = append(result.Imported, &user)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+
+	for email, line := range staged {
+		result.Errors = append(result.Errors, ImportRowError{
+			Line:   line,
+			Email:  email,
+			Errors: map[string]string{"email": "user with email already exist"},
+		})
+	}
+
+	sort.Slice(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Line < result.Errors[j].Line
+	})
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/validator"
+)
+
+func TestImportReaderCSV(t *testing.T) {
+	in := "firstname,lastname,username,email,active\n" +
+		"Jane,Doe,jane,jane@example.com,false\n" +
+		"John,Doe,john,john@example.com,maybe\n" +
+		"Short,Row\n"
+
+	src, err := NewImportReader(strings.NewReader(in), ImportFormatCSV)
+	assert.NoError(t, err)
+
+	row, err := src.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, row.Line)
+	assert.Equal(t, "jane@example.com", row.Email)
+	assert.False(t, *row.Active)
+
+	_, err = src.Next()
+	var rowError *ImportRowError
+	assert.True(t, errors.As(err, &rowError))
+	assert.Equal(t, 3, rowError.Line)
+	assert.Contains(t, rowError.Errors, "active")
+
+	_, err = src.Next()
+	assert.True(t, errors.As(err, &rowError))
+	assert.Equal(t, 4, rowError.Line)
+
+	_, err = src.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestImportReaderNDJSON(t *testing.T) {
+	in := `{"firstname":"Jane","lastname":"Doe","username":"jane","email":"jane@example.com","role":2}` + "\n" +
+		`{"firstname":"John","unknown":true}` + "\n"
+
+	src, err := NewImportReader(strings.NewReader(in), ImportFormatNDJSON)
+	assert.NoError(t, err)
+
+	row, err := src.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *row.Role)
+
+	_, err = src.Next()
+	var rowError *ImportRowError
+	assert.True(t, errors.As(err, &rowError))
+	assert.Equal(t, 2, rowError.Line)
+
+	_, err = src.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestImportReaderUnknownColumn(t *testing.T) {
+	_, err := NewImportReader(strings.NewReader("email,nickname\n"), ImportFormatCSV)
+	assert.Error(t, err)
+
+	_, err = NewImportReader(strings.NewReader(""), "xlsx")
+	assert.ErrorIs(t, err, ErrorUnsupportedImportFormat)
+}
+
+func TestValidateImportRow(t *testing.T) {
+	v := validator.New()
+	ValidateImportRow(v, &ImportRow{Email: "not-an-email", Password: "secret", PasswordHash: "plain"})
+
+	assert.Contains(t, v.Errors, "firstname")
+	assert.Contains(t, v.Errors, "email")
+	assert.Contains(t, v.Errors, "password")
+	assert.Contains(t, v.Errors, "password_hash")
+}
+
+func TestValidateImportRowLegacyHash(t *testing.T) {
+	for _, hash := range []string{
+		"pbkdf2_sha256$260000$seasalt$JgZryXe2Ga8ysg6XbzkLpTdyPQrHqsinbL9BnnhgX4A=",
+		"$6$rounds=5000$seasalt$OrgAk.9mum/idX8PAI/T3DoTtmXTzvO35DVtdD49P1Qeh1WspI8FossSOFPCM0szo90vMyZMvEOGXFDvqHrc/1",
+		"3d16a57275cd9ebd331a06828128a95e:seasalt",
+	} {
+		v := validator.New()
+		ValidateImportRow(v, &ImportRow{FirstName: "Amina", LastName: "Otieno", Username: "amina", Email: "amina@example.com", PasswordHash: hash})
+		assert.True(t, v.Valid(), hash)
+	}
+}
+
+func TestCheckImportRow(t *testing.T) {
+	refuse := func(password string, user *User) string {
+		if strings.Contains(password, user.Username) {
+			return "must not contain your name, username or email"
+		}
+		return ""
+	}
+	seen := map[string]int{"jkamau@example.com": 2}
+
+	row := &ImportRow{Line: 3, FirstName: "James", LastName: "Kamau", Username: "jkamau", Email: "JKamau@example.com", Password: "jkamau2022"}
+	v := checkImportRow(row, seen, refuse)
+	assert.Equal(t, "duplicates the email on line 2", v.Errors["email"])
+	assert.Equal(t, "must not contain your name, username or email", v.Errors["password"])
+
+	row = &ImportRow{Line: 4, FirstName: "Amina", LastName: "Otieno", Username: "aotieno", Email: "aotieno@example.com", Password: "tidy pelican remembers mangoes"}
+	assert.True(t, checkImportRow(row, seen, refuse).Valid())
+	assert.True(t, checkImportRow(row, seen, nil).Valid())
+}
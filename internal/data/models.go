@@ -8,18 +8,54 @@ import (
 //  ErrorRecordNotFound record not found error
 var (
 	ErrorRecordNotFound = errors.New("record not found")
+	ErrorEditConflict   = errors.New("edit conflict")
 )
 
 // Models struct
 type Models struct {
-	User   UserModel
-	Tokens TokenModel
+	User          UserModel
+	Tokens        TokenModel
+	Audit         AuditModel
+	SCIMClients   SCIMClientModel
+	Groups        GroupModel
+	Roles         RoleModel
+	Permissions   PermissionModel
+	Organizations OrganizationModel
+	Relations     RelationModel
+	Policies      PolicyModel
+	Throttles     LoginThrottleModel
+	History       PasswordHistoryModel
 }
 
 //  NewModel return models.
+//  The models are scoped to the default organization, use ForOrganization to work in another one.
 func NewModel(db *sql.DB) Models {
 	return Models{
-		User:   UserModel{DB: db},
-		Tokens: TokenModel{DB: db},
+		User:          UserModel{DB: db, OrganizationID: DefaultOrganizationID},
+		Tokens:        TokenModel{DB: db},
+		Audit:         AuditModel{DB: db, OrganizationID: DefaultOrganizationID},
+		SCIMClients:   SCIMClientModel{DB: db, OrganizationID: DefaultOrganizationID},
+		Groups:        GroupModel{DB: db, OrganizationID: DefaultOrganizationID},
+		Roles:         RoleModel{DB: db, OrganizationID: DefaultOrganizationID},
+		Permissions:   PermissionModel{DB: db},
+		Organizations: OrganizationModel{DB: db},
+		Relations:     RelationModel{DB: db, OrganizationID: DefaultOrganizationID},
+		Policies:      PolicyModel{DB: db, OrganizationID: DefaultOrganizationID},
+		Throttles:     LoginThrottleModel{DB: db, OrganizationID: DefaultOrganizationID},
+		History:       PasswordHistoryModel{DB: db, OrganizationID: DefaultOrganizationID},
 	}
 }
+
+// ForOrganization returns a copy of the models that only see and create records of the organization.
+func (m Models) ForOrganization(organizationID int64) Models {
+	m.User.OrganizationID = organizationID
+	m.Audit.OrganizationID = organizationID
+	m.SCIMClients.OrganizationID = organizationID
+	m.Groups.OrganizationID = organizationID
+	m.Roles.OrganizationID = organizationID
+	m.Relations.OrganizationID = organizationID
+	m.Policies.OrganizationID = organizationID
+	m.Throttles.OrganizationID = organizationID
+	m.History.OrganizationID = organizationID
+	return m
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"rabitech.auth.app/internal/validator"
+)
+
+// DefaultOrganizationID is the organization created by the migrations. It owns everything
+// that existed before tenancy and is the only one whose admins can manage other organizations.
+const DefaultOrganizationID = 1
+
+var ErrorDuplicateSlug = errors.New("duplicate organization slug")
+
+// SlugRX restricts slugs to values that are valid as a DNS label.
+var SlugRX = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+/*
+Organization is a tenant. Users, groups, custom roles and SCIM clients belong to exactly one organization,
+and requests are routed to an organization by subdomain or the X-Tenant header.
+*/
+type Organization struct {
+	ID        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+/*
+ValidateOrganization checks an organization before it is inserted or updated.
+*/
+func ValidateOrganization(v *validator.Validator, organization *Organization) {
+	v.Check(organization.Slug != "", "slug", "must be provided")
+	v.Check(validator.Matches(organization.Slug, SlugRX), "slug", "must be lower-case letters, digits and dashes, at most 63 characters long")
+	v.Check(organization.Name != "", "name", "must be provided")
+	v.Check(len(organization.Name) <= 200, "name", "must not be more than 200 characters long")
+}
+
+/*
+OrganizationModel struct
+*/
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+/*
+Insert creates an organization.
+*/
+func (m OrganizationModel) Insert(organization *Organization) error {
+	query := `
+	INSERT INTO organizations (slug, name)
+	VALUES ($1, $2)
+	RETURNING id, CreatedAt, UpdatedAt`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, organization.Slug, organization.Name).Scan(&organization.ID, &organization.CreatedAt, &organization.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_slug_key"`:
+			return ErrorDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Get retrieves an organization by id.
+*/
+func (m OrganizationModel) Get(id int64) (*Organization, error) {
+	return m.getWhere(`id = $1`, id)
+}
+
+/*
+GetBySlug retrieves an organization by slug.
+*/
+func (m OrganizationModel) GetBySlug(slug string) (*Organization, error) {
+	return m.getWhere(`slug = $1`, slug)
+}
+
+func (m OrganizationModel) getWhere(where string, arg interface{}) (*Organization, error) {
+	query := `
+	SELECT id, slug, name, CreatedAt, UpdatedAt
+	FROM organizations
+	WHERE ` + where
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var organization Organization
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(&organization.ID, &organization.Slug, &organization.Name, &organization.CreatedAt, &organization.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &organization, nil
+}
+
+/*
+GetAll retrieves every organization.
+*/
+func (m OrganizationModel) GetAll() ([]*Organization, error) {
+	query := `
+	SELECT id, slug, name, CreatedAt, UpdatedAt
+	FROM organizations
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizations := []*Organization{}
+	for rows.Next() {
+		var organization Organization
+
+		err = rows.Scan(&organization.ID, &organization.Slug, &organization.Name, &organization.CreatedAt, &organization.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		organizations = append(organizations, &organization)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return organizations, nil
+}
+
+/*
+Update saves the slug and name of an organization.
+*/
+func (m OrganizationModel) Update(organization *Organization) error {
+	query := `
+	UPDATE organizations
+	SET slug = $1, name = $2, UpdatedAt = NOW()
+	WHERE id = $3
+	RETURNING UpdatedAt`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, organization.Slug, organization.Name, organization.ID).Scan(&organization.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_slug_key"`:
+			return ErrorDuplicateSlug
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Delete removes an organization along with its users, groups, roles and SCIM clients.
+The default organization can't be deleted.
+*/
+func (m OrganizationModel) Delete(id int64) error {
+	query := `
+	DELETE FROM organizations
+	WHERE id = $1 AND id <> $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, DefaultOrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+/*
+PasswordHistoryModel keeps the hashes of the passwords users had before their current one.
+UpdateUser adds the old hash whenever a password changes.
+*/
+type PasswordHistoryModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+/*
+Matches reports whether plaintextPassword matches one of the last n previous passwords of the
+user. Hashes an algorithm or pepper is no longer configured for are skipped.
+*/
+func (m PasswordHistoryModel) Matches(userID int64, plaintextPassword string, n int) (bool, error) {
+	if n <= 0 {
+		return false, nil
+	}
+
+	query := `
+		SELECT password_history.password_hash
+		FROM password_history
+		INNER JOIN auth_user ON auth_user.id = password_history.user_id
+		WHERE password_history.user_id = $1 AND auth_user.organization_id = $2
+		ORDER BY password_history.id DESC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, m.OrganizationID, n)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		err := rows.Scan(&hash)
+		if err != nil {
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, hash := range hashes {
+		match, err := PasswordHasher.Verify(plaintextPassword, string(hash))
+		if err == nil && match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Prune deletes all but the last keep previous passwords of the user.
+func (m PasswordHistoryModel) Prune(userID int64, keep int) error {
+	query := `
+		DELETE FROM password_history
+		WHERE user_id = $1
+		AND user_id IN (SELECT id FROM auth_user WHERE organization_id = $2)
+		AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id = $1
+			ORDER BY id DESC
+			LIMIT $3
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, m.OrganizationID, keep)
+	return err
+}
@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+/*
+Permission codes checked by the API. They are seeded by the migrations and can't be created at runtime.
+*/
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersWrite  = "users:write"
+	PermissionUsersDelete = "users:delete"
+	PermissionUsersImport = "users:import"
+	PermissionUsersExport = "users:export"
+	PermissionAuditRead   = "audit:read"
+	PermissionRolesRead   = "roles:read"
+	PermissionRolesWrite  = "roles:write"
+	PermissionSCIMManage  = "scim:manage"
+	PermissionGroupsRead  = "groups:read"
+	PermissionGroupsWrite = "groups:write"
+
+	PermissionOrganizationsManage = "organizations:manage"
+	PermissionAuthzCheck          = "authz:check"
+	PermissionAuthzWrite          = "authz:write"
+	PermissionPoliciesRead        = "policies:read"
+	PermissionPoliciesWrite       = "policies:write"
+)
+
+/*
+Permissions is a list of permission codes, such as "users:read".
+*/
+type Permissions []string
+
+// Include reports whether code is in the list.
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// unique returns the codes of p without duplicates, in their first order.
+func (p Permissions) unique() Permissions {
+	seen := make(map[string]bool, len(p))
+	codes := make(Permissions, 0, len(p))
+	for _, code := range p {
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+/*
+Permission describes a permission that roles can be granted.
+*/
+type Permission struct {
+	ID          int64  `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+/*
+PermissionModel struct
+*/
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+/*
+GetAll retrieves every permission.
+*/
+func (m PermissionModel) GetAll() ([]*Permission, error) {
+	query := `
+	SELECT id, code, description
+	FROM permissions
+	ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*Permission{}
+	for rows.Next() {
+		var permission Permission
+
+		err = rows.Scan(&permission.ID, &permission.Code, &permission.Description)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, &permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+/*
+GetAllForUser retrieves the effective permissions of a user, the union of the permissions
+of their own roles and of the roles granted to any group they belong to.
+*/
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+	WITH RECURSIVE ` + userGroupsCTE + `
+	SELECT DISTINCT permissions.code
+	FROM permissions
+	INNER JOIN role_permissions ON role_permissions.permission_id = permissions.id
+	WHERE role_permissions.role_id IN (` + userRoleIDs + `)
+	ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var code string
+
+		err = rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, code)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// setRolePermissions replaces the permissions granted to a role.
+func setRolePermissions(ctx context.Context, tx *sql.Tx, roleID int64, codes Permissions) error {
+	// Duplicates would insert a single row and read as an unknown code below.
+	codes = codes.unique()
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO role_permissions (role_id, permission_id)
+	SELECT $1, id FROM permissions WHERE code = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, roleID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if int(rowsAffected) != len(codes) {
+		return ErrorUnknownPermission
+	}
+
+	return nil
+}
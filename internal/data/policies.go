@@ -0,0 +1,188 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"rabitech.auth.app/internal/policy"
+)
+
+var ErrorDuplicatePolicyName = errors.New("duplicate policy name")
+
+/*
+PolicyModel stores the access policies of an organization.
+*/
+type PolicyModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+const policyColumns = `id, name, description, effect, actions, resources, condition, mode, version, CreatedAt, UpdatedAt`
+
+func scanPolicy(row interface{ Scan(...interface{}) error }) (*policy.Policy, error) {
+	p := policy.Policy{Source: policy.SourceDatabase}
+
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Effect, pq.Array(&p.Actions), pq.Array(&p.Resources), &p.Condition, &p.Mode, &p.Version, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Policies are validated before they are saved, this only compiles the condition.
+	err = p.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+/*
+Insert creates a policy. It must have been validated.
+*/
+func (m PolicyModel) Insert(p *policy.Policy) error {
+	query := `
+	INSERT INTO policies (organization_id, name, description, effect, actions, resources, condition, mode)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, version, CreatedAt, UpdatedAt`
+
+	args := []interface{}{m.OrganizationID, p.Name, p.Description, p.Effect, pq.Array(p.Actions), pq.Array(p.Resources), p.Condition, p.Mode}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&p.ID, &p.Version, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "policies_organization_id_name_key"`:
+			return ErrorDuplicatePolicyName
+		default:
+			return err
+		}
+	}
+
+	p.Source = policy.SourceDatabase
+	return nil
+}
+
+/*
+Get retrieves a policy by id.
+*/
+func (m PolicyModel) Get(id int64) (*policy.Policy, error) {
+	query := `
+	SELECT ` + policyColumns + `
+	FROM policies
+	WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	p, err := scanPolicy(m.DB.QueryRowContext(ctx, query, id, m.OrganizationID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+/*
+GetAll retrieves every policy of the organization.
+*/
+func (m PolicyModel) GetAll() ([]*policy.Policy, error) {
+	query := `
+	SELECT ` + policyColumns + `
+	FROM policies
+	WHERE organization_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []*policy.Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+/*
+Update saves a policy. ErrorEditConflict is returned if it was changed since it was read.
+*/
+func (m PolicyModel) Update(p *policy.Policy) error {
+	query := `
+	UPDATE policies
+	SET name = $1, description = $2, effect = $3, actions = $4, resources = $5, condition = $6, mode = $7,
+		version = version + 1, UpdatedAt = NOW()
+	WHERE id = $8 AND organization_id = $9 AND version = $10
+	RETURNING version, UpdatedAt`
+
+	args := []interface{}{p.Name, p.Description, p.Effect, pq.Array(p.Actions), pq.Array(p.Resources), p.Condition, p.Mode, p.ID, m.OrganizationID, p.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&p.Version, &p.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "policies_organization_id_name_key"`:
+			return ErrorDuplicatePolicyName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Delete removes a policy.
+*/
+func (m PolicyModel) Delete(id int64) error {
+	query := `
+	DELETE FROM policies
+	WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
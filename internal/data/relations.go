@@ -0,0 +1,379 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"rabitech.auth.app/internal/authz"
+)
+
+var (
+	ErrorNamespaceInUse = errors.New("namespace has relation tuples")
+	ErrorStaleSnapshot  = errors.New("tuples are older than the consistency token")
+)
+
+/*
+RelationModel stores the relation tuples and namespace configurations of an organization.
+*/
+type RelationModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+/*
+GetNamespaces retrieves every namespace configuration, keyed by name.
+*/
+func (m RelationModel) GetNamespaces() (map[string]*authz.Namespace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getNamespaces(ctx, m.DB, m.OrganizationID)
+}
+
+func getNamespaces(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, organizationID int64) (map[string]*authz.Namespace, error) {
+	query := `
+	SELECT config
+	FROM authz_namespaces
+	WHERE organization_id = $1`
+
+	rows, err := q.QueryContext(ctx, query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	namespaces := map[string]*authz.Namespace{}
+	for rows.Next() {
+		var config []byte
+
+		err = rows.Scan(&config)
+		if err != nil {
+			return nil, err
+		}
+
+		var namespace authz.Namespace
+
+		err = json.Unmarshal(config, &namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		namespaces[namespace.Name] = &namespace
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return namespaces, nil
+}
+
+/*
+PutNamespace creates or replaces a namespace configuration. ErrorNamespaceInUse is returned
+if a relation that still has tuples would be removed.
+*/
+func (m RelationModel) PutNamespace(namespace *authz.Namespace) error {
+	config, err := json.Marshal(namespace)
+	if err != nil {
+		return err
+	}
+
+	relations := make([]string, 0, len(namespace.Relations))
+	for name := range namespace.Relations {
+		relations = append(relations, name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Tuple writes lock the revision row, so none can slip in between the check and the update.
+	_, err = bumpRevision(ctx, tx, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM relation_tuples
+			WHERE organization_id = $1 AND namespace = $2 AND relation <> ALL($3)
+		)`, m.OrganizationID, namespace.Name, pq.Array(relations)).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrorNamespaceInUse
+	}
+
+	query := `
+	INSERT INTO authz_namespaces (organization_id, name, config)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (organization_id, name) DO UPDATE SET config = EXCLUDED.config, UpdatedAt = NOW()`
+
+	_, err = tx.ExecContext(ctx, query, m.OrganizationID, namespace.Name, config)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+DeleteNamespace removes a namespace configuration. ErrorNamespaceInUse is returned while
+objects of the namespace still have tuples.
+*/
+func (m RelationModel) DeleteNamespace(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = bumpRevision(ctx, tx, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	DELETE FROM authz_namespaces
+	WHERE organization_id = $1 AND name = $2
+	AND NOT EXISTS (SELECT 1 FROM relation_tuples WHERE organization_id = $1 AND namespace = $2)`
+
+	result, err := tx.ExecContext(ctx, query, m.OrganizationID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		var exists bool
+
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM authz_namespaces WHERE organization_id = $1 AND name = $2)`, m.OrganizationID, name).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return ErrorNamespaceInUse
+		}
+		return ErrorRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// bumpRevision increments the tuple revision of the organization, locking it until the transaction ends.
+func bumpRevision(ctx context.Context, tx *sql.Tx, organizationID int64) (int64, error) {
+	query := `
+	INSERT INTO authz_revisions (organization_id, revision)
+	VALUES ($1, 1)
+	ON CONFLICT (organization_id) DO UPDATE SET revision = authz_revisions.revision + 1
+	RETURNING revision`
+
+	var revision int64
+
+	err := tx.QueryRowContext(ctx, query, organizationID).Scan(&revision)
+	return revision, err
+}
+
+/*
+Write adds and deletes tuples in a single transaction and returns the new revision. Writing
+an existing tuple or deleting a missing one is not an error.
+*/
+func (m RelationModel) Write(writes, deletes []authz.Tuple) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	revision, err := bumpRevision(ctx, tx, m.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range deletes {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM relation_tuples
+			WHERE organization_id = $1 AND namespace = $2 AND object_id = $3 AND relation = $4
+			AND subject_namespace = $5 AND subject_object_id = $6 AND subject_relation = $7`,
+			m.OrganizationID, t.Object.Namespace, t.Object.ID, t.Relation, t.Subject.Namespace, t.Subject.ID, t.Subject.Relation)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, t := range writes {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO relation_tuples (organization_id, namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation, revision)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT DO NOTHING`,
+			m.OrganizationID, t.Object.Namespace, t.Object.ID, t.Relation, t.Subject.Namespace, t.Subject.ID, t.Subject.Relation, revision)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+/*
+TupleFilter selects tuples to read. Namespace is required, the other fields are optional.
+*/
+type TupleFilter struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+	Subject   string
+}
+
+/*
+Read retrieves the tuples matching the filter.
+*/
+func (m RelationModel) Read(filter TupleFilter, filters Filters) ([]authz.Tuple, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation
+	FROM relation_tuples
+	WHERE organization_id = $1 AND namespace = $2
+	AND (object_id = $3 OR $3 = '')
+	AND (relation = $4 OR $4 = '')
+	AND (subject_namespace || ':' || subject_object_id || CASE WHEN subject_relation = '' THEN '' ELSE '#' || subject_relation END = $5 OR $5 = '')
+	ORDER BY object_id, relation, subject_namespace, subject_object_id, subject_relation
+	LIMIT $6 OFFSET $7`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.OrganizationID, filter.Namespace, filter.ObjectID, filter.Relation, filter.Subject, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	total := 0
+	tuples := []authz.Tuple{}
+	for rows.Next() {
+		var t authz.Tuple
+
+		err = rows.Scan(&total, &t.Object.Namespace, &t.Object.ID, &t.Relation, &t.Subject.Namespace, &t.Subject.ID, &t.Subject.Relation)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		tuples = append(tuples, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return tuples, calculateMetadata(total, filters.Page, filters.PageSize), nil
+}
+
+/*
+Snapshot opens a read-only view of the tuples and namespaces of the organization. Every read
+through it sees the same committed state, so a check is never evaluated against half of a
+concurrent write. If minRevision, taken from a consistency token, is newer than the snapshot,
+ErrorStaleSnapshot is returned. The snapshot must be closed.
+*/
+func (m RelationModel) Snapshot(ctx context.Context, minRevision int64) (*RelationSnapshot, error) {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &RelationSnapshot{tx: tx, organizationID: m.OrganizationID}
+
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE((SELECT revision FROM authz_revisions WHERE organization_id = $1), 0)`, m.OrganizationID).Scan(&s.Revision)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if s.Revision < minRevision {
+		tx.Rollback()
+		return nil, ErrorStaleSnapshot
+	}
+
+	s.Namespaces, err = getNamespaces(ctx, tx, m.OrganizationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+/*
+RelationSnapshot is a consistent view of the tuples of an organization at Revision.
+It implements authz.TupleReader.
+*/
+type RelationSnapshot struct {
+	tx             *sql.Tx
+	organizationID int64
+
+	Revision   int64
+	Namespaces map[string]*authz.Namespace
+}
+
+// Subjects returns the subjects of the tuples object#relation@subject.
+func (s *RelationSnapshot) Subjects(ctx context.Context, object authz.Object, relation string) ([]authz.Subject, error) {
+	query := `
+	SELECT subject_namespace, subject_object_id, subject_relation
+	FROM relation_tuples
+	WHERE organization_id = $1 AND namespace = $2 AND object_id = $3 AND relation = $4`
+
+	rows, err := s.tx.QueryContext(ctx, query, s.organizationID, object.Namespace, object.ID, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []authz.Subject
+	for rows.Next() {
+		var subject authz.Subject
+
+		err = rows.Scan(&subject.Namespace, &subject.ID, &subject.Relation)
+		if err != nil {
+			return nil, err
+		}
+
+		subjects = append(subjects, subject)
+	}
+
+	return subjects, rows.Err()
+}
+
+// Close ends the snapshot.
+func (s *RelationSnapshot) Close() error {
+	return s.tx.Rollback()
+}
@@ -0,0 +1,421 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"rabitech.auth.app/internal/validator"
+)
+
+var (
+	ErrorDuplicateRoleName = errors.New("duplicate role name")
+	ErrorUnknownPermission = errors.New("unknown permission")
+	ErrorBuiltInRole       = errors.New("built-in roles can't be changed")
+)
+
+// RoleNameRX restricts role names to lower-case words separated by dashes or underscores.
+var RoleNameRX = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)*$`)
+
+/*
+Role is a named set of permissions that can be assigned to users.
+Built-in roles are seeded by the migrations, are shared by every organization and can't be
+changed or deleted. Other roles belong to the organization that created them.
+*/
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	BuiltIn     bool        `json:"built_in"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"CreatedAt"`
+}
+
+/*
+ValidateRole checks a role before it is inserted or updated.
+*/
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 50, "name", "must not be more than 50 characters long")
+	v.Check(validator.Matches(role.Name, RoleNameRX), "name", "must only contain lower-case letters, digits, dashes and underscores")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 characters long")
+
+	seen := map[string]bool{}
+	for _, code := range role.Permissions {
+		v.Check(!seen[code], "permissions", "must not contain duplicate values")
+		seen[code] = true
+	}
+}
+
+/*
+RoleModel struct
+*/
+type RoleModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+// checkNameAvailable returns ErrorDuplicateRoleName if a built-in role already uses the name,
+// since the unique index only covers roles of the same organization.
+func checkNameAvailable(ctx context.Context, tx *sql.Tx, name string) error {
+	var exists bool
+
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1 AND organization_id IS NULL)`, name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrorDuplicateRoleName
+	}
+
+	return nil
+}
+
+/*
+Insert creates a role along with its permissions.
+*/
+func (m RoleModel) Insert(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkNameAvailable(ctx, tx, role.Name)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO roles (name, description, organization_id)
+	VALUES ($1, $2, $3)
+	RETURNING id, CreatedAt`
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description, m.OrganizationID).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_organization_id_name_key"`:
+			return ErrorDuplicateRoleName
+		default:
+			return err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const roleColumns = `
+	roles.id, roles.name, roles.description, roles.built_in, roles.CreatedAt,
+	ARRAY(
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN role_permissions ON role_permissions.permission_id = permissions.id
+		WHERE role_permissions.role_id = roles.id
+		ORDER BY permissions.code
+	)`
+
+func scanRole(row interface{ Scan(...interface{}) error }) (*Role, error) {
+	var role Role
+
+	err := row.Scan(&role.ID, &role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt, pq.Array(&role.Permissions))
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+/*
+Get retrieves a role by id, if it is built-in or belongs to the organization.
+*/
+func (m RoleModel) Get(id int64) (*Role, error) {
+	return m.getWhere(`roles.id = $1`, id)
+}
+
+/*
+GetByName retrieves a role by name.
+*/
+func (m RoleModel) GetByName(name string) (*Role, error) {
+	return m.getWhere(`roles.name = $1`, name)
+}
+
+func (m RoleModel) getWhere(where string, arg interface{}) (*Role, error) {
+	query := `
+	SELECT ` + roleColumns + `
+	FROM roles
+	WHERE (roles.organization_id IS NULL OR roles.organization_id = $2) AND ` + where
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	role, err := scanRole(m.DB.QueryRowContext(ctx, query, arg, m.OrganizationID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return role, nil
+}
+
+/*
+GetAll retrieves the built-in roles and the roles of the organization.
+*/
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+	SELECT ` + roleColumns + `
+	FROM roles
+	WHERE roles.organization_id IS NULL OR roles.organization_id = $1
+	ORDER BY roles.id`
+
+	return m.query(query, m.OrganizationID)
+}
+
+/*
+userRoleIDs selects the ids of the roles user $1 has, either directly or through a group.
+It must be used within a query that defines userGroupsCTE.
+*/
+const userRoleIDs = `
+	SELECT role_id FROM user_roles WHERE user_id = $1
+	UNION
+	SELECT role_id FROM group_roles WHERE group_id IN (SELECT id FROM user_groups)`
+
+/*
+GetAllForUser retrieves the roles a user has, including those granted to their groups.
+*/
+func (m RoleModel) GetAllForUser(userID int64) ([]*Role, error) {
+	query := `
+	WITH RECURSIVE ` + userGroupsCTE + `
+	SELECT ` + roleColumns + `
+	FROM roles
+	WHERE roles.id IN (` + userRoleIDs + `)
+	ORDER BY roles.id`
+
+	return m.query(query, userID)
+}
+
+/*
+GetAllForGroup retrieves the roles granted directly to a group.
+*/
+func (m RoleModel) GetAllForGroup(groupID int64) ([]*Role, error) {
+	query := `
+	SELECT ` + roleColumns + `
+	FROM roles
+	INNER JOIN group_roles ON group_roles.role_id = roles.id
+	WHERE group_roles.group_id = $1
+	ORDER BY roles.id`
+
+	return m.query(query, groupID)
+}
+
+func (m RoleModel) query(query string, args ...interface{}) ([]*Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+/*
+Update changes the name, description and permissions of a role.
+*/
+func (m RoleModel) Update(role *Role) error {
+	if role.BuiltIn {
+		return ErrorBuiltInRole
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkNameAvailable(ctx, tx, role.Name)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE roles
+	SET name = $1, description = $2
+	WHERE id = $3 AND built_in = FALSE AND organization_id = $4`
+
+	result, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.ID, m.OrganizationID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_organization_id_name_key"`:
+			return ErrorDuplicateRoleName
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+Delete removes a role, unassigning it from every user.
+*/
+func (m RoleModel) Delete(id int64) error {
+	query := `
+	DELETE FROM roles
+	WHERE id = $1 AND built_in = FALSE AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+/*
+AssignToUser gives a user a role. Assigning a role the user already has is not an error.
+*/
+func (m RoleModel) AssignToUser(userID, roleID int64) error {
+	query := `
+	INSERT INTO user_roles (user_id, role_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, roleID)
+	return err
+}
+
+/*
+RemoveFromUser takes a role away from a user.
+*/
+func (m RoleModel) RemoveFromUser(userID, roleID int64) error {
+	query := `
+	DELETE FROM user_roles
+	WHERE user_id = $1 AND role_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+/*
+AssignToGroup grants a role to a group and so to every member of the group and its subgroups.
+*/
+func (m RoleModel) AssignToGroup(groupID, roleID int64) error {
+	query := `
+	INSERT INTO group_roles (group_id, role_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, roleID)
+	return err
+}
+
+/*
+RemoveFromGroup takes a role away from a group.
+*/
+func (m RoleModel) RemoveFromGroup(groupID, roleID int64) error {
+	query := `
+	DELETE FROM group_roles
+	WHERE group_id = $1 AND role_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, groupID, roleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/validator"
+)
+
+func TestPermissionsInclude(t *testing.T) {
+	permissions := Permissions{PermissionUsersRead, PermissionAuditRead}
+
+	assert.True(t, permissions.Include(PermissionUsersRead))
+	assert.False(t, permissions.Include(PermissionUsersWrite))
+	assert.False(t, Permissions(nil).Include(PermissionUsersRead))
+}
+
+func TestPermissionsUnique(t *testing.T) {
+	permissions := Permissions{PermissionUsersRead, PermissionAuditRead, PermissionUsersRead}
+
+	assert.Equal(t, Permissions{PermissionUsersRead, PermissionAuditRead}, permissions.unique())
+	assert.Empty(t, Permissions(nil).unique())
+}
+
+func TestValidateRole(t *testing.T) {
+	v := validator.New()
+	ValidateRole(v, &Role{Name: "support-tier_1", Permissions: Permissions{PermissionUsersRead}})
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	ValidateRole(v, &Role{Name: "Support Team", Permissions: Permissions{PermissionUsersRead, PermissionUsersRead}})
+	assert.Contains(t, v.Errors, "name")
+	assert.Contains(t, v.Errors, "permissions")
+}
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*
+SCIMClient is an identity provider allowed to provision users and groups through the SCIM API.
+SCIM clients authenticate with their own bearer tokens, which are not tied to any user.
+*/
+type SCIMClient struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+/*
+SCIMClientModel struct
+*/
+type SCIMClientModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+/*
+New creates a SCIM client and returns it along with its plaintext bearer token.
+Only the hash of the token is stored, so the plaintext can't be retrieved again.
+*/
+func (m SCIMClientModel) New(name string) (*SCIMClient, string, error) {
+	token, err := GenerateToken(0, 0, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+	INSERT INTO scim_clients (name, token_hash, organization_id)
+	VALUES ($1, $2, $3)
+	RETURNING id, CreatedAt`
+
+	client := &SCIMClient{Name: name}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, name, token.Hash, m.OrganizationID).Scan(&client.ID, &client.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, token.Plaintext, nil
+}
+
+/*
+GetForToken retrieves the SCIM client a bearer token belongs to and records that it was used.
+*/
+func (m SCIMClientModel) GetForToken(tokenPlaintext string) (*SCIMClient, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	UPDATE scim_clients
+	SET last_used_at = NOW()
+	WHERE token_hash = $1 AND organization_id = $2
+	RETURNING id, name, CreatedAt, last_used_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var client SCIMClient
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], m.OrganizationID).Scan(&client.ID, &client.Name, &client.CreatedAt, &client.LastUsedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &client, nil
+}
+
+/*
+GetAll retrieves every SCIM client.
+*/
+func (m SCIMClientModel) GetAll() ([]*SCIMClient, error) {
+	query := `
+	SELECT id, name, CreatedAt, last_used_at
+	FROM scim_clients
+	WHERE organization_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*SCIMClient{}
+	for rows.Next() {
+		var client SCIMClient
+
+		err = rows.Scan(&client.ID, &client.Name, &client.CreatedAt, &client.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, &client)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+/*
+Delete removes a SCIM client, revoking its token.
+*/
+func (m SCIMClientModel) Delete(id int64) error {
+	query := `
+	DELETE FROM scim_clients
+	WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+/*
+Kinds of keys failed logins are counted by.
+*/
+const (
+	ThrottleEmail = "email"
+	ThrottleIP    = "ip"
+)
+
+/*
+LoginThrottle counts the recent failed logins of an email address or client IP address.
+LockedUntil is set while an account is locked.
+*/
+type LoginThrottle struct {
+	Kind          string     `json:"kind"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// Locked reports whether the throttle locks logins at t.
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
+
+/*
+LoginThrottleModel struct
+*/
+type LoginThrottleModel struct {
+	DB             *sql.DB
+	OrganizationID int64
+}
+
+func throttleKey(kind, key string) string {
+	if kind == ThrottleEmail {
+		return strings.ToLower(strings.TrimSpace(key))
+	}
+	return key
+}
+
+/*
+Get retrieves the failed logins of a key. Keys without failures give a zero LoginThrottle.
+*/
+func (m LoginThrottleModel) Get(kind, key string) (*LoginThrottle, error) {
+	query := `
+	SELECT failures, last_failure_at, locked_until
+	FROM login_throttles
+	WHERE organization_id = $1 AND kind = $2 AND key = $3`
+
+	throttle := &LoginThrottle{Kind: kind, Key: throttleKey(kind, key)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, m.OrganizationID, kind, throttle.Key).Scan(&throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return throttle, nil
+}
+
+/*
+RecordFailure counts a failed login for a key. Failures older than window are forgotten. Once
+lockAfter failures are reached the key is locked for lockFor; a zero lockAfter never locks.
+*/
+func (m LoginThrottleModel) RecordFailure(kind, key string, window time.Duration, lockAfter int, lockFor time.Duration) (*LoginThrottle, error) {
+	query := `
+	INSERT INTO login_throttles AS t (organization_id, kind, key, failures, last_failure_at)
+	VALUES ($1, $2, $3, 1, $4)
+	ON CONFLICT (organization_id, kind, key) DO UPDATE
+	SET failures = CASE WHEN t.last_failure_at < $5 THEN 1 ELSE t.failures + 1 END,
+		last_failure_at = EXCLUDED.last_failure_at
+	RETURNING failures, last_failure_at, locked_until`
+
+	now := time.Now()
+	throttle := &LoginThrottle{Kind: kind, Key: throttleKey(kind, key)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, m.OrganizationID, kind, throttle.Key, now, now.Add(-window)).Scan(&throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockAfter == 0 || throttle.Failures < lockAfter || throttle.Locked(now) {
+		return throttle, nil
+	}
+
+	query = `
+	UPDATE login_throttles
+	SET locked_until = $4
+	WHERE organization_id = $1 AND kind = $2 AND key = $3
+	RETURNING locked_until`
+
+	err = m.DB.QueryRowContext(ctx, query, m.OrganizationID, kind, throttle.Key, now.Add(lockFor)).Scan(&throttle.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return throttle, nil
+}
+
+/*
+Reset forgets the failed logins of a key, unlocking it.
+*/
+func (m LoginThrottleModel) Reset(kind, key string) error {
+	query := `
+	DELETE FROM login_throttles
+	WHERE organization_id = $1 AND kind = $2 AND key = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, m.OrganizationID, kind, throttleKey(kind, key))
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -16,6 +17,9 @@ Defne constant for the scope
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeUnlock         = "unlock"
+	ScopePasswordChange = "password-change"
 )
 
 /*
@@ -28,6 +32,25 @@ type Token struct {
 	UserID    int       `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	Device    string    `json:"-"`
+}
+
+/*
+Session is an authentication token as its owner sees it: where it was issued and last used.
+The token itself is never shown again; sessions are revoked by id.
+*/
+type Session struct {
+	ID         int64      `json:"id"`
+	Hash       []byte     `json:"-"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Expiry     time.Time  `json:"expiry"`
+	Current    bool       `json:"current"`
 }
 
 /*
@@ -57,18 +80,38 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, nil
 }
 
+/*
+NewSession generates an authentication token for the user and records the client it was issued to.
+*/
+func (m TokenModel) NewSession(userID int64, ttl time.Duration, ip, userAgent, device string) (*Token, error) {
+	token, err := GenerateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	token.IP = ip
+	token.UserAgent = userAgent
+	token.Device = device
+
+	err = m.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
 /*
 Insert function makes a query to insert the token into database table
 */
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2,$3,$4)
+	INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, device)
+	VALUES ($1, $2,$3,$4, $5, $6, $7)
 	RETURNING user_id
 	`
 
 	args := []interface{}{
-		&token.Hash, token.UserID, &token.Expiry, &token.Scope,
+		&token.Hash, token.UserID, &token.Expiry, &token.Scope, token.IP, token.UserAgent, token.Device,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -103,6 +146,214 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 }
 
+/*
+GetExpiry returns when the token of the scope expires. Unknown and expired tokens give ErrorRecordNotFound.
+*/
+func (m TokenModel) GetExpiry(scope, tokenPlaintext string) (time.Time, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	SELECT expiry
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var expiry time.Time
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], scope).Scan(&expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrorRecordNotFound
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return expiry, nil
+}
+
+/*
+HasActiveForUser reports whether the user holds an unexpired token of the scope, e.g. a password
+reset link that was already emailed.
+*/
+func (m TokenModel) HasActiveForUser(scope string, userID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM tokens WHERE scope = $1 AND user_id = $2 AND expiry > NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, query, scope, userID).Scan(&exists)
+	return exists, err
+}
+
+/*
+Touch records that an authentication token was used from ip. Tokens used within the last minute
+are left alone so that busy clients don't rewrite the row on every request.
+*/
+func (m TokenModel) Touch(tokenPlaintext, ip string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	UPDATE tokens
+	SET last_used_at = NOW(), ip = $2
+	WHERE hash = $1 AND scope = $3
+	AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], ip, ScopeAuthentication)
+	return err
+}
+
+/*
+Extend moves the expiry of an authentication token to ttl from now once less than half of ttl is
+left, so that sessions in use don't expire. It returns the new expiry, or the zero time when the
+token was left alone.
+*/
+func (m TokenModel) Extend(tokenPlaintext string, ttl time.Duration) (time.Time, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	now := time.Now()
+
+	query := `
+	UPDATE tokens
+	SET expiry = $2
+	WHERE hash = $1 AND scope = $3 AND expiry > $4 AND expiry < $5
+	RETURNING expiry`
+
+	args := []interface{}{
+		tokenHash[:], now.Add(ttl), ScopeAuthentication, now, now.Add(ttl / 2),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var expiry time.Time
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&expiry)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+
+	return expiry, nil
+}
+
+/*
+DeleteToken deletes a single token of the scope, such as the authentication token of a session that logs out.
+*/
+func (m TokenModel) DeleteToken(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE hash = $1 AND scope = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:], scope)
+	return err
+}
+
+/*
+DeleteOtherSessionsForUser deletes the authentication tokens of a user except tokenPlaintext, signing
+out every other session, e.g. after the user changed their password.
+*/
+func (m TokenModel) DeleteOtherSessionsForUser(userID int64, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2 AND hash <> $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ScopeAuthentication, userID, tokenHash[:])
+	return err
+}
+
+/*
+GetSessionsForUser retrieves the unexpired authentication tokens of a user, most recently used first.
+*/
+func (m TokenModel) GetSessionsForUser(userID int64) ([]*Session, error) {
+	query := `
+	SELECT id, hash, device, user_agent, ip, CreatedAt, last_used_at, expiry
+	FROM tokens
+	WHERE user_id = $1 AND scope = $2 AND expiry > NOW()
+	ORDER BY COALESCE(last_used_at, CreatedAt) DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+
+		err = rows.Scan(
+			&session.ID,
+			&session.Hash,
+			&session.Device,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+/*
+DeleteSessionForUser revokes one authentication token of a user.
+*/
+func (m TokenModel) DeleteSessionForUser(id, userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE id = $1 AND user_id = $2 AND scope = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
 //  GenerateToken generates a new token. Takes userid argument, ttl duration for the token to expire and scope of the token.
 func GenerateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
 
@@ -4,12 +4,17 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"html"
+	"strings"
+	"sync"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lib/pq"
+	"rabitech.auth.app/internal/passwordhash"
+	"rabitech.auth.app/internal/validator"
 )
 
 // ErrorDuplicateEmail returned when duplicate email is provided
@@ -23,73 +28,124 @@ var AnonymusUser = &User{}
 
 // User struct with user properties
 type User struct {
-	ID        int64     `json:"id"`
-	FirstName string    `json:"firstname"`
-	LastName  string    `json:"lastname"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Active    bool      `json:"active"`
-	Role      int       `json:"role"`
-	CreatedAt time.Time `json:"CreatedAt"`
-	UpdatedAt time.Time `json:"UpdatedAt"`
-	Version   int       `json:"-"`
+	ID         int64     `json:"id"`
+	FirstName  string    `json:"firstname"`
+	LastName   string    `json:"lastname"`
+	Username   string    `json:"username"`
+	Email      string    `json:"email"`
+	Password   password  `json:"-"`
+	Active     bool      `json:"active"`
+	Role       int       `json:"role"`
+	ExternalID string    `json:"external_id,omitempty"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+	UpdatedAt  time.Time `json:"UpdatedAt"`
+	Version    int       `json:"-"`
+
+	// PasswordBreachedAt is when the user logged in with a password found in a data breach, cleared when it changes.
+	PasswordBreachedAt *time.Time `json:"password_breached_at,omitempty"`
+	// PasswordChangedAt is when the password was last set, password expiry counts from it.
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+
+	// Roles, Permissions and Groups are only loaded when they are returned to the client, e.g. on token introspection.
+	Roles       []string    `json:"roles,omitempty"`
+	Permissions Permissions `json:"permissions,omitempty"`
+	Groups      []string    `json:"groups,omitempty"`
+
+	OrganizationID int64 `json:"organization_id"`
+}
+
+// ValidateUser checks the details of a user before they are inserted or updated.
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.FirstName != "", "firstname", "must be provided")
+	v.Check(len(user.FirstName) <= 100, "firstname", "must not be more than 100 characters long")
+	v.Check(user.LastName != "", "lastname", "must be provided")
+	v.Check(len(user.LastName) <= 100, "lastname", "must not be more than 100 characters long")
+	v.Check(user.Username != "", "username", "must be provided")
+	v.Check(len(user.Username) <= 50, "username", "must not be more than 50 characters long")
+	v.Check(user.Email != "", "email", "must be provided")
+	v.Check(len(user.Email) <= 254, "email", "must not be more than 254 characters long")
+	v.Check(validator.Matches(user.Email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+// isDuplicateEmail reports whether err is the violation of the unique email of an organization.
+func isDuplicateEmail(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "auth_user_organization_id_email_key"
 }
 
 type password struct {
 	plaintext *string
 	hash      []byte
+	// placeholder marks a random password nobody knows, which must not take a slot of the password history.
+	placeholder bool
 }
 
 // UserModel struct fot user model
+// Every query only sees users of OrganizationID.
 type UserModel struct {
-	DB *sql.DB
+	DB             *sql.DB
+	OrganizationID int64
 }
 
 func (u *User) IsAnonymus() bool {
 	return u == AnonymusUser
 }
 
-func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+/*
+PasswordHasher hashes new passwords and verifies stored hashes. It hashes with argon2id and also
+verifies the bcrypt hashes of older accounts and the legacy hashes of imported ones; main replaces
+it with the configured one at startup.
+*/
+var PasswordHasher = passwordhash.New(passwordhash.DefaultArgon2id(), append([]passwordhash.Verifier{passwordhash.Bcrypt{Cost: 12}}, passwordhash.Legacy()...)...)
 
+func (p *password) Set(plaintextPassword string) error {
+	hash, err := PasswordHasher.Hash(plaintextPassword)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
 
 	p.plaintext = &plaintextPassword
-	p.hash = hash
+	p.hash = []byte(hash)
+	p.placeholder = false
 
 	return nil
 }
 
-func (p *password) MatchPassword(plaintextPassword string) (bool, error) {
-
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
-
+// SetPlaceholder sets a random password nobody knows, for accounts that are only used after a password reset or through single sign-on.
+func (p *password) SetPlaceholder() error {
+	token, err := GenerateToken(0, 0, "")
 	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
+		return err
+	}
 
+	err = p.Set(token.Plaintext)
+	if err != nil {
+		return err
 	}
 
-	return true, nil
+	p.placeholder = true
+	return nil
+}
+
+func (p *password) MatchPassword(plaintextPassword string) (bool, error) {
+	return PasswordHasher.Verify(plaintextPassword, string(p.hash))
+}
+
+// NeedsRehash reports whether the stored hash was made with an outdated algorithm or parameters.
+func (p *password) NeedsRehash() bool {
+	return PasswordHasher.NeedsRehash(string(p.hash))
 }
 
 func (m UserModel) InsertUser(user *User) error {
 	query := `
-	INSERT INTO auth_user (firstname, lastname, email, username, password_hash, active, role, version)
-	VALUES ($1, $2, $3, $4, $5, $6, 1, 1)
+	INSERT INTO auth_user (firstname, lastname, email, username, password_hash, active, role, version, organization_id, password_placeholder)
+	VALUES ($1, $2, $3, $4, $5, $6, 0, 1, $7, $8)
 	RETURNING id, CreatedAt, version
 	`
 
 	args := []interface{}{
-		user.FirstName, user.LastName, user.Email, user.Username, user.Password.hash, user.Active,
+		user.FirstName, user.LastName, user.Email, user.Username, user.Password.hash, user.Active, m.OrganizationID,
+		user.Password.placeholder,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -98,10 +154,11 @@ func (m UserModel) InsertUser(user *User) error {
 	fmt.Println("This code is reached")
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	user.OrganizationID = m.OrganizationID
 
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "auth_user_email_key"`:
+		case isDuplicateEmail(err):
 			return ErrorDuplicateEmail
 		default:
 			fmt.Println("I have an eror here. Kindly fix it")
@@ -111,14 +168,30 @@ func (m UserModel) InsertUser(user *User) error {
 	return nil
 }
 
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// MatchNoPassword takes as long as comparing a password with a stored hash, so that logins with
+// unknown emails can't be told apart from wrong passwords by their response time.
+func MatchNoPassword(plaintextPassword string) {
+	dummyHashOnce.Do(func() {
+		hash, _ := PasswordHasher.Hash("not the password of anyone")
+		dummyHash = []byte(hash)
+	})
+
+	PasswordHasher.Verify(plaintextPassword, string(dummyHash))
+}
+
 func (m UserModel) GetUserByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, firstname, lastname, username, email, password_hash, active
+		SELECT id, firstname, lastname, username, email, password_hash, active, COALESCE(role, 0), organization_id, password_changed_at
 		FROM auth_user
-		WHERE email = $1`
+		WHERE email = $1 AND organization_id = $2`
 	var user User
 	args := []interface{}{
-		email,
+		email, m.OrganizationID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -132,6 +205,9 @@ func (m UserModel) GetUserByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Active,
+		&user.Role,
+		&user.OrganizationID,
+		&user.PasswordChangedAt,
 	)
 
 	if err != nil {
@@ -147,73 +223,576 @@ func (m UserModel) GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByID retrieves a single user by id.
+func (m UserModel) GetUserByID(id int64) (*User, error) {
+	query := `
+		SELECT id, firstname, lastname, username, email, password_hash, active, COALESCE(role, 0), COALESCE(external_id, ''), CreatedAt, UpdatedAt, version, organization_id, password_breached_at, password_changed_at
+		FROM auth_user
+		WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, query, id, m.OrganizationID).Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Active,
+		&user.Role,
+		&user.ExternalID,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+		&user.OrganizationID,
+		&user.PasswordBreachedAt,
+		&user.PasswordChangedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+/*
+UpdateUser saves the user. Setting a new password moves the old hash to the password history,
+unless it was a placeholder, restarts the password's age and clears the mark of a breached one.
+*/
 func (m UserModel) UpdateUser(user *User) error {
 	query := `
+		WITH previous AS (
+			INSERT INTO password_history (user_id, password_hash)
+			SELECT id, password_hash FROM auth_user
+			WHERE $12 AND id = $10 AND organization_id = $11 AND password_hash <> $5 AND NOT password_placeholder
+		)
 		UPDATE auth_user
-		SET active = $1, version = $2, UpdatedAt = $3
-		WHERE id = $4
+		SET firstname = $1, lastname = $2, email = $3, username = $4, password_hash = $5, active = $6, role = $7, version = $8, UpdatedAt = $9,
+			password_breached_at = CASE WHEN $12 THEN NULL ELSE password_breached_at END,
+			password_changed_at = CASE WHEN $12 THEN NOW() ELSE password_changed_at END,
+			password_expiry_reminded_at = CASE WHEN $12 THEN NULL ELSE password_expiry_reminded_at END,
+			password_placeholder = CASE WHEN $12 THEN $13 ELSE password_placeholder END
+		WHERE id = $10 AND organization_id = $11
 		RETURNING id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	args := []interface{}{
-		user.Active, user.Version, user.UpdatedAt, user.ID,
+		user.FirstName, user.LastName, user.Email, user.Username, user.Password.hash,
+		user.Active, user.Role, user.Version, user.UpdatedAt, user.ID, m.OrganizationID,
+		user.Password.plaintext != nil, user.Password.placeholder,
 	}
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		switch {
+		case isDuplicateEmail(err):
+			return ErrorDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorRecordNotFound
+		default:
+			fmt.Println(err)
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (m UserModel) GetUsers() ([]*User, error) {
-	query := `SELECT * FROM auth_user`
+/*
+RehashPassword hashes the plaintext password of the user again with the current algorithm and
+parameters, after it matched the stored hash. Unlike UpdateUser it leaves the version alone, and it
+does nothing when the password was changed since the user was read.
+*/
+func (m UserModel) RehashPassword(user *User, plaintextPassword string) error {
+	oldHash := user.Password.hash
+
+	err := user.Password.Set(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE auth_user
+		SET password_hash = $1
+		WHERE id = $2 AND organization_id = $3 AND password_hash = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, user.Password.hash, user.ID, m.OrganizationID, oldHash)
+	return err
+}
+
+// FlagPasswordBreached marks the password of the user as found in a data breach, keeping the time it first was.
+func (m UserModel) FlagPasswordBreached(id int64) error {
+	query := `
+		UPDATE auth_user
+		SET password_breached_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND password_breached_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, m.OrganizationID)
+	return err
+}
+
+/*
+CountByPepperVersion counts the password hashes of the organization by the version of the pepper
+they were made with, 0 for those made without one.
+*/
+func (m UserModel) CountByPepperVersion() (map[int]int, error) {
+	query := `
+		SELECT COALESCE(substring(encode(password_hash, 'escape') from '^\$pepper\$v=([0-9]+)\$'), '0')::int AS version, count(*)
+		FROM auth_user
+		WHERE organization_id = $1
+		GROUP BY version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var version, count int
+		err := rows.Scan(&version, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[version] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// PasswordAge is the age of the password of a user whose roles make it expire.
+type PasswordAge struct {
+	UserID     int64
+	Email      string
+	Username   string
+	Roles      []string
+	ChangedAt  time.Time
+	RemindedAt *time.Time
+}
+
+// GetPasswordAges returns the password ages of the activated users of the organization holding any of the roles.
+func (m UserModel) GetPasswordAges(roles []string) ([]*PasswordAge, error) {
+	query := `
+		SELECT auth_user.id, auth_user.email, auth_user.username, array_agg(roles.name), auth_user.password_changed_at, auth_user.password_expiry_reminded_at
+		FROM auth_user
+		INNER JOIN user_roles ON user_roles.user_id = auth_user.id
+		INNER JOIN roles ON roles.id = user_roles.role_id
+		WHERE auth_user.organization_id = $1 AND auth_user.active AND roles.name = ANY($2)
+		GROUP BY auth_user.id
+		ORDER BY auth_user.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.OrganizationID, pq.Array(roles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ages := []*PasswordAge{}
+	for rows.Next() {
+		var age PasswordAge
+		err := rows.Scan(&age.UserID, &age.Email, &age.Username, pq.Array(&age.Roles), &age.ChangedAt, &age.RemindedAt)
+		if err != nil {
+			return nil, err
+		}
+		ages = append(ages, &age)
+	}
+
+	return ages, rows.Err()
+}
+
+// MarkPasswordExpiryReminded records that the user was reminded their password expires.
+func (m UserModel) MarkPasswordExpiryReminded(id int64) error {
+	query := `
+		UPDATE auth_user
+		SET password_expiry_reminded_at = NOW()
+		WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, m.OrganizationID)
+	return err
+}
+
+// SetExternalID records the id an external identity provider uses for the user.
+func (m UserModel) SetExternalID(user *User) error {
+	query := `
+		UPDATE auth_user
+		SET external_id = NULLIF($1, '')
+		WHERE id = $2 AND organization_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, user.ExternalID, user.ID, m.OrganizationID)
+	return err
+}
+
+/*
+GetAttributes retrieves the free-form attributes of a user, such as region or department.
+A user without attributes has an empty map.
+*/
+func (m UserModel) GetAttributes(userID int64) (map[string]interface{}, error) {
+	query := `
+		SELECT COALESCE(user_attributes.attributes, '{}')
+		FROM auth_user
+		LEFT JOIN user_attributes ON user_attributes.user_id = auth_user.id
+		WHERE auth_user.id = $1 AND auth_user.organization_id = $2`
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	fmt.Println("Get all users hit")
-	rows, err := m.DB.QueryContext(ctx, query)
-	fmt.Println("Get all users hit again")
+	var b []byte
+
+	err := m.DB.QueryRowContext(ctx, query, userID, m.OrganizationID).Scan(&b)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	attributes := map[string]interface{}{}
 
+	err = json.Unmarshal(b, &attributes)
 	if err != nil {
 		return nil, err
 	}
 
+	return attributes, nil
+}
+
+/*
+SetAttributes replaces the attributes of a user.
+*/
+func (m UserModel) SetAttributes(userID int64, attributes map[string]interface{}) error {
+	b, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_attributes (user_id, attributes)
+		SELECT id, $3 FROM auth_user WHERE id = $1 AND organization_id = $2
+		ON CONFLICT (user_id) DO UPDATE SET attributes = EXCLUDED.attributes`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, m.OrganizationID, b)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+/*
+QueryUsers returns a page of users matching the condition, along with the total number of matches.
+The condition must only reference the auth_user table and use numbered placeholders for args.
+An empty condition matches every user.
+*/
+func (m UserModel) QueryUsers(condition string, args []interface{}, offset, limit int) ([]*User, int, error) {
+	if condition == "" {
+		condition = "TRUE"
+	}
+
+	args = append(args, m.OrganizationID)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, firstname, lastname, email, username, active, COALESCE(role, 0), COALESCE(external_id, ''), CreatedAt, UpdatedAt, version, organization_id
+		FROM auth_user
+		WHERE organization_id = $%d AND (%s)
+		ORDER BY id
+		LIMIT %d OFFSET %d`, len(args), condition, limit, offset)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	defer rows.Close()
 
+	total := 0
 	users := []*User{}
 	for rows.Next() {
 		var user User
 		err = rows.Scan(
+			&total,
 			&user.ID,
 			&user.FirstName,
 			&user.LastName,
 			&user.Email,
-			&user.Password.hash,
 			&user.Username,
 			&user.Active,
 			&user.Role,
+			&user.ExternalID,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 			&user.Version,
+			&user.OrganizationID,
 		)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// DeleteUser removes a user. Tokens belonging to the user are removed by the foreign key cascade.
+func (m UserModel) DeleteUser(id int64) error {
+	query := `
+		DELETE FROM auth_user
+		WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, m.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// userFilterConditions returns the WHERE clause for a user list query of the organization and its arguments.
+// Conditions whose filter is unset collapse to true inside Postgres.
+func userFilterConditions(organizationID int64, filters UserFilters) (string, []interface{}) {
+	conditions := `
+		WHERE organization_id = $6
+		AND ($1 = '' OR firstname ILIKE '%' || $1 || '%' OR lastname ILIKE '%' || $1 || '%'
+			OR email ILIKE '%' || $1 || '%' OR username ILIKE '%' || $1 || '%')
+		AND ($2::boolean IS NULL OR active = $2)
+		AND ($3::integer IS NULL OR role = $3)
+		AND ($4::timestamptz IS NULL OR CreatedAt >= $4)
+		AND ($5::timestamptz IS NULL OR CreatedAt <= $5)`
+
+	args := []interface{}{
+		filters.Search, filters.Active, filters.Role, filters.CreatedAfter, filters.CreatedBefore, organizationID,
+	}
+
+	return conditions, args
+}
+
+// GetUsers returns a page of users matching the filters along with the pagination metadata.
+func (m UserModel) GetUsers(filters UserFilters) ([]*User, Metadata, error) {
+	conditions, args := userFilterConditions(m.OrganizationID, filters)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, firstname, lastname, email, username, active, COALESCE(role, 0), CreatedAt, UpdatedAt, version
+		FROM auth_user
+		%s
+		ORDER BY %s %s, id ASC
+		LIMIT $7 OFFSET $8`, conditions, filters.sortColumn(), filters.sortDirection())
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err = rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Email,
+			&user.Username,
+			&user.Active,
+			&user.Role,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
 		}
 
 		users = append(users, &user)
 	}
 	if err = rows.Err(); err != nil {
-		fmt.Println("Error here")
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
+/*
+UserSearchResult is a user matched by SearchUsers.
+Score combines the full-text rank with the best trigram similarity across the searched fields,
+and Highlights wraps the matching words of each field in <mark> tags, the rest of the field HTML escaped.
+*/
+type UserSearchResult struct {
+	User       *User             `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+/*
+ts_headline marks the matches with control characters rather than tags, since the fields are
+user controlled: highlight escapes the text before it adds the <mark> tags.
+*/
+const (
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", HighlightAll=true"
+)
+
+// highlight HTML escapes a ts_headline fragment and wraps its matches in <mark> tags.
+func highlight(fragment string) string {
+	var b strings.Builder
+	for {
+		before, rest, ok := strings.Cut(fragment, headlineStart)
+		b.WriteString(html.EscapeString(strings.ReplaceAll(before, headlineStop, "")))
+		if !ok {
+			return b.String()
+		}
+
+		match, after, _ := strings.Cut(rest, headlineStop)
+		b.WriteString("<mark>" + html.EscapeString(match) + "</mark>")
+		fragment = after
+	}
+}
+
+/*
+SearchUsers runs a full-text and fuzzy search over firstname, lastname, username and email.
+Full-text matches use the search_document tsvector column, and misspelled or partial
+input is matched through pg_trgm word similarity. Results are ordered by relevance.
+*/
+func (m UserModel) SearchUsers(term string, limit int) ([]*UserSearchResult, error) {
+	query := `
+		SELECT id, firstname, lastname, email, username, active, COALESCE(role, 0), CreatedAt, UpdatedAt, version,
+			ts_rank(search_document, query) + GREATEST(
+				word_similarity($1, firstname), word_similarity($1, lastname),
+				word_similarity($1, username), word_similarity($1, email)
+			) AS score,
+			ts_headline('simple', firstname || ' ' || lastname, query, $4),
+			ts_headline('simple', username, query, $4),
+			ts_headline('simple', email, query, $4)
+		FROM auth_user, plainto_tsquery('simple', $1) query
+		WHERE organization_id = $3
+			AND (search_document @@ query
+			OR $1 <% firstname OR $1 <% lastname OR $1 <% username OR $1 <% email)
+		ORDER BY score DESC, id ASC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, term, limit, m.OrganizationID, headlineOptions)
+	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	defer rows.Close()
+
+	results := []*UserSearchResult{}
+	for rows.Next() {
+		var user User
+		var name, username, email string
+
+		result := UserSearchResult{User: &user}
+
+		err = rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Email,
+			&user.Username,
+			&user.Active,
+			&user.Role,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Version,
+			&result.Score,
+			&name,
+			&username,
+			&email,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Highlights = map[string]string{
+			"name":     highlight(name),
+			"username": highlight(username),
+			"email":    highlight(email),
+		}
+
+		results = append(results, &result)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
+	return results, nil
 }
 
 /*
@@ -222,16 +801,17 @@ GetUserForToken retrieves a user associated with a token.
 func (m UserModel) GetUserForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
-	query := `SELECT auth_user.id, auth_user.firstname, auth_user.lastname, auth_user.username,auth_user.CreatedAt, auth_user.email, auth_user.password_hash, auth_user.active, auth_user.role
+	query := `SELECT auth_user.id, auth_user.firstname, auth_user.lastname, auth_user.username,auth_user.CreatedAt, auth_user.email, auth_user.password_hash, auth_user.active, auth_user.role, auth_user.version, auth_user.organization_id
 		FROM auth_user
 		INNER JOIN tokens
 		ON auth_user.id = tokens.user_id
 		WHERE tokens.hash = $1
 		AND tokens.scope = $2
-		AND tokens.expiry > $3`
+		AND tokens.expiry > $3
+		AND auth_user.organization_id = $4`
 
 	args := []interface{}{
-		tokenHash[:], tokenScope, time.Now(),
+		tokenHash[:], tokenScope, time.Now(), m.OrganizationID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -249,6 +829,8 @@ func (m UserModel) GetUserForToken(tokenScope, tokenPlaintext string) (*User, er
 		&user.Password.hash,
 		&user.Active,
 		&user.Role,
+		&user.Version,
+		&user.OrganizationID,
 	)
 
 	if err != nil {
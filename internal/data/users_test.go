@@ -0,0 +1,49 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"rabitech.auth.app/internal/validator"
+)
+
+func TestValidateUser(t *testing.T) {
+	v := validator.New()
+	ValidateUser(v, &User{FirstName: "James", LastName: "Kamau", Username: "jkamau", Email: "jkamau@example.com"})
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	ValidateUser(v, &User{FirstName: "", LastName: strings.Repeat("k", 101), Username: "jkamau", Email: "jkamau@"})
+	assert.Contains(t, v.Errors, "firstname")
+	assert.Contains(t, v.Errors, "lastname")
+	assert.Contains(t, v.Errors, "email")
+	assert.NotContains(t, v.Errors, "username")
+}
+
+func TestIsDuplicateEmail(t *testing.T) {
+	assert.True(t, isDuplicateEmail(&pq.Error{Code: "23505", Constraint: "auth_user_organization_id_email_key"}))
+	assert.False(t, isDuplicateEmail(&pq.Error{Code: "23505", Constraint: "roles_organization_id_name_key"}))
+	assert.False(t, isDuplicateEmail(errors.New("connection refused")))
+}
+
+func TestHighlight(t *testing.T) {
+	fragment := "<script>" + headlineStart + "James" + headlineStop + " Kamau & co"
+	assert.Equal(t, "&lt;script&gt;<mark>James</mark> Kamau &amp; co", highlight(fragment))
+
+	assert.Equal(t, "plain", highlight("plain"))
+	assert.Equal(t, "<mark>&lt;b&gt;</mark>", highlight(headlineStart+"<b>"))
+}
+
+func TestPasswordPlaceholder(t *testing.T) {
+	var p password
+
+	assert.NoError(t, p.SetPlaceholder())
+	assert.True(t, p.placeholder)
+	assert.NotEmpty(t, p.hash)
+
+	assert.NoError(t, p.Set("correct horse battery staple"))
+	assert.False(t, p.placeholder)
+}
@@ -0,0 +1,199 @@
+/*
+Package gateway holds the routing of the authenticating reverse proxy, which puts login in front of
+applications that have none. A JSON config file lists the routes: which host and path prefix each
+one matches, the upstream it proxies to and the roles or permissions it requires.
+*/
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrorInvalidConfig is wrapped by every error returned while loading a config.
+var ErrorInvalidConfig = errors.New("invalid gateway config")
+
+/*
+Route proxies the requests for Host, or any host when empty, whose path starts with PathPrefix to
+Upstream. Users need one of Roles and all of Permissions. Public routes are proxied without login.
+StripPrefix removes PathPrefix from the path sent upstream.
+*/
+type Route struct {
+	Host         string   `json:"host"`
+	PathPrefix   string   `json:"path_prefix"`
+	Upstream     string   `json:"upstream"`
+	StripPrefix  bool     `json:"strip_prefix"`
+	Organization string   `json:"organization"`
+	Roles        []string `json:"roles"`
+	Permissions  []string `json:"permissions"`
+	Public       bool     `json:"public"`
+
+	proxy *httputil.ReverseProxy
+}
+
+// Config is the gateway config file.
+type Config struct {
+	Routes []*Route `json:"routes"`
+}
+
+/*
+Load reads and validates the config file at path.
+*/
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidConfig, err)
+	}
+
+	if len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf("%w: no routes", ErrorInvalidConfig)
+	}
+
+	for i, route := range cfg.Routes {
+		err = route.init()
+		if err != nil {
+			return nil, fmt.Errorf("%w: route %d: %s", ErrorInvalidConfig, i, err)
+		}
+	}
+
+	return &cfg, nil
+}
+
+func (route *Route) init() error {
+	route.Host = strings.ToLower(route.Host)
+
+	if route.PathPrefix == "" {
+		route.PathPrefix = "/"
+	}
+	if !strings.HasPrefix(route.PathPrefix, "/") {
+		return errors.New("path_prefix must start with /")
+	}
+
+	upstream, err := url.Parse(route.Upstream)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return errors.New("upstream must be an http or https url")
+	}
+
+	route.proxy = httputil.NewSingleHostReverseProxy(upstream)
+
+	if route.StripPrefix {
+		director := route.proxy.Director
+		prefix := strings.TrimSuffix(route.PathPrefix, "/")
+
+		route.proxy.Director = func(r *http.Request) {
+			r.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+			r.URL.RawPath = ""
+			director(r)
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the route covers a request for host and the clean path p.
+func (route *Route) matches(host, p string) bool {
+	if route.Host != "" && route.Host != host {
+		return false
+	}
+
+	// Prefixes match whole path segments, /admin covers /admin/users but not /administrator.
+	prefix := strings.TrimSuffix(route.PathPrefix, "/")
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// cleanPath returns p with its . and .. segments resolved and repeated slashes removed, keeping a trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+/*
+Canonical reports whether the path of u is already clean: absolute, without . or .. segments,
+repeated slashes or dots encoded as %2e. Upstreams may resolve other paths differently from the
+gateway, so /public/../admin could reach a route the gateway didn't check, and such requests must
+be refused rather than proxied.
+*/
+func Canonical(u *url.URL) bool {
+	if strings.Contains(strings.ToLower(u.EscapedPath()), "%2e") {
+		return false
+	}
+	return strings.HasPrefix(u.Path, "/") && cleanPath(u.Path) == u.Path
+}
+
+/*
+Match returns the route for a request to host and the decoded path p, or nil. Routes for the host
+win over routes for any host, and then the longest path prefix wins. The path is cleaned first, see
+Canonical.
+*/
+func (cfg *Config) Match(host, p string) *Route {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	p = cleanPath(p)
+
+	var match *Route
+	for _, route := range cfg.Routes {
+		if !route.matches(host, p) {
+			continue
+		}
+
+		if match == nil || route.Host != "" && match.Host == "" ||
+			route.Host == match.Host && len(route.PathPrefix) > len(match.PathPrefix) {
+			match = route
+		}
+	}
+
+	return match
+}
+
+// ServeHTTP proxies the request upstream.
+func (route *Route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route.proxy.ServeHTTP(w, r)
+}
+
+/*
+StripIdentity removes the identity headers (every X-Auth-* header) a client sent, so upstreams can
+only see the ones the gateway sets.
+*/
+func StripIdentity(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Auth-") {
+			h.Del(name)
+		}
+	}
+}
+
+// RemoveCookie removes the cookie called name from the Cookie headers of r.
+func RemoveCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
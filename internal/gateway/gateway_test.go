@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAndMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.json")
+
+	err := os.WriteFile(path, []byte(`{"routes": [
+		{"upstream": "http://wiki:8080"},
+		{"path_prefix": "/admin", "upstream": "http://wiki:8080", "roles": ["admin"]},
+		{"host": "grafana.example.com", "upstream": "http://grafana:3000"},
+		{"host": "grafana.example.com", "path_prefix": "/public/", "upstream": "http://grafana:3000", "public": true}
+	]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		host, path string
+		want       int
+	}{
+		{"wiki.example.com", "/", 0},
+		{"wiki.example.com", "/admin", 1},
+		{"wiki.example.com", "/admin/users", 1},
+		{"wiki.example.com", "/administrator", 0},
+		{"Grafana.example.com:443", "/admin", 2},
+		{"grafana.example.com", "/public/img.png", 3},
+		{"grafana.example.com", "/public", 3},
+		{"grafana.example.com", "/public/../admin", 2},
+		{"wiki.example.com", "//admin", 1},
+		{"wiki.example.com", "/./admin/", 1},
+	}
+
+	for _, tt := range tests {
+		assert.Same(t, cfg.Routes[tt.want], cfg.Match(tt.host, tt.path), tt.host+tt.path)
+	}
+
+	err = os.WriteFile(path, []byte(`{"routes": [{"upstream": "wiki:8080"}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Load(path)
+	assert.ErrorIs(t, err, ErrorInvalidConfig)
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/", true},
+		{"/public/img.png", true},
+		{"/public/", true},
+		{"/public/.well-known", true},
+		{"/public/../admin", false},
+		{"/public/%2e%2e/admin", false},
+		{"/public/%2E%2E%2fadmin", false},
+		{"/public/..%2fadmin", false},
+		{"/public/./img.png", false},
+		{"//admin", false},
+		{"/public//img.png", false},
+		{"/%2eadmin", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		assert.Equal(t, tt.want, Canonical(r.URL), tt.target)
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.Header.Get("X-Auth-User-Id")))
+	}))
+	defer upstream.Close()
+
+	route := &Route{PathPrefix: "/wiki/", Upstream: upstream.URL, StripPrefix: true}
+	if !assert.NoError(t, route.init()) {
+		return
+	}
+
+	r := httptest.NewRequest("GET", "/wiki/pages/home", nil)
+	r.Header.Set("X-Auth-User-Id", "1")
+	StripIdentity(r.Header)
+
+	rr := httptest.NewRecorder()
+	route.ServeHTTP(rr, r)
+	assert.Equal(t, "/pages/home ", rr.Body.String())
+}
+
+func TestRemoveCookie(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "theme=dark; auth_token=secret; lang=en")
+
+	RemoveCookie(r, "auth_token")
+	assert.Equal(t, "theme=dark; lang=en", r.Header.Get("Cookie"))
+}
@@ -0,0 +1,102 @@
+package passwordhash
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+/*
+Argon2id hashes passwords with argon2id. Memory is in KiB. Argon2id is memory hard, so that
+guessing passwords on GPUs costs about as much memory per guess as it does on the server.
+*/
+type Argon2id struct {
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id uses 64 MiB, 3 passes and 4 lanes, the second recommendation of RFC 9106.
+func DefaultArgon2id() Argon2id {
+	return Argon2id{Memory: 64 * 1024, Time: 3, Parallelism: 4, SaltLength: 16, KeyLength: 32}
+}
+
+// argon2idHash is a parsed argon2id PHC string.
+type argon2idHash struct {
+	params Argon2id
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrorInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrorInvalidHash
+	}
+
+	var h argon2idHash
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Time, &h.params.Parallelism)
+	if err != nil || h.params.Time == 0 || h.params.Parallelism == 0 {
+		return nil, ErrorInvalidHash
+	}
+
+	h.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrorInvalidHash
+	}
+
+	h.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(h.key) == 0 {
+		return nil, ErrorInvalidHash
+	}
+
+	h.params.SaltLength = uint32(len(h.salt))
+	h.params.KeyLength = uint32(len(h.key))
+	return &h, nil
+}
+
+func (a Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a Argon2id) Hash(password []byte) (string, error) {
+	salt, err := randomSalt(int(a.SaltLength))
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey(password, salt, a.Time, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, a.Memory, a.Time, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify hashes password with the parameters of encoded, whatever the hasher's own are.
+func (a Argon2id) Verify(password []byte, encoded string) (bool, error) {
+	h, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey(password, h.salt, h.params.Time, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a Argon2id) Outdated(encoded string) bool {
+	h, err := parseArgon2id(encoded)
+	return err != nil || h.params != a
+}
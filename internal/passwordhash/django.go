@@ -0,0 +1,86 @@
+package passwordhash
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+/*
+DjangoPBKDF2SHA256 verifies the default hashes of Django, the base64 PBKDF2-HMAC-SHA256 key of the
+password and salt:
+
+	pbkdf2_sha256$<iterations>$<salt>$<key>
+*/
+type DjangoPBKDF2SHA256 struct{}
+
+func (DjangoPBKDF2SHA256) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "pbkdf2_sha256$")
+}
+
+func (DjangoPBKDF2SHA256) Verify(password []byte, encoded string) (bool, error) {
+	// "pbkdf2_sha256", iterations, salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 {
+		return false, ErrorInvalidHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false, ErrorInvalidHash
+	}
+
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false, ErrorInvalidHash
+	}
+
+	key := pbkdf2.Key(password, []byte(parts[2]), iterations, len(want), sha256.New)
+	return subtle.ConstantTimeCompare(key, want) == 1, nil
+}
+
+/*
+DjangoScrypt verifies the scrypt hashes of Django, the base64 scrypt key of the password and salt
+with the cost n, block size r and parallelism p:
+
+	scrypt$<n>$<salt>$<r>$<p>$<key>
+*/
+type DjangoScrypt struct{}
+
+func (DjangoScrypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "scrypt$")
+}
+
+func (DjangoScrypt) Verify(password []byte, encoded string) (bool, error) {
+	// "scrypt", n, salt, r, p, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, ErrorInvalidHash
+	}
+
+	var params [3]int
+	for i, part := range []string{parts[1], parts[3], parts[4]} {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 {
+			return false, ErrorInvalidHash
+		}
+		params[i] = n
+	}
+
+	want, err := base64.StdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, ErrorInvalidHash
+	}
+
+	key, err := scrypt.Key(password, []byte(parts[2]), params[0], params[1], params[2], len(want))
+	if err != nil {
+		return false, ErrorInvalidHash
+	}
+
+	return subtle.ConstantTimeCompare(key, want) == 1, nil
+}
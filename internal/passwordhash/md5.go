@@ -0,0 +1,55 @@
+package passwordhash
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+/*
+SaltedMD5 verifies salted MD5 hashes in the two common forms: Django's, the MD5 of the salt followed
+by the password, and the one of many PHP applications, the MD5 of the password followed by the salt:
+
+	md5$<salt>$<hex digest>
+	<hex digest>:<salt>
+
+MD5 is far too fast to protect passwords, these hashes are only verified to rehash them.
+*/
+type SaltedMD5 struct{}
+
+// parse returns the digest of encoded and the input it's the MD5 of, salt and password in their order.
+func (SaltedMD5) parse(password []byte, encoded string) (digest string, input []byte, ok bool) {
+	if rest := strings.TrimPrefix(encoded, "md5$"); rest != encoded {
+		salt, digest, ok := strings.Cut(rest, "$")
+		return digest, append([]byte(salt), password...), ok
+	}
+
+	digest, salt, ok := strings.Cut(encoded, ":")
+	return digest, append(append([]byte{}, password...), salt...), ok
+}
+
+func (m SaltedMD5) Recognizes(encoded string) bool {
+	digest, _, ok := m.parse(nil, encoded)
+	if !ok || len(digest) != 2*md5.Size {
+		return false
+	}
+
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+func (m SaltedMD5) Verify(password []byte, encoded string) (bool, error) {
+	digest, input, ok := m.parse(password, encoded)
+	if !ok {
+		return false, ErrorInvalidHash
+	}
+
+	want, err := hex.DecodeString(digest)
+	if err != nil || len(want) != md5.Size {
+		return false, ErrorInvalidHash
+	}
+
+	sum := md5.Sum(input)
+	return subtle.ConstantTimeCompare(sum[:], want) == 1, nil
+}
@@ -0,0 +1,141 @@
+/*
+Package passwordhash hashes passwords with a configurable algorithm and verifies the hashes of
+every algorithm it knows, so that the algorithm or its parameters can change while old hashes
+keep working until they are rehashed.
+
+Hashes are stored as strings naming their algorithm and parameters, in the PHC string format
+for argon2id:
+
+	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+
+and in the modular crypt format bcrypt always used:
+
+	$2a$12$<salt and hash>
+
+Hashes imported from other systems are verified in their own formats, see Legacy. Passwords can
+also be peppered before they are hashed, see Peppers.
+*/
+package passwordhash
+
+import (
+	"crypto/rand"
+	"errors"
+	"strconv"
+)
+
+// ErrorUnknownAlgorithm is returned for hashes no configured algorithm recognizes.
+var ErrorUnknownAlgorithm = errors.New("password hash of unknown algorithm")
+
+// ErrorInvalidHash is returned for hashes that can't be parsed.
+var ErrorInvalidHash = errors.New("invalid password hash")
+
+// Verifier verifies the hashes of one algorithm.
+type Verifier interface {
+	// Recognizes reports whether encoded is a hash of the algorithm.
+	Recognizes(encoded string) bool
+	// Verify reports whether password matches encoded.
+	Verify(password []byte, encoded string) (bool, error)
+}
+
+// Algorithm is a Verifier that also hashes new passwords.
+type Algorithm interface {
+	Verifier
+	// Hash returns the encoded hash of password, with a new random salt.
+	Hash(password []byte) (string, error)
+	// Outdated reports whether encoded, a hash the algorithm recognizes, uses other parameters than it does.
+	Outdated(encoded string) bool
+}
+
+// Hasher hashes passwords with its current algorithm and verifies the hashes of any of its algorithms.
+type Hasher struct {
+	current   Algorithm
+	verifiers []Verifier
+	peppers   Peppers
+}
+
+// New returns a hasher that hashes with current and also verifies the hashes of verifiers.
+func New(current Algorithm, verifiers ...Verifier) *Hasher {
+	return &Hasher{
+		current:   current,
+		verifiers: append([]Verifier{current}, verifiers...),
+	}
+}
+
+// Hash returns the encoded hash of password, peppered with the current pepper if there is one.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.peppers.Current == 0 {
+		return h.current.Hash([]byte(password))
+	}
+
+	hash, err := h.current.Hash(pepper(h.peppers.Secrets[h.peppers.Current], password))
+	if err != nil {
+		return "", err
+	}
+	return pepperPrefix + strconv.Itoa(h.peppers.Current) + hash, nil
+}
+
+// Verify reports whether password matches encoded, a hash of any of the hasher's algorithms.
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	version, inner, err := splitPepper(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	input := []byte(password)
+	if version != 0 {
+		secret, ok := h.peppers.Secrets[version]
+		if !ok {
+			return false, ErrorUnknownPepper
+		}
+		input = pepper(secret, password)
+	}
+
+	for _, v := range h.verifiers {
+		if v.Recognizes(inner) {
+			return v.Verify(input, inner)
+		}
+	}
+	return false, ErrorUnknownAlgorithm
+}
+
+// Recognizes reports whether encoded is a hash of any of the hasher's algorithms.
+func (h *Hasher) Recognizes(encoded string) bool {
+	_, inner, err := splitPepper(encoded)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range h.verifiers {
+		if v.Recognizes(inner) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+NeedsRehash reports whether encoded was made with another algorithm, other parameters or another
+pepper than the current ones.
+*/
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	version, inner, err := splitPepper(encoded)
+	if err != nil || version != h.peppers.Current {
+		return true
+	}
+	return !h.current.Recognizes(inner) || h.current.Outdated(inner)
+}
+
+/*
+Legacy returns the verifiers of the hashes of other systems users are imported from: Django's
+PBKDF2-SHA256 and scrypt, SHA-512 crypt and salted MD5. They only verify, a user's hash is replaced
+by one of the current algorithm at their first login.
+*/
+func Legacy() []Verifier {
+	return []Verifier{DjangoPBKDF2SHA256{}, DjangoScrypt{}, SHA512Crypt{}, SaltedMD5{}}
+}
+
+func randomSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	_, err := rand.Read(salt)
+	return salt, err
+}
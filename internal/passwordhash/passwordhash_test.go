@@ -0,0 +1,155 @@
+package passwordhash
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fastArgon2id keeps the tests quick, it's far too weak for real use.
+var fastArgon2id = Argon2id{Memory: 64, Time: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2id(t *testing.T) {
+	encoded, err := fastArgon2id.Hash([]byte("pa55word"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"), encoded)
+
+	match, err := fastArgon2id.Verify([]byte("pa55word"), encoded)
+	assert.NoError(t, err)
+	assert.True(t, match)
+
+	match, err = fastArgon2id.Verify([]byte("pa55worD"), encoded)
+	assert.NoError(t, err)
+	assert.False(t, match)
+
+	// Hashes made with other parameters still verify, but are outdated.
+	stronger := fastArgon2id
+	stronger.Time = 2
+	match, _ = stronger.Verify([]byte("pa55word"), encoded)
+	assert.True(t, match)
+	assert.True(t, stronger.Outdated(encoded))
+	assert.False(t, fastArgon2id.Outdated(encoded))
+
+	_, err = fastArgon2id.Verify([]byte("pa55word"), "$argon2id$v=19$m=64,t=1$c2FsdA$aGFzaA")
+	assert.ErrorIs(t, err, ErrorInvalidHash)
+}
+
+func TestHasher(t *testing.T) {
+	bcrypt := Bcrypt{Cost: 4}
+	old, err := bcrypt.Hash([]byte("pa55word"))
+	assert.NoError(t, err)
+
+	h := New(fastArgon2id, bcrypt)
+
+	// bcrypt hashes of existing users verify, and need to be rehashed with argon2id.
+	match, err := h.Verify("pa55word", old)
+	assert.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, h.NeedsRehash(old))
+
+	encoded, err := h.Hash("pa55word")
+	assert.NoError(t, err)
+	assert.False(t, h.NeedsRehash(encoded))
+
+	match, _ = h.Verify("wrong", encoded)
+	assert.False(t, match)
+
+	assert.True(t, New(bcrypt).NeedsRehash(strings.Replace(old, "$04$", "$05$", 1)))
+
+	_, err = h.Verify("pa55word", "md5:5f4dcc3b5aa765d61d8327deb882cf99")
+	assert.ErrorIs(t, err, ErrorUnknownAlgorithm)
+	assert.False(t, h.Recognizes("md5:5f4dcc3b5aa765d61d8327deb882cf99"))
+}
+
+func TestLegacy(t *testing.T) {
+	// Made with Python's hashlib and crypt, like Django and PHP make them.
+	for _, tt := range []struct {
+		verifier Verifier
+		password string
+		encoded  string
+	}{
+		{DjangoPBKDF2SHA256{}, "lètmein", "pbkdf2_sha256$1000$seasalt$JgZryXe2Ga8ysg6XbzkLpTdyPQrHqsinbL9BnnhgX4A="},
+		{DjangoScrypt{}, "lètmein", "scrypt$1024$seasalt$8$1$+qO2jTkVUbPNlniTkHY96ldSJKs4U0WQif8UbWlfO3wJDNhKOg+pPtDckiT6Zw0qkEvKIQ1MdONfGxsWrpoiNg=="},
+		{SaltedMD5{}, "lètmein", "md5$seasalt$3f86d0d3d465b7b458c231bf3555c0e3"},
+		{SaltedMD5{}, "lètmein", "3d16a57275cd9ebd331a06828128a95e:seasalt"},
+		{SHA512Crypt{}, "Hello world!", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{SHA512Crypt{}, "Hello world!", "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."},
+		{SHA512Crypt{}, "lètmein", "$6$rounds=1000$seasalt$OrgAk.9mum/idX8PAI/T3DoTtmXTzvO35DVtdD49P1Qeh1WspI8FossSOFPCM0szo90vMyZMvEOGXFDvqHrc/1"},
+	} {
+		assert.True(t, tt.verifier.Recognizes(tt.encoded), tt.encoded)
+
+		match, err := tt.verifier.Verify([]byte(tt.password), tt.encoded)
+		assert.NoError(t, err, tt.encoded)
+		assert.True(t, match, tt.encoded)
+
+		match, err = tt.verifier.Verify([]byte("letmein"), tt.encoded)
+		assert.NoError(t, err, tt.encoded)
+		assert.False(t, match, tt.encoded)
+
+		// Imported users are moved to the current algorithm at their first login.
+		assert.True(t, New(fastArgon2id, Legacy()...).NeedsRehash(tt.encoded))
+	}
+
+	assert.False(t, SaltedMD5{}.Recognizes("not:a digest"))
+
+	_, err := DjangoPBKDF2SHA256{}.Verify([]byte("lètmein"), "pbkdf2_sha256$many$seasalt$JgZr")
+	assert.ErrorIs(t, err, ErrorInvalidHash)
+}
+
+func TestPeppers(t *testing.T) {
+	secret1 := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32)))
+	secret2 := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", 32)))
+
+	peppers, err := ParsePeppers("# retired at the next rotation\n1:" + secret1 + "\n2:" + secret2 + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, peppers.Current)
+
+	_, err = ParsePeppers("0:" + secret1)
+	assert.Error(t, err)
+	_, err = ParsePeppers("1:c2hvcnQ=")
+	assert.Error(t, err)
+	_, err = ParsePeppers("1:" + secret1 + " 1:" + secret2)
+	assert.Error(t, err)
+
+	plain := New(fastArgon2id, Bcrypt{Cost: 4})
+	unpeppered, err := plain.Hash("pa55word")
+	assert.NoError(t, err)
+
+	v1, err := plain.WithPeppers(Peppers{Current: 1, Secrets: peppers.Secrets})
+	assert.NoError(t, err)
+	old, err := v1.Hash("pa55word")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(old, "$pepper$v=1$argon2id$"), old)
+	assert.Equal(t, 1, PepperVersion(old))
+
+	h, err := plain.WithPeppers(peppers)
+	assert.NoError(t, err)
+	encoded, err := h.Hash("pa55word")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, PepperVersion(encoded))
+	assert.True(t, h.Recognizes(encoded))
+	assert.False(t, h.NeedsRehash(encoded))
+
+	// Unpeppered hashes and those of older peppers verify, and are re-peppered.
+	for _, hash := range []string{unpeppered, old, encoded} {
+		match, err := h.Verify("pa55word", hash)
+		assert.NoError(t, err)
+		assert.True(t, match, hash)
+
+		match, err = h.Verify("pa55worD", hash)
+		assert.NoError(t, err)
+		assert.False(t, match, hash)
+	}
+	assert.True(t, h.NeedsRehash(unpeppered))
+	assert.True(t, h.NeedsRehash(old))
+
+	// The pepper is needed to verify peppered hashes.
+	_, err = plain.Verify("pa55word", encoded)
+	assert.ErrorIs(t, err, ErrorUnknownPepper)
+	assert.True(t, plain.NeedsRehash(encoded))
+
+	_, err = plain.WithPeppers(Peppers{Current: 3, Secrets: peppers.Secrets})
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package passwordhash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	pepperPrefix       = "$pepper$v="
+	pepperMinSecretLen = 32
+)
+
+// ErrorUnknownPepper is returned for hashes peppered with a version no configured pepper has.
+var ErrorUnknownPepper = errors.New("password hash peppered with an unknown pepper version")
+
+/*
+Peppers are the secret keys passwords are HMACed with before they are hashed, by version. They are
+kept out of the database, so that hashes leaked with it can't be cracked without them. New hashes
+use the Current version, 0 for none, and record it:
+
+	$pepper$v=2$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+
+Hashes of older versions keep verifying as long as their pepper is configured, and are rehashed
+with the current one at their user's next login.
+*/
+type Peppers struct {
+	Current int
+	Secrets map[int][]byte
+}
+
+/*
+ParsePeppers parses peppers written as "<version>:<secret>" separated by white space, the secrets
+base64 encoded and at least 32 bytes long. Lines starting with # are comments. The highest version
+is the current one.
+*/
+func ParsePeppers(s string) (Peppers, error) {
+	peppers := Peppers{Secrets: map[int][]byte{}}
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		for _, field := range strings.Fields(line) {
+			value, encoded, ok := strings.Cut(field, ":")
+			version, err := strconv.Atoi(value)
+			if !ok || err != nil || version < 1 {
+				return Peppers{}, fmt.Errorf("invalid pepper %q, must be <version>:<base64 secret> with a version of at least 1", value)
+			}
+
+			secret, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(secret) < pepperMinSecretLen {
+				return Peppers{}, fmt.Errorf("secret of pepper %d must be base64 encoded and at least %d bytes long", version, pepperMinSecretLen)
+			}
+
+			if _, ok := peppers.Secrets[version]; ok {
+				return Peppers{}, fmt.Errorf("duplicate pepper %d", version)
+			}
+			peppers.Secrets[version] = secret
+
+			if version > peppers.Current {
+				peppers.Current = version
+			}
+		}
+	}
+
+	return peppers, nil
+}
+
+// LoadPeppers parses the peppers of the file at path.
+func LoadPeppers(path string) (Peppers, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Peppers{}, err
+	}
+	return ParsePeppers(string(content))
+}
+
+/*
+WithPeppers returns a copy of h that peppers new hashes with the current pepper of peppers and
+verifies the hashes of any of them.
+*/
+func (h *Hasher) WithPeppers(peppers Peppers) (*Hasher, error) {
+	if peppers.Current != 0 {
+		if _, ok := peppers.Secrets[peppers.Current]; !ok {
+			return nil, fmt.Errorf("current pepper %d isn't configured", peppers.Current)
+		}
+	}
+
+	peppered := *h
+	peppered.peppers = peppers
+	return &peppered, nil
+}
+
+// Peppered reports whether h peppers new hashes.
+func (h *Hasher) Peppered() bool {
+	return h.peppers.Current != 0
+}
+
+// pepper returns the HMAC-SHA256 of password keyed with secret, base64 encoded so bcrypt takes it whole.
+func pepper(secret []byte, password string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+
+	sum := mac.Sum(nil)
+	encoded := make([]byte, base64.RawStdEncoding.EncodedLen(len(sum)))
+	base64.RawStdEncoding.Encode(encoded, sum)
+	return encoded
+}
+
+// splitPepper returns the pepper version of encoded, 0 for unpeppered hashes, and the hash inside it.
+func splitPepper(encoded string) (int, string, error) {
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		return 0, encoded, nil
+	}
+
+	value, inner, ok := strings.Cut(strings.TrimPrefix(encoded, pepperPrefix), "$")
+	version, err := strconv.Atoi(value)
+	if !ok || err != nil || version < 1 {
+		return 0, "", ErrorInvalidHash
+	}
+	return version, "$" + inner, nil
+}
+
+// PepperVersion returns the version of the pepper of encoded, 0 for hashes that aren't peppered.
+func PepperVersion(encoded string) int {
+	version, _, err := splitPepper(encoded)
+	if err != nil {
+		return 0
+	}
+	return version
+}
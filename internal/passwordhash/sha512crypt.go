@@ -0,0 +1,161 @@
+package passwordhash
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+)
+
+const (
+	sha512CryptPrefix        = "$6$"
+	sha512CryptRoundsPrefix  = "rounds="
+	sha512CryptDefaultRounds = 5000
+	sha512CryptMinRounds     = 1000
+	sha512CryptMaxRounds     = 999999999
+	sha512CryptMaxSalt       = 16
+)
+
+// cryptAlphabet is the base64 alphabet of crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+/*
+SHA512Crypt verifies the SHA-512 hashes of crypt(3), which PHP's crypt() and Linux's shadow files
+use, as specified by Ulrich Drepper:
+
+	$6$<salt>$<hash>
+	$6$rounds=<rounds>$<salt>$<hash>
+*/
+type SHA512Crypt struct{}
+
+func (SHA512Crypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, sha512CryptPrefix)
+}
+
+func (SHA512Crypt) Verify(password []byte, encoded string) (bool, error) {
+	rest := strings.TrimPrefix(encoded, sha512CryptPrefix)
+
+	rounds, custom := sha512CryptDefaultRounds, false
+	if strings.HasPrefix(rest, sha512CryptRoundsPrefix) {
+		value, after, ok := strings.Cut(strings.TrimPrefix(rest, sha512CryptRoundsPrefix), "$")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil {
+			return false, ErrorInvalidHash
+		}
+		rounds, custom, rest = n, true, after
+	}
+
+	salt, _, ok := strings.Cut(rest, "$")
+	if !ok {
+		return false, ErrorInvalidHash
+	}
+
+	computed := sha512Crypt(password, []byte(salt), rounds, custom)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(encoded)) == 1, nil
+}
+
+// repeatToLength returns digest repeated until it's n bytes long.
+func repeatToLength(digest []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out)+len(digest) <= n {
+		out = append(out, digest...)
+	}
+	return append(out, digest[:n-len(out)]...)
+}
+
+// sha512Crypt returns the crypt(3) SHA-512 hash of password, the steps numbered as in the specification.
+func sha512Crypt(password, salt []byte, rounds int, custom bool) string {
+	if rounds < sha512CryptMinRounds {
+		rounds = sha512CryptMinRounds
+	}
+	if rounds > sha512CryptMaxRounds {
+		rounds = sha512CryptMaxRounds
+	}
+	if len(salt) > sha512CryptMaxSalt {
+		salt = salt[:sha512CryptMaxSalt]
+	}
+
+	// Steps 4-8: digest B of password, salt, password.
+	b := sha512.New()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	digestB := b.Sum(nil)
+
+	// Steps 1-3 and 9-12: digest A.
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeatToLength(digestB, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(password)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	// Steps 13-16: the byte sequence P of the password.
+	dp := sha512.New()
+	for i := 0; i < len(password); i++ {
+		dp.Write(password)
+	}
+	p := repeatToLength(dp.Sum(nil), len(password))
+
+	// Steps 17-20: the byte sequence S of the salt.
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeatToLength(ds.Sum(nil), len(salt))
+
+	// Step 21: the rounds.
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	// Step 22: the output string.
+	var out strings.Builder
+	out.WriteString(sha512CryptPrefix)
+	if custom {
+		out.WriteString(sha512CryptRoundsPrefix + strconv.Itoa(rounds) + "$")
+	}
+	out.Write(salt)
+	out.WriteByte('$')
+
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+
+	// The bytes are taken in groups of three, each rotated one further: 0 21 42, 22 43 1, 44 2 23...
+	for i := 0; i < 21; i++ {
+		group := [3]byte{c[i], c[i+21], c[i+42]}
+		encode(group[i%3], group[(i+1)%3], group[(i+2)%3], 4)
+	}
+	encode(0, 0, c[63], 2)
+
+	return out.String()
+}
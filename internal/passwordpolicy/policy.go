@@ -0,0 +1,178 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Character classes a policy can require.
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+// Codes of the rules a password can break.
+const (
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeMissingClass = "missing_"
+	CodePersonalInfo = "contains_personal_info"
+	CodeTooWeak      = "too_weak"
+	CodeBreached     = "breached"
+	CodeReused       = "reused"
+)
+
+var classNames = map[string]string{
+	ClassLower:  "a lower-case letter",
+	ClassUpper:  "an upper-case letter",
+	ClassDigit:  "a digit",
+	ClassSymbol: "a symbol",
+}
+
+// ParseClasses parses a comma separated list of character classes, such as "lower,upper,digit".
+func ParseClasses(list string) ([]string, error) {
+	var classes []string
+	for _, class := range strings.Split(list, ",") {
+		class = strings.TrimSpace(class)
+		if class == "" {
+			continue
+		}
+		if _, ok := classNames[class]; !ok {
+			return nil, fmt.Errorf("invalid character class %q, must be lower, upper, digit or symbol", class)
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// Policy holds the rules new passwords must follow. Zero values disable a rule.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	Classes   []string
+	MinScore  int
+}
+
+// Violation is a rule a password breaks.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result is the outcome of checking a password against a policy.
+type Result struct {
+	Violations []Violation `json:"violations"`
+	Strength   Strength    `json:"strength"`
+}
+
+// OK reports whether the password follows the policy.
+func (r Result) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// Message joins the messages of the violations into one sentence.
+func (r Result) Message() string {
+	messages := make([]string, len(r.Violations))
+	for i, v := range r.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch {
+		case class == ClassLower && unicode.IsLower(r),
+			class == ClassUpper && unicode.IsUpper(r),
+			class == ClassDigit && unicode.IsDigit(r),
+			class == ClassSymbol && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r):
+			return true
+		}
+	}
+	return false
+}
+
+/*
+personalWords returns the words of the user's details a password must not contain: each detail,
+and for emails also the part before the @. Words shorter than three characters are left out,
+since they show up in too many passwords by chance.
+*/
+func personalWords(personal []string) []string {
+	var words []string
+	for _, detail := range personal {
+		detail = strings.ToLower(strings.TrimSpace(detail))
+		candidates := []string{detail}
+		if local, _, ok := strings.Cut(detail, "@"); ok {
+			candidates = append(candidates, local)
+		}
+
+		for _, word := range candidates {
+			if len([]rune(word)) >= 3 {
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+/*
+Check checks password against the policy. personal holds details of the user, such as their
+email, username and names, which the password must not contain.
+*/
+func (p Policy) Check(password string, personal ...string) Result {
+	var result Result
+	length := len([]rune(password))
+
+	if p.MinLength > 0 && length < p.MinLength {
+		result.Violations = append(result.Violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		result.Violations = append(result.Violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("must not be more than %d characters long", p.MaxLength),
+		})
+	}
+
+	for _, class := range p.Classes {
+		if !hasClass(password, class) {
+			result.Violations = append(result.Violations, Violation{
+				Code:    CodeMissingClass + class,
+				Message: "must contain " + classNames[class],
+			})
+		}
+	}
+
+	words := personalWords(personal)
+	lower := strings.ToLower(password)
+	for _, word := range words {
+		if strings.Contains(lower, word) {
+			result.Violations = append(result.Violations, Violation{
+				Code:    CodePersonalInfo,
+				Message: "must not contain your name, username or email",
+			})
+			break
+		}
+	}
+
+	result.Strength = Estimate(password, words...)
+
+	if result.Strength.Score < p.MinScore {
+		message := "is too easy to guess"
+		if result.Strength.Warning != "" {
+			message += ": " + result.Strength.Warning
+		}
+		result.Violations = append(result.Violations, Violation{
+			Code:    CodeTooWeak,
+			Message: message,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,72 @@
+package passwordpolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		password string
+		minScore int
+		maxScore int
+	}{
+		{"password", 0, 0},
+		{"Password1", 0, 1},
+		{"p@ssw0rd", 0, 1},
+		{"qwerty123", 0, 1},
+		{"abcdef", 0, 1},
+		{"aaaaaaaa", 0, 0},
+		{"correct horse battery staple", 4, 4},
+		{"x7#Vq9!mLp2$Rt", 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			s := Estimate(tt.password)
+			assert.GreaterOrEqual(t, s.Score, tt.minScore)
+			assert.LessOrEqual(t, s.Score, tt.maxScore)
+			if s.Score < 3 {
+				assert.NotEmpty(t, s.Suggestions)
+			}
+		})
+	}
+
+	assert.Equal(t, "This is a commonly used password.", Estimate("password").Warning)
+
+	// Guessing a password is much quicker for an attacker who knows the user's name.
+	assert.Less(t, Estimate("wanjikuwanjiku", "Wanjiku").Guesses, Estimate("wanjikuwanjiku").Guesses)
+}
+
+func TestCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, MaxLength: 16, Classes: []string{ClassUpper, ClassDigit}, MinScore: 3}
+
+	codes := func(r Result) []string {
+		var codes []string
+		for _, v := range r.Violations {
+			codes = append(codes, v.Code)
+		}
+		return codes
+	}
+
+	result := policy.Check("pass")
+	assert.False(t, result.OK())
+	assert.Equal(t, []string{"too_short", "missing_upper", "missing_digit", "too_weak"}, codes(result))
+
+	result = policy.Check("a much longer password than allowed")
+	assert.Contains(t, codes(result), "too_long")
+
+	result = policy.Check("Jkamau#2024xyz", "jkamau@example.com", "jkamau", "James", "Kamau")
+	assert.Contains(t, codes(result), "contains_personal_info")
+
+	result = policy.Check("Vq9!mLp2$Rtx", "jkamau@example.com", "jkamau", "Jo", "Kamau")
+	assert.True(t, result.OK(), result.Message())
+
+	classes, err := ParseClasses("lower, symbol")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lower", "symbol"}, classes)
+
+	_, err = ParseClasses("lower,emoji")
+	assert.Error(t, err)
+}
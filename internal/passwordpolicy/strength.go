@@ -0,0 +1,361 @@
+package passwordpolicy
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// common.txt lists frequently used passwords, most common first.
+//
+//go:embed common.txt
+var commonList string
+
+var commonRanks = func() map[string]int {
+	ranks := map[string]int{}
+	for i, word := range strings.Fields(commonList) {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+// Patterns the estimator recognizes in passwords.
+const (
+	patternCommon    = "common"
+	patternUserInput = "user_input"
+	patternSequence  = "sequence"
+	patternRepeat    = "repeat"
+	patternKeyboard  = "keyboard"
+	patternYear      = "year"
+)
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "!@#$%^&*()", "1qaz2wsx3edc4rfv"}
+
+// match is a part of the password, runes start to end, that a guesser would try in guesses attempts.
+type match struct {
+	start, end int
+	guesses    float64
+	pattern    string
+	leet       bool
+	capitals   bool
+}
+
+/*
+Strength is an estimate of how many guesses an attacker who knows common passwords and patterns
+needs to find a password, in the spirit of zxcvbn. Score is 0 (guessed in under a thousand tries)
+to 4 (over ten billion).
+*/
+type Strength struct {
+	Guesses     float64  `json:"guesses_log10"`
+	Score       int      `json:"score"`
+	Warning     string   `json:"warning,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	case r < 128:
+		return 33
+	}
+	return 100
+}
+
+// capitalGuesses returns the factor capitals add to a word: little when only the first letter or
+// all of them are upper case.
+func capitalGuesses(word []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && unicode.IsUpper(word[0]):
+		return 2
+	}
+
+	n := upper
+	if lower < n {
+		n = lower
+	}
+	return math.Pow(2, float64(n)) * 2
+}
+
+func unleet(word []rune) ([]rune, int) {
+	out := make([]rune, len(word))
+	subs := 0
+	for i, r := range word {
+		if letter, ok := leetSubstitutions[r]; ok {
+			out[i] = letter
+			subs++
+			continue
+		}
+		out[i] = r
+	}
+	return out, subs
+}
+
+// lowerRunes lower cases password rune by rune, keeping the indexes of the original.
+func lowerRunes(password []rune) []rune {
+	lower := make([]rune, len(password))
+	for i, r := range password {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// dictionaryMatches finds common passwords and user inputs, also reversed or with l33t substitutions.
+func dictionaryMatches(password []rune, userInputs map[string]int) []match {
+	lower := lowerRunes(password)
+	var matches []match
+
+	for i := 0; i < len(lower); i++ {
+		for j := i + 3; j <= len(lower); j++ {
+			plain := string(lower[i:j])
+			unleeted, subs := unleet(lower[i:j])
+
+			for _, candidate := range []struct {
+				word   string
+				factor float64
+				leet   bool
+			}{
+				{plain, 1, false},
+				{reverse(plain), 2, false},
+				{string(unleeted), math.Pow(2, float64(subs)), true},
+			} {
+				if candidate.leet && subs == 0 {
+					continue
+				}
+
+				pattern, rank := patternCommon, commonRanks[candidate.word]
+				if r, ok := userInputs[candidate.word]; ok {
+					pattern, rank = patternUserInput, r
+				}
+				if rank == 0 {
+					continue
+				}
+
+				capitals := capitalGuesses(password[i:j])
+				matches = append(matches, match{
+					start:    i,
+					end:      j,
+					guesses:  float64(rank) * candidate.factor * capitals,
+					pattern:  pattern,
+					leet:     candidate.leet,
+					capitals: capitals > 2,
+				})
+			}
+		}
+	}
+
+	return matches
+}
+
+func isAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+}
+
+// sequenceMatches finds runs such as abc, 4321 or aaaa.
+func sequenceMatches(password []rune) []match {
+	lower := lowerRunes(password)
+	var matches []match
+
+	for i := 0; i < len(lower)-1; {
+		delta := int(lower[i+1]) - int(lower[i])
+		if delta < -1 || delta > 1 || delta != 0 && !(isAlnum(lower[i]) && isAlnum(lower[i+1])) {
+			i++
+			continue
+		}
+
+		j := i + 2
+		for j < len(lower) && int(lower[j])-int(lower[j-1]) == delta && (delta == 0 || isAlnum(lower[j])) {
+			j++
+		}
+
+		if n := float64(j - i); n >= 3 {
+			if delta == 0 {
+				matches = append(matches, match{start: i, end: j, guesses: cardinality(lower[i]) * n, pattern: patternRepeat})
+			} else {
+				base := cardinality(lower[i])
+				if strings.ContainsRune("az019", lower[i]) {
+					base = 4
+				}
+				if delta < 0 {
+					base *= 2
+				}
+				matches = append(matches, match{start: i, end: j, guesses: base * n, pattern: patternSequence})
+			}
+		}
+
+		i = j - 1
+	}
+
+	return matches
+}
+
+// keyboardMatches finds straight rows of keys such as qwerty or zxcvbn, in either direction.
+func keyboardMatches(password []rune) []match {
+	runes := lowerRunes(password)
+	var matches []match
+
+	for i := 0; i < len(runes); i++ {
+		for j := i + 4; j <= len(runes); j++ {
+			part := string(runes[i:j])
+			for _, row := range keyboardRows {
+				if strings.Contains(row, part) || strings.Contains(row, reverse(part)) {
+					matches = append(matches, match{start: i, end: j, guesses: 40 * float64(j-i), pattern: patternKeyboard})
+					break
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+// yearMatches finds years from 1900 to 2039.
+func yearMatches(password []rune) []match {
+	var matches []match
+
+	for i := 0; i+4 <= len(password); i++ {
+		s := string(password[i : i+4])
+		if (strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20") && s[2] <= '3') && strings.Trim(s, "0123456789") == "" {
+			matches = append(matches, match{start: i, end: i + 4, guesses: 140, pattern: patternYear})
+		}
+	}
+
+	return matches
+}
+
+var warnings = map[string]string{
+	patternCommon:    "This is similar to a commonly used password.",
+	patternUserInput: "Passwords containing your name, username or email are easy to guess.",
+	patternSequence:  "Sequences like abc or 6543 are easy to guess.",
+	patternRepeat:    "Repeats like aaa are easy to guess.",
+	patternKeyboard:  "Straight rows of keys are easy to guess.",
+	patternYear:      "Recent years are easy to guess.",
+}
+
+/*
+Estimate estimates the strength of password. userInputs are words the attacker is assumed to
+try first, such as the user's name and email.
+*/
+func Estimate(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+
+	inputs := map[string]int{}
+	for i, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len([]rune(input)) >= 3 {
+			inputs[input] = i + 1
+		}
+	}
+
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, inputs)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	// best[i] is the log10 of the fewest guesses for the first i runes, made up of whole
+	// matches and single characters guessed by brute force.
+	best := make([]float64, len(runes)+1)
+	chosen := make([]int, len(runes)+1)
+
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] + math.Log10(cardinality(runes[i-1]))
+		chosen[i] = -1
+
+		for k, m := range matches {
+			if m.end != i {
+				continue
+			}
+
+			guesses := best[m.start] + math.Log10(math.Max(m.guesses, 1))
+			if guesses < best[i] {
+				best[i] = guesses
+				chosen[i] = k
+			}
+		}
+	}
+
+	strength := Strength{Guesses: math.Round(best[len(runes)]*100) / 100}
+
+	switch g := best[len(runes)]; {
+	case g < 3:
+		strength.Score = 0
+	case g < 6:
+		strength.Score = 1
+	case g < 8:
+		strength.Score = 2
+	case g < 10:
+		strength.Score = 3
+	default:
+		strength.Score = 4
+	}
+
+	if strength.Score >= 3 {
+		return strength
+	}
+
+	// Explain the longest pattern the estimate relied on.
+	var used []match
+	for i := len(runes); i > 0; {
+		if k := chosen[i]; k >= 0 {
+			used = append(used, matches[k])
+			i = matches[k].start
+			continue
+		}
+		i--
+	}
+
+	var longest *match
+	for k := range used {
+		if longest == nil || used[k].end-used[k].start > longest.end-longest.start {
+			longest = &used[k]
+		}
+	}
+
+	if longest != nil {
+		strength.Warning = warnings[longest.pattern]
+		if longest.pattern == patternCommon && longest.start == 0 && longest.end == len(runes) {
+			strength.Warning = "This is a commonly used password."
+		}
+		if longest.leet {
+			strength.Suggestions = append(strength.Suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much.")
+		}
+		if longest.capitals {
+			strength.Suggestions = append(strength.Suggestions, "Capitalization doesn't help very much.")
+		}
+	}
+
+	strength.Suggestions = append(strength.Suggestions, "Add another word or two. Uncommon words are better.")
+
+	return strength
+}
@@ -0,0 +1,542 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrorInvalidCondition is wrapped by every error returned while parsing a condition.
+	ErrorInvalidCondition = errors.New("invalid condition")
+
+	// ErrorEvaluation is wrapped by every error returned while evaluating a condition.
+	ErrorEvaluation = errors.New("condition evaluation failed")
+)
+
+/*
+Expression is a parsed condition, e.g.
+
+	"support" in subject.roles and subject.attributes.region == resource.attributes.region
+	and env.hour >= 9 and env.hour < 17
+
+Paths start at subject, resource, context or env and evaluate to null when missing. Literals are
+strings in single or double quotes, numbers, true, false, null and lists such as ["a", "b"].
+Comparisons are ==, !=, <, <=, >, >=, in (membership of a list) and contains (of a list or a
+substring). "not" binds tighter than "and", which binds tighter than "or".
+*/
+type Expression interface {
+	eval(attributes map[string]interface{}) (interface{}, error)
+}
+
+type literalExpression struct {
+	value interface{}
+}
+
+type pathExpression struct {
+	path []string
+}
+
+type listExpression struct {
+	items []Expression
+}
+
+type notExpression struct {
+	expression Expression
+}
+
+type logicalExpression struct {
+	operator    string
+	left, right Expression
+}
+
+type comparisonExpression struct {
+	operator    string
+	left, right Expression
+}
+
+// Roots are the top-level names a path may start with.
+var Roots = []string{"subject", "resource", "context", "env"}
+
+var comparisonOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "in": true, "contains": true,
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+	tokenComma
+	tokenEOF
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func invalidCondition(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrorInvalidCondition, fmt.Sprintf(format, args...))
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(input); {
+		c := input[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen, value: ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenOpenBracket, value: "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenCloseBracket, value: "]"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, value: ","})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+
+			end := i + 1
+			for ; end < len(input) && input[end] != c; end++ {
+				if input[end] == '\\' && end+1 < len(input) {
+					end++
+				}
+				b.WriteByte(input[end])
+			}
+			if end >= len(input) {
+				return nil, invalidCondition("unterminated string")
+			}
+
+			tokens = append(tokens, token{kind: tokenString, value: b.String()})
+			i = end + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			end := i + 1
+			if end < len(input) && input[end] == '=' {
+				end++
+			}
+
+			op := input[i:end]
+			if !comparisonOperators[op] {
+				return nil, invalidCondition("unknown operator %q", op)
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, value: op})
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(input) && (input[end] == '.' || input[end] >= '0' && input[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: input[i:end]})
+			i = end
+		case isWordByte(c):
+			end := i
+			for end < len(input) && isWordByte(input[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: input[i:end]})
+			i = end
+		default:
+			return nil, invalidCondition("unexpected %q", string(c))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && t.value == keyword
+}
+
+/*
+ParseCondition parses a policy condition.
+*/
+func ParseCondition(input string) (Expression, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, invalidCondition("unexpected %q", t.value)
+	}
+
+	return expr, nil
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("or") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &logicalExpression{operator: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("and") {
+		p.next()
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &logicalExpression{operator: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expression, error) {
+	if p.peekKeyword("not") {
+		p.next()
+
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notExpression{expression: expr}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expression, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind != tokenOperator && !p.peekKeyword("in") && !p.peekKeyword("contains") {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &comparisonExpression{operator: t.value, left: left, right: right}, nil
+}
+
+func (p *parser) parsePrimary() (Expression, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenOpenParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next().kind != tokenCloseParen {
+			return nil, invalidCondition("missing )")
+		}
+
+		return expr, nil
+
+	case tokenOpenBracket:
+		list := &listExpression{}
+
+		for p.peek().kind != tokenCloseBracket {
+			item, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+
+		if p.next().kind != tokenCloseBracket {
+			return nil, invalidCondition("missing ]")
+		}
+
+		return list, nil
+
+	case tokenString:
+		return &literalExpression{value: t.value}, nil
+
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, invalidCondition("invalid number %q", t.value)
+		}
+
+		return &literalExpression{value: n}, nil
+
+	case tokenWord:
+		switch t.value {
+		case "true":
+			return &literalExpression{value: true}, nil
+		case "false":
+			return &literalExpression{value: false}, nil
+		case "null":
+			return &literalExpression{value: nil}, nil
+		case "and", "or", "not", "in", "contains":
+			return nil, invalidCondition("unexpected %q", t.value)
+		}
+
+		path := strings.Split(t.value, ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, invalidCondition("invalid path %q", t.value)
+			}
+		}
+
+		if !isRoot(path[0]) {
+			return nil, invalidCondition("paths must start with one of %s, not %q", strings.Join(Roots, ", "), path[0])
+		}
+
+		return &pathExpression{path: path}, nil
+
+	case tokenEOF:
+		return nil, invalidCondition("unexpected end of condition")
+	}
+
+	return nil, invalidCondition("unexpected %q", t.value)
+}
+
+func isRoot(name string) bool {
+	for _, root := range Roots {
+		if name == root {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *literalExpression) eval(map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *pathExpression) eval(attributes map[string]interface{}) (interface{}, error) {
+	var value interface{} = attributes
+
+	for _, part := range e.path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = m[part]
+	}
+
+	return normalize(value), nil
+}
+
+func (e *listExpression) eval(attributes map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(e.items))
+
+	for _, item := range e.items {
+		value, err := item.eval(attributes)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func evalBool(e Expression, attributes map[string]interface{}) (bool, error) {
+	value, err := e.eval(attributes)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: expected a boolean, got %v", ErrorEvaluation, value)
+	}
+
+	return b, nil
+}
+
+func (e *notExpression) eval(attributes map[string]interface{}) (interface{}, error) {
+	b, err := evalBool(e.expression, attributes)
+	return !b, err
+}
+
+func (e *logicalExpression) eval(attributes map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(e.left, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.operator == "and" && !left || e.operator == "or" && left {
+		return left, nil
+	}
+
+	return evalBool(e.right, attributes)
+}
+
+func (e *comparisonExpression) eval(attributes map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := e.right.eval(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.operator {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		return contains(right, left)
+	case "contains":
+		return contains(left, right)
+	}
+
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return compare(e.operator, l < r, l == r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return compare(e.operator, l < r, l == r), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: can't compare %v %s %v", ErrorEvaluation, left, e.operator, right)
+}
+
+func compare(operator string, less, equal bool) bool {
+	switch operator {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	default:
+		return !less
+	}
+}
+
+// contains reports whether the list container has an element equal to value, or the string
+// container has value as a substring. A missing container contains nothing.
+func contains(container, value interface{}) (bool, error) {
+	switch c := container.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range c {
+			if reflect.DeepEqual(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		if v, ok := value.(string); ok {
+			return strings.Contains(c, v), nil
+		}
+	}
+
+	return false, fmt.Errorf("%w: %v is not a list or a string", ErrorEvaluation, container)
+}
+
+// normalize converts attribute values to the types conditions work with: numbers are float64 and
+// lists are []interface{}, whatever type the caller used to build the attributes.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			values = append(values, s)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			values = append(values, normalize(item))
+		}
+		return values
+	}
+
+	return value
+}
@@ -0,0 +1,280 @@
+/*
+Package policy evaluates attribute-based access policies, e.g. "support staff may view users
+in their region during business hours".
+
+A policy allows or denies actions on resource types when its condition holds. Conditions see the
+attributes of the subject, the resource, the caller-supplied context and the environment (the time
+and client address). Any matching deny wins over allows, and nothing is allowed by default.
+*/
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrorInvalidPolicy is wrapped by every error returned while validating a policy.
+var ErrorInvalidPolicy = errors.New("invalid policy")
+
+// Policy effects.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy modes. Dry-run policies are evaluated and logged but don't change decisions.
+const (
+	ModeEnforce = "enforce"
+	ModeDryRun  = "dry_run"
+)
+
+// Where a policy was loaded from.
+const (
+	SourceDatabase = "database"
+	SourceFile     = "file"
+)
+
+// NameRX restricts policy names.
+var NameRX = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)*$`)
+
+/*
+Policy allows or denies Actions on Resources when Condition holds. Actions and resources may end
+in "*" to match by prefix, e.g. "users:*". An empty condition always holds.
+*/
+type Policy struct {
+	ID          int64     `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Effect      string    `json:"effect"`
+	Actions     []string  `json:"actions"`
+	Resources   []string  `json:"resources"`
+	Condition   string    `json:"condition"`
+	Mode        string    `json:"mode"`
+	Source      string    `json:"source"`
+	Version     int       `json:"version,omitempty"`
+	CreatedAt   time.Time `json:"CreatedAt,omitempty"`
+	UpdatedAt   time.Time `json:"UpdatedAt,omitempty"`
+
+	expression Expression
+}
+
+/*
+Validate checks a policy and compiles its condition. Mode defaults to enforce.
+*/
+func (p *Policy) Validate() error {
+	if p.Mode == "" {
+		p.Mode = ModeEnforce
+	}
+
+	switch {
+	case !NameRX.MatchString(p.Name) || len(p.Name) > 100:
+		return fmt.Errorf("%w: name must be lower-case letters, digits, dashes and underscores, at most 100 characters long", ErrorInvalidPolicy)
+	case len(p.Description) > 500:
+		return fmt.Errorf("%w: description must not be more than 500 characters long", ErrorInvalidPolicy)
+	case p.Effect != EffectAllow && p.Effect != EffectDeny:
+		return fmt.Errorf("%w: effect must be allow or deny", ErrorInvalidPolicy)
+	case p.Mode != ModeEnforce && p.Mode != ModeDryRun:
+		return fmt.Errorf("%w: mode must be enforce or dry_run", ErrorInvalidPolicy)
+	case len(p.Actions) == 0:
+		return fmt.Errorf("%w: at least one action must be given", ErrorInvalidPolicy)
+	case len(p.Resources) == 0:
+		return fmt.Errorf("%w: at least one resource type must be given", ErrorInvalidPolicy)
+	}
+
+	expression, err := ParseCondition(p.Condition)
+	if p.Condition == "" {
+		expression, err = &literalExpression{value: true}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrorInvalidPolicy, err)
+	}
+
+	p.expression = expression
+	return nil
+}
+
+func matchPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == value || strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies reports whether the policy covers the action on the resource type.
+func (p *Policy) Applies(action, resourceType string) bool {
+	return matchPattern(p.Actions, action) && matchPattern(p.Resources, resourceType)
+}
+
+/*
+Input is what a decision is made about. The attribute maps hold strings, numbers, booleans,
+lists and nested map[string]interface{} values.
+*/
+type Input struct {
+	Action   string
+	Subject  map[string]interface{}
+	Resource map[string]interface{}
+	Context  map[string]interface{}
+	Env      map[string]interface{}
+}
+
+/*
+Env returns the environment attributes of a request made at now from ip:
+time (RFC 3339), hour (0-23), weekday ("monday"...) and ip.
+*/
+func Env(now time.Time, ip string) map[string]interface{} {
+	return map[string]interface{}{
+		"time":    now.Format(time.RFC3339),
+		"hour":    float64(now.Hour()),
+		"weekday": strings.ToLower(now.Weekday().String()),
+		"ip":      ip,
+	}
+}
+
+/*
+Decision is the outcome of evaluating policies. Policies lists the policies whose condition held
+and Errors those whose condition failed to evaluate. DryRun is the decision that would have been
+made with the dry-run policies enforced too, when there are any.
+*/
+type Decision struct {
+	Allowed  bool      `json:"allowed"`
+	Reason   string    `json:"reason"`
+	Policies []string  `json:"policies"`
+	Errors   []string  `json:"errors,omitempty"`
+	DryRun   *Decision `json:"dry_run,omitempty"`
+}
+
+/*
+Evaluate decides on input with the policies. Policies must have been validated. A policy whose
+condition fails to evaluate makes the decision a deny, since it might have been a deny itself.
+*/
+func Evaluate(policies []*Policy, input Input) *Decision {
+	attributes := map[string]interface{}{
+		"subject":  input.Subject,
+		"resource": input.Resource,
+		"context":  input.Context,
+		"env":      input.Env,
+	}
+
+	resourceType, _ := input.Resource["type"].(string)
+
+	var enforced, dryRun []*Policy
+	for _, p := range policies {
+		if !p.Applies(input.Action, resourceType) {
+			continue
+		}
+
+		if p.Mode == ModeDryRun {
+			dryRun = append(dryRun, p)
+		} else {
+			enforced = append(enforced, p)
+		}
+	}
+
+	decision := decide(enforced, attributes)
+
+	if len(dryRun) > 0 {
+		decision.DryRun = decide(append(enforced, dryRun...), attributes)
+	}
+
+	return decision
+}
+
+func decide(policies []*Policy, attributes map[string]interface{}) *Decision {
+	decision := &Decision{Policies: []string{}}
+
+	var allowed, denied bool
+
+	for _, p := range policies {
+		ok, err := evalBool(p.expression, attributes)
+		if err != nil {
+			decision.Errors = append(decision.Errors, p.Name+": "+err.Error())
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		decision.Policies = append(decision.Policies, p.Name)
+
+		if p.Effect == EffectDeny {
+			denied = true
+		} else {
+			allowed = true
+		}
+	}
+
+	switch {
+	case denied:
+		decision.Reason = "denied by policy"
+	case len(decision.Errors) > 0:
+		decision.Reason = "a policy condition failed to evaluate"
+	case allowed:
+		decision.Allowed = true
+		decision.Reason = "allowed by policy"
+	default:
+		decision.Reason = "no policy allows the action"
+	}
+
+	return decision
+}
+
+/*
+LoadDir reads the policies in the .json files of dir. A file holds a single policy or a list of
+them. Every policy is validated, and names must be unique across the files.
+*/
+func LoadDir(dir string) ([]*Policy, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []*Policy
+	names := map[string]string{}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var filePolicies []*Policy
+		if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(b, &filePolicies)
+		} else {
+			var p Policy
+			err = json.Unmarshal(b, &p)
+			filePolicies = []*Policy{&p}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		for _, p := range filePolicies {
+			p.ID, p.Version, p.Source = 0, 0, SourceFile
+
+			err = p.Validate()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			if other, ok := names[p.Name]; ok {
+				return nil, fmt.Errorf("%s: %w: %q is also defined in %s", file, ErrorInvalidPolicy, p.Name, other)
+			}
+			names[p.Name] = file
+
+			policies = append(policies, p)
+		}
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCondition(t *testing.T) {
+	attributes := map[string]interface{}{
+		"subject": map[string]interface{}{
+			"id":         int64(7),
+			"roles":      []string{"support"},
+			"attributes": map[string]interface{}{"region": "eu"},
+		},
+		"resource": map[string]interface{}{
+			"type":       "user",
+			"attributes": map[string]interface{}{"region": "eu", "tags": []interface{}{"vip"}},
+		},
+		"env": Env(time.Date(2026, 10, 19, 10, 30, 0, 0, time.UTC), "10.0.0.1"),
+	}
+
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{`"support" in subject.roles and subject.attributes.region == resource.attributes.region`, true},
+		{`env.hour >= 9 and env.hour < 17 and env.weekday != 'sunday'`, true},
+		{`subject.id == 7`, true},
+		{`resource.attributes.tags contains "vip"`, true},
+		{`not (subject.attributes.region in ['us', "apac"])`, true},
+		{`subject.missing == null and resource.attributes.missing contains 'x' or env.ip contains '10.'`, true},
+		{`subject.id > 7 or 'admin' in subject.roles`, false},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseCondition(tt.condition)
+		if !assert.NoError(t, err, tt.condition) {
+			continue
+		}
+
+		ok, err := evalBool(expr, attributes)
+		if assert.NoError(t, err, tt.condition) {
+			assert.Equal(t, tt.want, ok, tt.condition)
+		}
+	}
+
+	expr, err := ParseCondition(`subject.roles < 3`)
+	if assert.NoError(t, err) {
+		_, err = evalBool(expr, attributes)
+		assert.ErrorIs(t, err, ErrorEvaluation)
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	for _, condition := range []string{`user.id == 1`, `subject.id ==`, `(subject.id == 1`, `subject.id === 1`, `"a`, `subject..id == 1`, `subject.id == 1 and`} {
+		_, err := ParseCondition(condition)
+		assert.ErrorIs(t, err, ErrorInvalidCondition, condition)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	policies := []*Policy{
+		{Name: "support-view", Effect: EffectAllow, Actions: []string{"users:view"}, Resources: []string{"user"}, Condition: `"support" in subject.roles`},
+		{Name: "no-vip", Effect: EffectDeny, Actions: []string{"users:*"}, Resources: []string{"*"}, Condition: `resource.vip == true`},
+		{Name: "business-hours", Effect: EffectDeny, Actions: []string{"*"}, Resources: []string{"*"}, Condition: `env.hour < 9`, Mode: ModeDryRun},
+	}
+
+	for _, p := range policies {
+		if !assert.NoError(t, p.Validate()) {
+			return
+		}
+	}
+
+	input := Input{
+		Action:   "users:view",
+		Subject:  map[string]interface{}{"roles": []string{"support"}},
+		Resource: map[string]interface{}{"type": "user"},
+		Env:      Env(time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), ""),
+	}
+
+	decision := Evaluate(policies, input)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, []string{"support-view"}, decision.Policies)
+	if assert.NotNil(t, decision.DryRun) {
+		assert.False(t, decision.DryRun.Allowed)
+	}
+
+	input.Resource["vip"] = true
+	assert.False(t, Evaluate(policies, input).Allowed)
+
+	input.Action = "users:delete"
+	delete(input.Resource, "vip")
+	assert.Equal(t, "no policy allows the action", Evaluate(policies, input).Reason)
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "a.json"), []byte(`[{"name": "a", "effect": "allow", "actions": ["*"], "resources": ["*"]}]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"name": "b", "effect": "deny", "actions": ["*"], "resources": ["*"], "condition": "env.hour > 20"}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := LoadDir(dir)
+	if assert.NoError(t, err) && assert.Len(t, policies, 2) {
+		assert.Equal(t, SourceFile, policies[1].Source)
+		assert.Equal(t, ModeEnforce, policies[1].Mode)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "c.json"), []byte(`{"name": "a", "effect": "allow", "actions": ["*"], "resources": ["*"]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadDir(dir)
+	assert.ErrorIs(t, err, ErrorInvalidPolicy)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*
+PostgresStore keeps buckets in the rate_limit_buckets table, so that every replica sharing the
+database counts against the same buckets.
+*/
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+// Take takes a token from the bucket of key, creating and locking its row while it does.
+func (s PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// Make sure the row exists before locking it: FOR UPDATE locks nothing when there is no row,
+	// which would let concurrent first requests of a key all take a token from a full bucket.
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+	VALUES ($1, $2, $3, $3)
+	ON CONFLICT (key) DO NOTHING`, key, float64(limit.Burst), now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var tokens float64
+	var updated time.Time
+
+	// The row can still be missing when DeleteFull removed it in between, then the bucket starts full.
+	err = tx.QueryRowContext(ctx, `
+	SELECT tokens, updated_at
+	FROM rate_limit_buckets
+	WHERE key = $1
+	FOR UPDATE`, key).Scan(&tokens, &updated)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Result{}, err
+	}
+
+	now = time.Now()
+	tokens, result := take(tokens, updated, limit, now)
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (key) DO UPDATE
+	SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at, full_at = EXCLUDED.full_at`,
+		key, tokens, now, now.Add(result.Reset))
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+// DeleteFull removes the buckets that have filled up again, which behave like missing ones.
+func (s PostgresStore) DeleteFull(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
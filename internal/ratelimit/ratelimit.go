@@ -0,0 +1,83 @@
+/*
+Package ratelimit implements token-bucket rate limiting with buckets kept in memory or in Postgres.
+
+Every key has a bucket holding up to Burst tokens, refilled at Rate tokens per second. A request
+takes one token and is refused when the bucket is empty.
+*/
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is the size and refill rate of a bucket.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all at once if need be.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// PerHour allows n requests an hour, all at once if need be.
+func PerHour(n int) Limit {
+	return Limit{Rate: float64(n) / 3600, Burst: n}
+}
+
+/*
+Result is the outcome of taking a token. RetryAfter is how long until a token is available when
+the request was refused, Reset how long until the bucket is full again.
+*/
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Store keeps the buckets of keys and takes tokens from them.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+/*
+take refills a bucket that held tokens at updated up to now and takes a token if there is one.
+It returns the tokens left in the bucket. A bucket seen for the first time has a zero updated
+time and starts full.
+*/
+func take(tokens float64, updated time.Time, limit Limit, now time.Time) (float64, Result) {
+	burst := float64(limit.Burst)
+
+	if updated.IsZero() {
+		tokens = burst
+	} else if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.Rate)
+	}
+
+	result := Result{Limit: limit.Burst}
+
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else if limit.Rate > 0 {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	} else {
+		result.RetryAfter = time.Duration(math.MaxInt64)
+	}
+
+	result.Remaining = int(tokens)
+	if limit.Rate > 0 {
+		result.Reset = seconds((burst - tokens) / limit.Rate)
+	}
+
+	return tokens, result
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	limit := PerMinute(3)
+
+	for i := 2; i >= 0; i-- {
+		result, err := s.Take(context.Background(), "ip:10.0.0.1", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, _ := s.Take(context.Background(), "ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// Other keys have their own bucket.
+	result, _ = s.Take(context.Background(), "ip:10.0.0.2", limit)
+	assert.True(t, result.Allowed)
+
+	now = now.Add(20 * time.Second)
+	result, _ = s.Take(context.Background(), "ip:10.0.0.1", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	now = now.Add(2 * time.Minute)
+	s.Take(context.Background(), "ip:10.0.0.3", limit)
+	assert.Len(t, s.buckets, 1)
+}
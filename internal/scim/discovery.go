@@ -0,0 +1,148 @@
+package scim
+
+/*
+The discovery documents describe what this service provider supports, as defined in
+RFC 7643 sections 5 to 7. They are static since the supported features don't change at runtime.
+*/
+
+// ServiceProviderConfig returns the ServiceProviderConfig resource.
+func ServiceProviderConfig(baseURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":          []string{ServiceProviderConfigSchema},
+		"documentationUri": "https://github.com/rabin-nyaundi/auth-service",
+		"patch":            map[string]interface{}{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": MaxResults},
+		"changePassword":   map[string]interface{}{"supported": true},
+		"sort":             map[string]interface{}{"supported": false},
+		"etag":             map[string]interface{}{"supported": true},
+		"authenticationSchemes": []map[string]interface{}{
+			{
+				"type":        "oauthbearertoken",
+				"name":        "OAuth Bearer Token",
+				"description": "Authentication with a SCIM client bearer token issued by an administrator",
+				"primary":     true,
+			},
+		},
+		"meta": map[string]interface{}{
+			"resourceType": "ServiceProviderConfig",
+			"location":     baseURL + "/ServiceProviderConfig",
+		},
+	}
+}
+
+// ResourceTypes returns the User and Group ResourceType resources.
+func ResourceTypes(baseURL string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"schemas":     []string{ResourceTypeSchema},
+			"id":          "User",
+			"name":        "User",
+			"endpoint":    "/Users",
+			"description": "User Account",
+			"schema":      UserSchema,
+			"meta": map[string]interface{}{
+				"resourceType": "ResourceType",
+				"location":     baseURL + "/ResourceTypes/User",
+			},
+		},
+		{
+			"schemas":     []string{ResourceTypeSchema},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "Group",
+			"schema":      GroupSchema,
+			"meta": map[string]interface{}{
+				"resourceType": "ResourceType",
+				"location":     baseURL + "/ResourceTypes/Group",
+			},
+		},
+	}
+}
+
+func attribute(name, typ string, required bool, mutability, uniqueness string, caseExact bool) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"type":        typ,
+		"multiValued": false,
+		"required":    required,
+		"caseExact":   caseExact,
+		"mutability":  mutability,
+		"returned":    "default",
+		"uniqueness":  uniqueness,
+	}
+}
+
+func multiValuedAttribute(name string, subAttributes ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"name":          name,
+		"type":          "complex",
+		"multiValued":   true,
+		"required":      false,
+		"mutability":    "readWrite",
+		"returned":      "default",
+		"subAttributes": subAttributes,
+	}
+}
+
+// Schemas returns the Schema resources for User and Group.
+func Schemas(baseURL string) []map[string]interface{} {
+	password := attribute("password", "string", false, "writeOnly", "none", false)
+	password["returned"] = "never"
+
+	return []map[string]interface{}{
+		{
+			"schemas":     []string{SchemaSchema},
+			"id":          UserSchema,
+			"name":        "User",
+			"description": "User Account",
+			"attributes": []map[string]interface{}{
+				attribute("userName", "string", true, "readWrite", "server", false),
+				{
+					"name":        "name",
+					"type":        "complex",
+					"multiValued": false,
+					"required":    false,
+					"mutability":  "readWrite",
+					"returned":    "default",
+					"subAttributes": []map[string]interface{}{
+						attribute("formatted", "string", false, "readOnly", "none", false),
+						attribute("givenName", "string", false, "readWrite", "none", false),
+						attribute("familyName", "string", false, "readWrite", "none", false),
+					},
+				},
+				attribute("displayName", "string", false, "readOnly", "none", false),
+				attribute("active", "boolean", false, "readWrite", "none", false),
+				password,
+				multiValuedAttribute("emails",
+					attribute("value", "string", false, "readWrite", "server", false),
+					attribute("type", "string", false, "readWrite", "none", false),
+					attribute("primary", "boolean", false, "readWrite", "none", false),
+				),
+			},
+			"meta": map[string]interface{}{
+				"resourceType": "Schema",
+				"location":     baseURL + "/Schemas/" + UserSchema,
+			},
+		},
+		{
+			"schemas":     []string{SchemaSchema},
+			"id":          GroupSchema,
+			"name":        "Group",
+			"description": "Group",
+			"attributes": []map[string]interface{}{
+				attribute("displayName", "string", true, "readWrite", "none", false),
+				multiValuedAttribute("members",
+					attribute("value", "string", false, "immutable", "none", false),
+					attribute("display", "string", false, "readOnly", "none", false),
+					attribute("$ref", "reference", false, "immutable", "none", false),
+				),
+			},
+			"meta": map[string]interface{}{
+				"resourceType": "Schema",
+				"location":     baseURL + "/Schemas/" + GroupSchema,
+			},
+		},
+	}
+}
@@ -0,0 +1,522 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorInvalidFilter is wrapped by every error returned while parsing or translating a filter.
+var ErrorInvalidFilter = errors.New("invalid filter")
+
+/*
+Expression is a node of a parsed filter: an *AttributeExpression, *LogicalExpression,
+*NotExpression or *ValuePathExpression.
+*/
+type Expression interface {
+	expression()
+}
+
+/*
+AttributeExpression compares an attribute with a value, e.g. userName eq "bjensen".
+Value is a string, float64, bool or nil. It is unused for the "pr" operator.
+*/
+type AttributeExpression struct {
+	Path     string
+	Operator string
+	Value    interface{}
+}
+
+/*
+LogicalExpression joins two expressions with "and" or "or".
+*/
+type LogicalExpression struct {
+	Operator string
+	Left     Expression
+	Right    Expression
+}
+
+/*
+NotExpression negates an expression.
+*/
+type NotExpression struct {
+	Expression Expression
+}
+
+/*
+ValuePathExpression filters a multi-valued attribute, e.g. emails[type eq "work"].
+*/
+type ValuePathExpression struct {
+	Path   string
+	Filter Expression
+}
+
+func (*AttributeExpression) expression() {}
+func (*LogicalExpression) expression()   {}
+func (*NotExpression) expression()       {}
+func (*ValuePathExpression) expression() {}
+
+var comparisonOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+	tokenEOF
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func invalidFilter(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrorInvalidFilter, fmt.Sprintf(format, args...))
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(input); {
+		c := input[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpenParen})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenCloseParen})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenOpenBracket})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenCloseBracket})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, invalidFilter("unterminated string")
+			}
+
+			var s string
+			err := json.Unmarshal([]byte(input[i:end+1]), &s)
+			if err != nil {
+				return nil, invalidFilter("invalid string %s", input[i:end+1])
+			}
+
+			tokens = append(tokens, token{kind: tokenString, value: s})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t()[]\"", rune(input[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: input[i:end]})
+			i = end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+/*
+ParseFilter parses a SCIM filter expression as described in RFC 7644 section 3.4.2.2.
+"not" binds tighter than "and", which binds tighter than "or".
+*/
+func ParseFilter(input string) (Expression, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, invalidFilter("unexpected %q", t.value)
+	}
+
+	return expr, nil
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("or") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &LogicalExpression{Operator: "or", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword("and") {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &LogicalExpression{Operator: "and", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.peekKeyword("not") {
+		p.next()
+
+		if p.peek().kind != tokenOpenParen {
+			return nil, invalidFilter("expected ( after not")
+		}
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &NotExpression{Expression: expr}, nil
+	}
+
+	if p.peek().kind == tokenOpenParen {
+		p.next()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next().kind != tokenCloseParen {
+			return nil, invalidFilter("expected )")
+		}
+
+		return expr, nil
+	}
+
+	return p.parseAttribute()
+}
+
+func (p *parser) parseAttribute() (Expression, error) {
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, invalidFilter("expected attribute path")
+	}
+
+	path := t.value
+
+	if p.peek().kind == tokenOpenBracket {
+		p.next()
+
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next().kind != tokenCloseBracket {
+			return nil, invalidFilter("expected ]")
+		}
+
+		return &ValuePathExpression{Path: path, Filter: filter}, nil
+	}
+
+	op := p.next()
+	operator := strings.ToLower(op.value)
+	if op.kind != tokenWord || !comparisonOperators[operator] {
+		return nil, invalidFilter("unknown operator %q", op.value)
+	}
+
+	if operator == "pr" {
+		return &AttributeExpression{Path: path, Operator: operator}, nil
+	}
+
+	v := p.next()
+	switch v.kind {
+	case tokenString:
+		return &AttributeExpression{Path: path, Operator: operator, Value: v.value}, nil
+	case tokenWord:
+		switch strings.ToLower(v.value) {
+		case "true":
+			return &AttributeExpression{Path: path, Operator: operator, Value: true}, nil
+		case "false":
+			return &AttributeExpression{Path: path, Operator: operator, Value: false}, nil
+		case "null":
+			return &AttributeExpression{Path: path, Operator: operator, Value: nil}, nil
+		}
+
+		n, err := strconv.ParseFloat(v.value, 64)
+		if err != nil {
+			return nil, invalidFilter("invalid value %q", v.value)
+		}
+
+		return &AttributeExpression{Path: path, Operator: operator, Value: n}, nil
+	default:
+		return nil, invalidFilter("expected comparison value")
+	}
+}
+
+/*
+Column types used when translating attributes to SQL.
+*/
+const (
+	ColumnString = iota
+	ColumnCaseExactString
+	ColumnBool
+	ColumnID
+	ColumnTime
+)
+
+/*
+Column maps a SCIM attribute onto a SQL column or expression.
+*/
+type Column struct {
+	SQL  string
+	Type int
+}
+
+/*
+Columns maps lower-cased attribute paths, without schema URN prefix, onto columns.
+*/
+type Columns map[string]Column
+
+/*
+NormalisePath lower-cases an attribute path and removes a core schema URN prefix,
+so "urn:ietf:params:scim:schemas:core:2.0:User:name.givenName" becomes "name.givenname".
+*/
+func NormalisePath(path string) string {
+	path = strings.ToLower(path)
+
+	for _, schema := range []string{UserSchema, GroupSchema} {
+		prefix := strings.ToLower(schema) + ":"
+		path = strings.TrimPrefix(path, prefix)
+	}
+
+	return path
+}
+
+/*
+ToSQL translates a parsed filter into a SQL boolean expression. Values are appended to args
+and referenced as numbered placeholders, so the caller can prefix its own arguments.
+Only attributes present in columns can be filtered on.
+*/
+func ToSQL(expr Expression, columns Columns, args *[]interface{}) (string, error) {
+	switch e := expr.(type) {
+	case *LogicalExpression:
+		left, err := ToSQL(e.Left, columns, args)
+		if err != nil {
+			return "", err
+		}
+
+		right, err := ToSQL(e.Right, columns, args)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(e.Operator), right), nil
+
+	case *NotExpression:
+		inner, err := ToSQL(e.Expression, columns, args)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("(NOT %s)", inner), nil
+
+	case *ValuePathExpression:
+		return ToSQL(prefixPaths(e.Filter, e.Path), columns, args)
+
+	case *AttributeExpression:
+		return attributeToSQL(e, columns, args)
+	}
+
+	return "", invalidFilter("unsupported expression")
+}
+
+// prefixPaths rewrites the attribute paths inside a value path filter, so emails[value eq "x"] becomes emails.value eq "x".
+func prefixPaths(expr Expression, prefix string) Expression {
+	switch e := expr.(type) {
+	case *LogicalExpression:
+		return &LogicalExpression{Operator: e.Operator, Left: prefixPaths(e.Left, prefix), Right: prefixPaths(e.Right, prefix)}
+	case *NotExpression:
+		return &NotExpression{Expression: prefixPaths(e.Expression, prefix)}
+	case *AttributeExpression:
+		return &AttributeExpression{Path: prefix + "." + e.Path, Operator: e.Operator, Value: e.Value}
+	}
+	return expr
+}
+
+func attributeToSQL(e *AttributeExpression, columns Columns, args *[]interface{}) (string, error) {
+	column, ok := columns[NormalisePath(e.Path)]
+	if !ok {
+		return "", invalidFilter("unsupported attribute %q", e.Path)
+	}
+
+	if e.Operator == "pr" {
+		if column.Type == ColumnString || column.Type == ColumnCaseExactString {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", column.SQL, column.SQL), nil
+		}
+		return fmt.Sprintf("(%s IS NOT NULL)", column.SQL), nil
+	}
+
+	if e.Value == nil {
+		switch e.Operator {
+		case "eq":
+			return fmt.Sprintf("(%s IS NULL)", column.SQL), nil
+		case "ne":
+			return fmt.Sprintf("(%s IS NOT NULL)", column.SQL), nil
+		}
+		return "", invalidFilter("null can only be compared with eq or ne")
+	}
+
+	placeholder := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+
+	switch column.Type {
+	case ColumnBool:
+		b, ok := e.Value.(bool)
+		if !ok || (e.Operator != "eq" && e.Operator != "ne") {
+			return "", invalidFilter("%s only supports eq and ne with a boolean", e.Path)
+		}
+		return fmt.Sprintf("(%s %s %s)", column.SQL, sqlOperator(e.Operator), placeholder(b)), nil
+
+	case ColumnID:
+		s, ok := e.Value.(string)
+		if !ok || (e.Operator != "eq" && e.Operator != "ne") {
+			return "", invalidFilter("%s only supports eq and ne with a string", e.Path)
+		}
+
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			// No resource can have a non-numeric id.
+			if e.Operator == "eq" {
+				return "FALSE", nil
+			}
+			return "TRUE", nil
+		}
+		return fmt.Sprintf("(%s %s %s)", column.SQL, sqlOperator(e.Operator), placeholder(id)), nil
+
+	case ColumnTime:
+		s, ok := e.Value.(string)
+		if !ok {
+			return "", invalidFilter("%s must be compared with a date time string", e.Path)
+		}
+
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", invalidFilter("%s must be compared with an RFC3339 date time", e.Path)
+		}
+
+		switch e.Operator {
+		case "co", "sw", "ew":
+			return "", invalidFilter("%s does not support %s", e.Path, e.Operator)
+		}
+		return fmt.Sprintf("(%s %s %s)", column.SQL, sqlOperator(e.Operator), placeholder(t)), nil
+	}
+
+	s, ok := e.Value.(string)
+	if !ok {
+		return "", invalidFilter("%s must be compared with a string", e.Path)
+	}
+
+	columnSQL := column.SQL
+	if column.Type == ColumnString {
+		columnSQL = fmt.Sprintf("lower(%s)", column.SQL)
+		s = strings.ToLower(s)
+	}
+
+	switch e.Operator {
+	case "co":
+		return fmt.Sprintf("(%s LIKE %s)", columnSQL, placeholder("%"+escapeLike(s)+"%")), nil
+	case "sw":
+		return fmt.Sprintf("(%s LIKE %s)", columnSQL, placeholder(escapeLike(s)+"%")), nil
+	case "ew":
+		return fmt.Sprintf("(%s LIKE %s)", columnSQL, placeholder("%"+escapeLike(s))), nil
+	}
+
+	return fmt.Sprintf("(%s %s %s)", columnSQL, sqlOperator(e.Operator), placeholder(s)), nil
+}
+
+func sqlOperator(operator string) string {
+	switch operator {
+	case "ne":
+		return "<>"
+	case "gt":
+		return ">"
+	case "ge":
+		return ">="
+	case "lt":
+		return "<"
+	case "le":
+		return "<="
+	}
+	return "="
+}
+
+// escapeLike escapes the LIKE wildcards in s using the default backslash escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,71 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testColumns = Columns{
+	"id":           {SQL: "id", Type: ColumnID},
+	"username":     {SQL: "username", Type: ColumnString},
+	"externalid":   {SQL: "external_id", Type: ColumnCaseExactString},
+	"emails.value": {SQL: "email", Type: ColumnString},
+	"emails.type":  {SQL: "'work'", Type: ColumnString},
+	"active":       {SQL: "active", Type: ColumnBool},
+}
+
+func TestFilterToSQL(t *testing.T) {
+	tests := []struct {
+		filter string
+		sql    string
+		args   []interface{}
+	}{
+		{`userName eq "BJensen"`, `(lower(username) = $1)`, []interface{}{"bjensen"}},
+		{`externalId eq "AbC"`, `(external_id = $1)`, []interface{}{"AbC"}},
+		{`userName sw "j%" and active eq true`, `((lower(username) LIKE $1) AND (active = $2))`, []interface{}{`j\%%`, true}},
+		{`not (id eq "7") or externalId pr`, `((NOT (id = $1)) OR (external_id IS NOT NULL AND external_id <> ''))`, []interface{}{int64(7)}},
+		{`emails[type eq "work" and value co "@example.com"]`, `((lower('work') = $1) AND (lower(email) LIKE $2))`, []interface{}{"work", "%@example.com%"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "a"`, `(lower(username) = $1)`, []interface{}{"a"}},
+		{`id eq "abc"`, `FALSE`, nil},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseFilter(tt.filter)
+		if !assert.NoError(t, err, tt.filter) {
+			continue
+		}
+
+		var args []interface{}
+		sql, err := ToSQL(expr, testColumns, &args)
+
+		assert.NoError(t, err, tt.filter)
+		assert.Equal(t, tt.sql, sql, tt.filter)
+		assert.Equal(t, tt.args, args, tt.filter)
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		`userName eq`,
+		`userName xx "a"`,
+		`(userName eq "a"`,
+		`userName eq "unterminated`,
+	} {
+		_, err := ParseFilter(filter)
+		assert.ErrorIs(t, err, ErrorInvalidFilter, filter)
+	}
+
+	expr, err := ParseFilter(`password eq "secret"`)
+	assert.NoError(t, err)
+
+	var args []interface{}
+	_, err = ToSQL(expr, testColumns, &args)
+	assert.ErrorIs(t, err, ErrorInvalidFilter)
+
+	expr, err = ParseFilter(`active gt true`)
+	assert.NoError(t, err)
+
+	_, err = ToSQL(expr, testColumns, &args)
+	assert.ErrorIs(t, err, ErrorInvalidFilter)
+}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS auth_user_email_trgm_idx;
+DROP INDEX IF EXISTS auth_user_username_trgm_idx;
+DROP INDEX IF EXISTS auth_user_lastname_trgm_idx;
+DROP INDEX IF EXISTS auth_user_firstname_trgm_idx;
+DROP INDEX IF EXISTS auth_user_search_document_idx;
+
+ALTER TABLE auth_user DROP COLUMN IF EXISTS search_document;
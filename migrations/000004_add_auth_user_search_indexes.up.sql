@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS search_document tsvector
+    GENERATED ALWAYS AS (
+        to_tsvector('simple', firstname || ' ' || lastname || ' ' || username || ' ' || email)
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS auth_user_search_document_idx ON auth_user USING GIN (search_document);
+
+CREATE INDEX IF NOT EXISTS auth_user_firstname_trgm_idx ON auth_user USING GIN (firstname gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS auth_user_lastname_trgm_idx ON auth_user USING GIN (lastname gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS auth_user_username_trgm_idx ON auth_user USING GIN (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS auth_user_email_trgm_idx ON auth_user USING GIN (email gin_trgm_ops);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS scim_clients;
+
+ALTER TABLE auth_user DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,24 @@
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS external_id TEXT;
+
+CREATE TABLE IF NOT EXISTS scim_clients (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    token_hash BYTEA UNIQUE NOT NULL,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id BIGSERIAL PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    external_id TEXT,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UpdatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id BIGINT NOT NULL REFERENCES groups ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES auth_user ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    code TEXT UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    built_in BOOLEAN NOT NULL DEFAULT FALSE,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id BIGINT NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id BIGINT NOT NULL REFERENCES auth_user ON DELETE CASCADE,
+    role_id BIGINT NOT NULL REFERENCES roles ON DELETE CASCADE,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_id_idx ON user_roles (role_id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('users:read', 'List, search and view users'),
+    ('users:write', 'Update, activate, deactivate users and reset their credentials'),
+    ('users:delete', 'Delete users'),
+    ('users:import', 'Bulk import users'),
+    ('users:export', 'Export users'),
+    ('audit:read', 'View the audit trail'),
+    ('roles:read', 'View roles, permissions and role assignments'),
+    ('roles:write', 'Manage roles and assign them to users'),
+    ('scim:manage', 'Manage SCIM clients')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('admin', 'Full access to every admin endpoint', TRUE),
+    ('user-manager', 'Manage user accounts', TRUE),
+    ('auditor', 'Read-only access to users and the audit trail', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    roles.name = 'admin'
+    OR (roles.name = 'user-manager' AND permissions.code IN ('users:read', 'users:write', 'users:import', 'users:export', 'audit:read'))
+    OR (roles.name = 'auditor' AND permissions.code IN ('users:read', 'audit:read'))
+ON CONFLICT DO NOTHING;
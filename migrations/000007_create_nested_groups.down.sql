@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code IN ('groups:read', 'groups:write');
+
+DROP TABLE IF EXISTS group_roles;
+DROP TABLE IF EXISTS group_groups;
+
+DROP INDEX IF EXISTS group_members_user_id_idx;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS group_groups (
+    parent_id BIGINT NOT NULL REFERENCES groups ON DELETE CASCADE,
+    child_id BIGINT NOT NULL REFERENCES groups ON DELETE CASCADE,
+    PRIMARY KEY (parent_id, child_id),
+    CHECK (parent_id <> child_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_groups_child_id_idx ON group_groups (child_id);
+CREATE INDEX IF NOT EXISTS group_members_user_id_idx ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS group_roles (
+    group_id BIGINT NOT NULL REFERENCES groups ON DELETE CASCADE,
+    role_id BIGINT NOT NULL REFERENCES roles ON DELETE CASCADE,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_roles_role_id_idx ON group_roles (role_id);
+
+INSERT INTO permissions (code, description) VALUES
+    ('groups:read', 'List and view groups and their members'),
+    ('groups:write', 'Manage groups and their members')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    (roles.name IN ('admin', 'user-manager') AND permissions.code IN ('groups:read', 'groups:write'))
+    OR (roles.name = 'auditor' AND permissions.code = 'groups:read')
+ON CONFLICT DO NOTHING;
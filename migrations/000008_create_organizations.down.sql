@@ -0,0 +1,22 @@
+DELETE FROM roles WHERE name = 'tenant-admin' AND built_in = TRUE;
+DELETE FROM permissions WHERE code = 'organizations:manage';
+
+DROP INDEX IF EXISTS roles_organization_id_name_key;
+DELETE FROM roles WHERE organization_id IS NOT NULL AND organization_id <> 1;
+ALTER TABLE roles DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+
+ALTER TABLE audit_log DROP COLUMN IF EXISTS organization_id;
+
+DELETE FROM scim_clients WHERE organization_id <> 1;
+ALTER TABLE scim_clients DROP COLUMN IF EXISTS organization_id;
+
+DELETE FROM groups WHERE organization_id <> 1;
+ALTER TABLE groups DROP COLUMN IF EXISTS organization_id;
+
+DELETE FROM auth_user WHERE organization_id <> 1;
+ALTER TABLE auth_user DROP CONSTRAINT IF EXISTS auth_user_organization_id_email_key;
+ALTER TABLE auth_user DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE auth_user ADD CONSTRAINT auth_user_email_key UNIQUE (email);
+
+DROP TABLE IF EXISTS organizations;
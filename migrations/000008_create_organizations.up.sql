@@ -0,0 +1,53 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id BIGSERIAL PRIMARY KEY,
+    slug TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UpdatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Everything that existed before tenancy belongs to the default organization,
+-- which is also the platform organization allowed to manage the others.
+INSERT INTO organizations (id, slug, name) VALUES (1, 'default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval('organizations_id_seq', GREATEST((SELECT MAX(id) FROM organizations), 1));
+
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE auth_user ALTER COLUMN organization_id DROP DEFAULT;
+ALTER TABLE auth_user DROP CONSTRAINT IF EXISTS auth_user_email_key;
+ALTER TABLE auth_user ADD CONSTRAINT auth_user_organization_id_email_key UNIQUE (organization_id, email);
+
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE groups ALTER COLUMN organization_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS groups_organization_id_idx ON groups (organization_id);
+
+ALTER TABLE scim_clients ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 1 REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE scim_clients ALTER COLUMN organization_id DROP DEFAULT;
+
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS organization_id BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE audit_log ALTER COLUMN organization_id DROP DEFAULT;
+
+-- Built-in roles have no organization and are available in every tenant. Custom roles belong to one.
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS organization_id BIGINT REFERENCES organizations ON DELETE CASCADE;
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS roles_organization_id_name_key ON roles (COALESCE(organization_id, 0), name);
+
+UPDATE roles SET organization_id = 1 WHERE built_in = FALSE;
+
+INSERT INTO permissions (code, description) VALUES
+    ('organizations:manage', 'Create and manage organizations, only effective in the default organization')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('tenant-admin', 'Full access to the users, groups and roles of the organization', TRUE)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    (roles.name = 'admin' AND permissions.code = 'organizations:manage')
+    OR (roles.name = 'tenant-admin' AND permissions.code <> 'organizations:manage')
+WHERE roles.built_in = TRUE
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code IN ('authz:check', 'authz:write');
+
+DROP TABLE IF EXISTS authz_revisions;
+DROP TABLE IF EXISTS relation_tuples;
+DROP TABLE IF EXISTS authz_namespaces;
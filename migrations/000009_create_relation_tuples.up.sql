@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS authz_namespaces (
+    organization_id BIGINT NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    config JSONB NOT NULL,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UpdatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS relation_tuples (
+    organization_id BIGINT NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    namespace TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    relation TEXT NOT NULL,
+    subject_namespace TEXT NOT NULL,
+    subject_object_id TEXT NOT NULL,
+    subject_relation TEXT NOT NULL DEFAULT '',
+    revision BIGINT NOT NULL,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation)
+);
+
+CREATE INDEX IF NOT EXISTS relation_tuples_subject_idx ON relation_tuples (organization_id, subject_namespace, subject_object_id);
+
+-- Every write to the tuples of an organization bumps its revision. Writers lock the row,
+-- so revisions are committed in order and a consistency token can be compared with it.
+CREATE TABLE IF NOT EXISTS authz_revisions (
+    organization_id BIGINT PRIMARY KEY REFERENCES organizations ON DELETE CASCADE,
+    revision BIGINT NOT NULL
+);
+
+INSERT INTO permissions (code, description) VALUES
+    ('authz:check', 'Check and expand relationship-based permissions'),
+    ('authz:write', 'Write relation tuples and namespace configurations')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    roles.name IN ('admin', 'tenant-admin') AND permissions.code IN ('authz:check', 'authz:write')
+WHERE roles.built_in = TRUE
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code IN ('policies:read', 'policies:write');
+
+DROP TABLE IF EXISTS user_attributes;
+DROP TABLE IF EXISTS policies;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS policies (
+    id BIGSERIAL PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    effect TEXT NOT NULL CHECK (effect IN ('allow', 'deny')),
+    actions TEXT[] NOT NULL,
+    resources TEXT[] NOT NULL,
+    condition TEXT NOT NULL DEFAULT '',
+    mode TEXT NOT NULL DEFAULT 'enforce' CHECK (mode IN ('enforce', 'dry_run')),
+    version INTEGER NOT NULL DEFAULT 1,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UpdatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+
+-- Free-form attributes such as region or department that policy conditions can refer to.
+CREATE TABLE IF NOT EXISTS user_attributes (
+    user_id BIGINT PRIMARY KEY REFERENCES auth_user ON DELETE CASCADE,
+    attributes JSONB NOT NULL DEFAULT '{}'
+);
+
+INSERT INTO permissions (code, description) VALUES
+    ('policies:read', 'List and view access policies'),
+    ('policies:write', 'Manage access policies and user attributes')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    (roles.name IN ('admin', 'tenant-admin') AND permissions.code IN ('policies:read', 'policies:write'))
+    OR (roles.name = 'auditor' AND permissions.code = 'policies:read')
+WHERE roles.built_in = TRUE
+ON CONFLICT DO NOTHING;
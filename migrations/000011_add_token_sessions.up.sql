@@ -0,0 +1,9 @@
+-- Authentication tokens double as sessions: remember where each was issued and last used.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS id BIGSERIAL UNIQUE;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS device TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
@@ -0,0 +1,10 @@
+-- Failed logins per email address and per client IP address, used to slow down password guessing.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    organization_id BIGINT NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('email', 'ip')),
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP(0) WITH TIME ZONE,
+    PRIMARY KEY (organization_id, kind, key)
+);
@@ -0,0 +1,2 @@
+-- Set when a user logs in with a password found in a data breach, until they change it.
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS password_breached_at TIMESTAMP(0) WITH TIME ZONE;
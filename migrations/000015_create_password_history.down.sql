@@ -0,0 +1,4 @@
+ALTER TABLE auth_user DROP COLUMN IF EXISTS password_placeholder;
+ALTER TABLE auth_user DROP COLUMN IF EXISTS password_expiry_reminded_at;
+ALTER TABLE auth_user DROP COLUMN IF EXISTS password_changed_at;
+DROP TABLE IF EXISTS password_history;
@@ -0,0 +1,16 @@
+-- Hashes of the passwords users had before their current one, which they must not reuse.
+CREATE TABLE IF NOT EXISTS password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES auth_user ON DELETE CASCADE,
+    password_hash bytea NOT NULL,
+    CreatedAt TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS password_history_user_id_idx ON password_history (user_id, id);
+
+-- Existing passwords count as changed when the migration runs, so that they don't all expire at once.
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+-- Set when the user is reminded that their password expires, until they change it.
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS password_expiry_reminded_at TIMESTAMP(0) WITH TIME ZONE;
+-- Random passwords nobody knows, such as the one of a forced reset, which are kept out of the history.
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS password_placeholder BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,217 @@
+package authclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListPermissions returns every permission code roles can grant.
+func (c *Client) ListPermissions(ctx context.Context) ([]string, error) {
+	var permissions []string
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/permissions", nil, nil, &permissions, nil)
+	return permissions, err
+}
+
+// ListRoles returns every role.
+func (c *Client) ListRoles(ctx context.Context) ([]*Role, error) {
+	var roles []*Role
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/roles", nil, nil, &roles, nil)
+	return roles, err
+}
+
+// CreateRole creates a role granting permissions.
+func (c *Client) CreateRole(ctx context.Context, name, description string, permissions []string) (*Role, error) {
+	in := map[string]interface{}{"name": name, "description": description, "permissions": permissions}
+
+	var role Role
+	err := c.callData(ctx, http.MethodPost, "/v1/admin/roles", nil, in, &role, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetRole returns a role.
+func (c *Client) GetRole(ctx context.Context, id int64) (*Role, error) {
+	var role Role
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/roles/%d", id), nil, nil, &role, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UpdateRole changes the given fields of a role.
+func (c *Client) UpdateRole(ctx context.Context, id int64, update RoleUpdate) (*Role, error) {
+	var role Role
+	err := c.callData(ctx, http.MethodPatch, pathf("/v1/admin/roles/%d", id), nil, update, &role, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// DeleteRole deletes a role that isn't built in.
+func (c *Client) DeleteRole(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/roles/%d", id), nil, nil, nil, nil)
+}
+
+// ListGroups lists groups.
+func (c *Client) ListGroups(ctx context.Context, page Page) ([]*Group, *Metadata, error) {
+	var groups []*Group
+	var metadata Metadata
+
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/groups", page.values(), nil, &groups, &metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	return groups, &metadata, nil
+}
+
+// CreateGroup creates a group with the users members.
+func (c *Client) CreateGroup(ctx context.Context, displayName string, members []int64) (*Group, error) {
+	in := map[string]interface{}{"display_name": displayName, "members": members}
+
+	var group Group
+	err := c.callData(ctx, http.MethodPost, "/v1/admin/groups", nil, in, &group, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroup returns a group.
+func (c *Client) GetGroup(ctx context.Context, id int64) (*Group, error) {
+	var group Group
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/groups/%d", id), nil, nil, &group, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// RenameGroup changes the display name of a group.
+func (c *Client) RenameGroup(ctx context.Context, id int64, displayName string) (*Group, error) {
+	var group Group
+	err := c.callData(ctx, http.MethodPatch, pathf("/v1/admin/groups/%d", id), nil, map[string]string{"display_name": displayName}, &group, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// DeleteGroup deletes a group.
+func (c *Client) DeleteGroup(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/groups/%d", id), nil, nil, nil, nil)
+}
+
+// ListGroupMembers returns the members of a group, including those of its subgroups when transitive is set.
+func (c *Client) ListGroupMembers(ctx context.Context, id int64, transitive bool) ([]*GroupMember, error) {
+	var qs url.Values
+	if transitive {
+		qs = url.Values{"transitive": {"true"}}
+	}
+
+	var members []*GroupMember
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/groups/%d/members", id), qs, nil, &members, nil)
+	return members, err
+}
+
+// AddGroupMember adds a user to a group.
+func (c *Client) AddGroupMember(ctx context.Context, id, userID int64) error {
+	return c.callData(ctx, http.MethodPost, pathf("/v1/admin/groups/%d/members", id), nil, map[string]int64{"user_id": userID}, nil, nil)
+}
+
+// RemoveGroupMember removes a user from a group.
+func (c *Client) RemoveGroupMember(ctx context.Context, id, userID int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/groups/%d/members/%d", id, userID), nil, nil, nil, nil)
+}
+
+// AddSubgroup makes a group a member of another.
+func (c *Client) AddSubgroup(ctx context.Context, id, groupID int64) error {
+	return c.callData(ctx, http.MethodPost, pathf("/v1/admin/groups/%d/groups", id), nil, map[string]int64{"group_id": groupID}, nil, nil)
+}
+
+// RemoveSubgroup removes a group from another.
+func (c *Client) RemoveSubgroup(ctx context.Context, id, groupID int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/groups/%d/groups/%d", id, groupID), nil, nil, nil, nil)
+}
+
+// AssignGroupRole gives every member of a group a role.
+func (c *Client) AssignGroupRole(ctx context.Context, id int64, role string) error {
+	return c.callData(ctx, http.MethodPost, pathf("/v1/admin/groups/%d/roles", id), nil, map[string]string{"role": role}, nil, nil)
+}
+
+// RemoveGroupRole takes a role from a group.
+func (c *Client) RemoveGroupRole(ctx context.Context, id int64, role string) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/groups/%d/roles/%s", id, role), nil, nil, nil, nil)
+}
+
+// CreateSCIMClient registers a SCIM client and returns it with its bearer token, which is only shown once.
+func (c *Client) CreateSCIMClient(ctx context.Context, name string) (*SCIMClient, string, error) {
+	var data struct {
+		Client *SCIMClient `json:"client"`
+		Token  string      `json:"token"`
+	}
+
+	err := c.callData(ctx, http.MethodPost, "/v1/admin/scim/clients", nil, map[string]string{"name": name}, &data, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return data.Client, data.Token, nil
+}
+
+// ListSCIMClients returns the SCIM clients.
+func (c *Client) ListSCIMClients(ctx context.Context) ([]*SCIMClient, error) {
+	var clients []*SCIMClient
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/scim/clients", nil, nil, &clients, nil)
+	return clients, err
+}
+
+// DeleteSCIMClient revokes a SCIM client.
+func (c *Client) DeleteSCIMClient(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/scim/clients/%d", id), nil, nil, nil, nil)
+}
+
+// ListOrganizations returns every organization. Only platform admins of the default organization may call it.
+func (c *Client) ListOrganizations(ctx context.Context) ([]*Organization, error) {
+	var organizations []*Organization
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/organizations", nil, nil, &organizations, nil)
+	return organizations, err
+}
+
+// CreateOrganization creates an organization.
+func (c *Client) CreateOrganization(ctx context.Context, organization NewOrganization) (*Organization, error) {
+	var created Organization
+	err := c.callData(ctx, http.MethodPost, "/v1/admin/organizations", nil, organization, &created, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetOrganization returns an organization.
+func (c *Client) GetOrganization(ctx context.Context, id int64) (*Organization, error) {
+	var organization Organization
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/organizations/%d", id), nil, nil, &organization, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// UpdateOrganization changes the given fields of an organization.
+func (c *Client) UpdateOrganization(ctx context.Context, id int64, update OrganizationUpdate) (*Organization, error) {
+	var organization Organization
+	err := c.callData(ctx, http.MethodPatch, pathf("/v1/admin/organizations/%d", id), nil, update, &organization, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// DeleteOrganization deletes an organization and everything in it.
+func (c *Client) DeleteOrganization(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/organizations/%d", id), nil, nil, nil, nil)
+}
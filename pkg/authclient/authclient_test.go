@@ -0,0 +1,110 @@
+package authclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseError(t *testing.T) {
+	err := parseError(400, []byte(`{"error": true, "message": "no user found with such token"}`))
+	assert.Equal(t, "authclient: 400: no user found with such token", err.Error())
+
+	err = parseError(401, []byte(`{"error": "invalid or missing authentication token"}`))
+	assert.True(t, IsStatus(err, http.StatusUnauthorized))
+
+	err = parseError(422, []byte(`{"error": {"email": "must be provided"}}`))
+	assert.Equal(t, map[string]string{"email": "must be provided"}, err.(*Error).Fields)
+
+	err = parseError(422, []byte(`{"error": {"password": "must be at least 8 characters long"}, "password_feedback": {"violations": [{"code": "too_short", "message": "must be at least 8 characters long"}], "strength": {"score": 0}}}`))
+	assert.Equal(t, "too_short", err.(*Error).PasswordFeedback.Violations[0].Code)
+
+	err = parseError(403, []byte(`{"error": "password_expired", "message": "your password has expired", "password_change_token": {"token": "ABC", "expiry": "2026-01-01T00:00:00Z"}}`))
+	assert.Equal(t, "password_expired", err.(*Error).Message)
+	assert.Equal(t, "ABC", err.(*Error).PasswordChangeToken)
+
+	err = parseError(502, []byte(`<html>`))
+	assert.Equal(t, "Bad Gateway", err.(*Error).Message)
+}
+
+func TestIntrospectionMiddleware(t *testing.T) {
+	calls := 0
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		var in struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+
+		if r.URL.Path != "/api/v1/user" || in.Token != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": true, "message": "no user found with such token"}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"success": true, "data": {"id": 7, "email": "a@example.com", "active": true, "roles": ["support"], "permissions": ["users:read"]}, "metadata": {"token_expiry": %q}}`, expiry.Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	m := NewMiddleware(New(srv.URL).Introspector(), time.Minute)
+
+	handler := m.Handler(m.RequirePermission("users:read", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := ContextGetPrincipal(r)
+		assert.Equal(t, int64(7), principal.UserID)
+		assert.True(t, principal.ExpiresAt.Equal(expiry))
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	for _, tt := range []struct {
+		header string
+		want   int
+	}{
+		{"Bearer good", http.StatusNoContent},
+		{"Bearer good", http.StatusNoContent},
+		{"Bearer bad", http.StatusUnauthorized},
+		{"Basic good", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		assert.Equal(t, tt.want, rr.Code, tt.header)
+	}
+
+	// The second good request was served from the cache.
+	assert.Equal(t, 2, calls)
+}
+
+func TestCacheBoundedByExpiry(t *testing.T) {
+	now := time.Now()
+	verifier := VerifierFunc(func(ctx context.Context, token string) (*Principal, error) {
+		return &Principal{UserID: 1, ExpiresAt: now.Add(10 * time.Second)}, nil
+	})
+
+	m := NewMiddleware(verifier, time.Minute)
+	m.now = func() time.Time { return now }
+
+	_, err := m.Verify(context.Background(), "token")
+	assert.NoError(t, err)
+
+	_, ok := m.lookup(sha256.Sum256([]byte("token")))
+	assert.True(t, ok)
+
+	now = now.Add(11 * time.Second)
+	_, ok = m.lookup(sha256.Sum256([]byte("token")))
+	assert.False(t, ok)
+}
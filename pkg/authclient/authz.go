@@ -0,0 +1,148 @@
+package authclient
+
+import (
+	"context"
+	"net/http"
+)
+
+// Check asks whether a subject has a relation to an object.
+func (c *Client) Check(ctx context.Context, req CheckRequest) (*CheckResult, error) {
+	var result CheckResult
+	err := c.callData(ctx, http.MethodPost, "/v1/authz/check", nil, req, &result, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Expand returns the userset tree of a relation of an object and the snapshot it was expanded at.
+func (c *Client) Expand(ctx context.Context, object, relation, consistencyToken string) (*Tree, string, error) {
+	in := map[string]string{"object": object, "relation": relation, "consistency_token": consistencyToken}
+
+	var data struct {
+		Tree       *Tree  `json:"tree"`
+		ExpandedAt string `json:"expanded_at"`
+	}
+
+	err := c.callData(ctx, http.MethodPost, "/v1/authz/expand", nil, in, &data, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return data.Tree, data.ExpandedAt, nil
+}
+
+// WriteTuples writes and deletes relation tuples, e.g. "doc:readme#owner@user:10", in one
+// transaction. The returned consistency token makes later checks see the change.
+func (c *Client) WriteTuples(ctx context.Context, writes, deletes []string) (string, error) {
+	in := map[string][]string{"writes": writes, "deletes": deletes}
+
+	var data struct {
+		ConsistencyToken string `json:"consistency_token"`
+	}
+
+	err := c.callData(ctx, http.MethodPost, "/v1/authz/tuples", nil, in, &data, nil)
+	return data.ConsistencyToken, err
+}
+
+// ListTuples lists the relation tuples matching filter.
+func (c *Client) ListTuples(ctx context.Context, filter TupleFilter) ([]string, *Metadata, error) {
+	qs := filter.Page.values()
+	for key, value := range map[string]string{"namespace": filter.Namespace, "object_id": filter.ObjectID, "relation": filter.Relation, "subject": filter.Subject} {
+		if value != "" {
+			qs.Set(key, value)
+		}
+	}
+
+	var tuples []string
+	var metadata Metadata
+
+	err := c.callData(ctx, http.MethodGet, "/v1/authz/tuples", qs, nil, &tuples, &metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tuples, &metadata, nil
+}
+
+// ListNamespaces returns the namespace configurations.
+func (c *Client) ListNamespaces(ctx context.Context) ([]*Namespace, error) {
+	var namespaces []*Namespace
+	err := c.callData(ctx, http.MethodGet, "/v1/authz/namespaces", nil, nil, &namespaces, nil)
+	return namespaces, err
+}
+
+// PutNamespace creates or replaces a namespace configuration.
+func (c *Client) PutNamespace(ctx context.Context, namespace Namespace) (*Namespace, error) {
+	var saved Namespace
+	err := c.callData(ctx, http.MethodPut, pathf("/v1/authz/namespaces/%s", namespace.Name), nil, map[string]interface{}{"relations": namespace.Relations}, &saved, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteNamespace deletes a namespace without tuples.
+func (c *Client) DeleteNamespace(ctx context.Context, name string) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/authz/namespaces/%s", name), nil, nil, nil, nil)
+}
+
+// Evaluate evaluates the access policies for an action on a resource.
+func (c *Client) Evaluate(ctx context.Context, req EvaluateRequest) (*Decision, error) {
+	var decision Decision
+	err := c.callData(ctx, http.MethodPost, "/v1/authz/evaluate", nil, req, &decision, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+// ListPolicies returns the policies of the organization and those loaded from files.
+func (c *Client) ListPolicies(ctx context.Context) ([]*Policy, error) {
+	var policies []*Policy
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/policies", nil, nil, &policies, nil)
+	return policies, err
+}
+
+// CreatePolicy creates a policy. The id, source and timestamps of policy are ignored.
+func (c *Client) CreatePolicy(ctx context.Context, policy Policy) (*Policy, error) {
+	in := map[string]interface{}{
+		"name":        policy.Name,
+		"description": policy.Description,
+		"effect":      policy.Effect,
+		"actions":     policy.Actions,
+		"resources":   policy.Resources,
+		"condition":   policy.Condition,
+		"mode":        policy.Mode,
+	}
+
+	var created Policy
+	err := c.callData(ctx, http.MethodPost, "/v1/admin/policies", nil, in, &created, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetPolicy returns a policy.
+func (c *Client) GetPolicy(ctx context.Context, id int64) (*Policy, error) {
+	var policy Policy
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/policies/%d", id), nil, nil, &policy, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpdatePolicy changes the given fields of a policy.
+func (c *Client) UpdatePolicy(ctx context.Context, id int64, update PolicyUpdate) (*Policy, error) {
+	var policy Policy
+	err := c.callData(ctx, http.MethodPatch, pathf("/v1/admin/policies/%d", id), nil, update, &policy, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeletePolicy deletes a policy.
+func (c *Client) DeletePolicy(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/policies/%d", id), nil, nil, nil, nil)
+}
@@ -0,0 +1,239 @@
+/*
+Package authclient is the Go client of the auth service, for services that authenticate their
+users with it.
+
+Client calls the API with typed requests and responses:
+
+	client := authclient.New("https://auth.example.com").WithToken(serviceToken)
+	user, err := client.GetUser(ctx, 42)
+
+Middleware authenticates the bearer tokens of incoming requests by introspection through a
+Client, and caches the results:
+
+	m := authclient.NewMiddleware(client.Introspector(), time.Minute)
+	mux.Handle("/reports", m.Handler(m.RequirePermission("reports:read", reportsHandler)))
+
+Handlers read the caller with ContextGetPrincipal, like the service's own handlers use ContextGetUser.
+*/
+package authclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+Client calls the auth service API. Token is sent as the bearer token of every request and Tenant,
+when set, as the X-Tenant header selecting the organization. Clients are safe for concurrent use
+and cheap to copy.
+*/
+type Client struct {
+	BaseURL    string
+	Token      string
+	Tenant     string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the service at baseURL, with a 10 second timeout.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithToken returns a copy of the client that authenticates with token.
+func (c *Client) WithToken(token string) *Client {
+	cc := *c
+	cc.Token = token
+	return &cc
+}
+
+// WithTenant returns a copy of the client that calls the organization with the slug tenant.
+func (c *Client) WithTenant(tenant string) *Client {
+	cc := *c
+	cc.Tenant = tenant
+	return &cc
+}
+
+/*
+Error is returned for responses with an error status. Message holds the error message and Fields
+the field errors of failed validations. PasswordFeedback explains why a new password was rejected.
+*/
+type Error struct {
+	StatusCode       int
+	Message          string
+	Fields           map[string]string
+	PasswordFeedback *PasswordFeedback
+	// PasswordChangeToken is set when a login is refused because the password expired, see ChangeExpiredPassword.
+	PasswordChangeToken string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) > 0 {
+		parts := make([]string, 0, len(e.Fields))
+		for field, message := range e.Fields {
+			parts = append(parts, field+": "+message)
+		}
+		return fmt.Sprintf("authclient: %d: %s", e.StatusCode, strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("authclient: %d: %s", e.StatusCode, e.Message)
+}
+
+// IsStatus reports whether err is an *Error with the status code.
+func IsStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+// response is the envelope most endpoints answer with.
+type response struct {
+	Data     json.RawMessage `json:"data"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// parseError reads the error out of the response bodies the service writes: {"error": true, "message": ...},
+// {"error": "message"} or {"error": {"field": "message"}}.
+func parseError(status int, body []byte) error {
+	e := &Error{StatusCode: status, Message: http.StatusText(status)}
+
+	var envelope struct {
+		Error            json.RawMessage   `json:"error"`
+		Message          string            `json:"message"`
+		PasswordFeedback *PasswordFeedback `json:"password_feedback"`
+		PasswordChange   struct {
+			Token string `json:"token"`
+		} `json:"password_change_token"`
+	}
+
+	if json.Unmarshal(body, &envelope) != nil {
+		return e
+	}
+
+	e.PasswordFeedback = envelope.PasswordFeedback
+	e.PasswordChangeToken = envelope.PasswordChange.Token
+
+	var message string
+	switch {
+	case json.Unmarshal(envelope.Error, &message) == nil:
+		e.Message = message
+	case json.Unmarshal(envelope.Error, &e.Fields) == nil:
+		e.Message = "failed validation"
+	case envelope.Message != "":
+		e.Message = envelope.Message
+	}
+
+	return e
+}
+
+// send makes a request and returns the response when it succeeded. The caller must close its body.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Tenant != "" {
+		req.Header.Set("X-Tenant", c.Tenant)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		return nil, parseError(res.StatusCode, b)
+	}
+
+	return res, nil
+}
+
+// call sends in as a JSON body and decodes the response body into out.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	var contentType string
+
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	}
+
+	res, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// callData is call for endpoints that wrap their result in the data field, decoding it into data
+// and the metadata field into metadata when it isn't nil.
+func (c *Client) callData(ctx context.Context, method, path string, query url.Values, in, data, metadata interface{}) error {
+	var res response
+
+	err := c.call(ctx, method, path, query, in, &res)
+	if err != nil {
+		return err
+	}
+
+	if data != nil && len(res.Data) > 0 {
+		err = json.Unmarshal(res.Data, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if metadata != nil && len(res.Metadata) > 0 {
+		return json.Unmarshal(res.Metadata, metadata)
+	}
+
+	return nil
+}
+
+// pathf formats a path, escaping the string arguments.
+func pathf(format string, args ...interface{}) string {
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			args[i] = url.PathEscape(s)
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
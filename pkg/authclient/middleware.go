@@ -0,0 +1,319 @@
+package authclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorInvalidToken is returned by verifiers for tokens that are unknown, expired or badly signed.
+var ErrorInvalidToken = errors.New("invalid or expired token")
+
+/*
+Principal is the authenticated caller of a request, the counterpart of the service's data.User.
+ExpiresAt is when its token expires, if known.
+*/
+type Principal struct {
+	UserID         int64     `json:"id"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	OrganizationID int64     `json:"organization_id"`
+	Roles          []string  `json:"roles"`
+	Permissions    []string  `json:"permissions"`
+	Groups         []string  `json:"groups"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// AnonymousPrincipal is the principal of requests without a token.
+var AnonymousPrincipal = &Principal{}
+
+// IsAnonymous reports whether p is the anonymous principal.
+func (p *Principal) IsAnonymous() bool {
+	return p == AnonymousPrincipal
+}
+
+// HasRole reports whether the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasPermission reports whether the principal has the permission code.
+func (p *Principal) HasPermission(code string) bool {
+	return contains(p.Permissions, code)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Verifier turns a bearer token into the principal it was issued to. Invalid tokens give
+ErrorInvalidToken, other errors mean the token couldn't be checked.
+*/
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+// VerifierFunc adapts a function to Verifier.
+type VerifierFunc func(ctx context.Context, token string) (*Principal, error)
+
+// Verify calls f.
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+// Introspector returns a verifier that asks the service about every token through the client.
+func (c *Client) Introspector() Verifier {
+	return VerifierFunc(func(ctx context.Context, token string) (*Principal, error) {
+		user, expiry, err := c.Introspect(ctx, token)
+		if err != nil {
+			// The service answers 400 for tokens it doesn't know.
+			if IsStatus(err, http.StatusBadRequest) || IsStatus(err, http.StatusUnauthorized) {
+				return nil, ErrorInvalidToken
+			}
+			return nil, err
+		}
+
+		if !user.Active {
+			return nil, ErrorInvalidToken
+		}
+
+		return &Principal{
+			UserID:         user.ID,
+			Username:       user.Username,
+			Email:          user.Email,
+			OrganizationID: user.OrganizationID,
+			Roles:          user.Roles,
+			Permissions:    user.Permissions,
+			Groups:         user.Groups,
+			ExpiresAt:      expiry,
+		}, nil
+	})
+}
+
+type contextKey string
+
+const principalContextKey = contextKey("principal")
+
+// ContextSetPrincipal returns a copy of r carrying the principal.
+func ContextSetPrincipal(r *http.Request, principal *Principal) *http.Request {
+	ctx := context.WithValue(r.Context(), principalContextKey, principal)
+	return r.WithContext(ctx)
+}
+
+// ContextGetPrincipal returns the principal of a request that went through Middleware.Handler.
+// It panics for requests that didn't, which is a programming error.
+func ContextGetPrincipal(r *http.Request) *Principal {
+	principal, ok := r.Context().Value(principalContextKey).(*Principal)
+	if !ok {
+		panic("missing principal value in request context")
+	}
+	return principal
+}
+
+type cacheEntry struct {
+	principal *Principal
+	expires   time.Time
+}
+
+/*
+Middleware authenticates requests with a Verifier. Verified tokens are cached for TTL, but never
+beyond their expiry; a token revoked on the service can therefore keep working for up to TTL.
+
+MaxEntries bounds the cache, 10000 when zero. Set ErrorHandler to change the JSON error responses.
+*/
+type Middleware struct {
+	Verifier     Verifier
+	TTL          time.Duration
+	MaxEntries   int
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cacheEntry
+	now   func() time.Time
+}
+
+// NewMiddleware returns a middleware that caches the principals verifier returns for ttl.
+func NewMiddleware(verifier Verifier, ttl time.Duration) *Middleware {
+	return &Middleware{Verifier: verifier, TTL: ttl}
+}
+
+func (m *Middleware) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+func (m *Middleware) lookup(key [sha256.Size]byte) (*Principal, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.cache[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !m.clock().Before(entry.expires) {
+		delete(m.cache, key)
+		return nil, false
+	}
+
+	return entry.principal, true
+}
+
+func (m *Middleware) store(key [sha256.Size]byte, principal *Principal) {
+	now := m.clock()
+
+	expires := now.Add(m.TTL)
+	if !principal.ExpiresAt.IsZero() && principal.ExpiresAt.Before(expires) {
+		expires = principal.ExpiresAt
+	}
+
+	if !now.Before(expires) {
+		return
+	}
+
+	maxEntries := m.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = 10000
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cache == nil {
+		m.cache = map[[sha256.Size]byte]cacheEntry{}
+	}
+
+	if len(m.cache) >= maxEntries {
+		for k, entry := range m.cache {
+			if !now.Before(entry.expires) {
+				delete(m.cache, k)
+			}
+		}
+
+		// Still full of live entries: start over rather than track usage.
+		if len(m.cache) >= maxEntries {
+			m.cache = map[[sha256.Size]byte]cacheEntry{}
+		}
+	}
+
+	m.cache[key] = cacheEntry{principal: principal, expires: expires}
+}
+
+// Verify returns the principal of token, from the cache when possible.
+func (m *Middleware) Verify(ctx context.Context, token string) (*Principal, error) {
+	key := sha256.Sum256([]byte(token))
+
+	if principal, ok := m.lookup(key); ok {
+		return principal, nil
+	}
+
+	principal, err := m.Verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.TTL > 0 {
+		m.store(key, principal)
+	}
+
+	return principal, nil
+}
+
+func (m *Middleware) error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if m.ErrorHandler != nil {
+		m.ErrorHandler(w, r, status, err)
+		return
+	}
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+/*
+Handler authenticates the bearer token of each request and puts its principal into the request
+context. Requests without an Authorization header get AnonymousPrincipal; invalid tokens are
+answered with 401, like the service's own authenticate middleware.
+*/
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, ContextSetPrincipal(r, AnonymousPrincipal))
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || scheme != "Bearer" || token == "" {
+			m.error(w, r, http.StatusUnauthorized, ErrorInvalidToken)
+			return
+		}
+
+		principal, err := m.Verify(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, ErrorInvalidToken) {
+				m.error(w, r, http.StatusUnauthorized, ErrorInvalidToken)
+			} else {
+				m.error(w, r, http.StatusServiceUnavailable, errors.New("the token could not be verified"))
+			}
+			return
+		}
+
+		next.ServeHTTP(w, ContextSetPrincipal(r, principal))
+	})
+}
+
+// RequireAuthenticated answers 401 to anonymous requests.
+func (m *Middleware) RequireAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ContextGetPrincipal(r).IsAnonymous() {
+			m.error(w, r, http.StatusUnauthorized, errors.New("you must be authenticated to access this resource"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission answers 403 to principals without the permission code, and 401 to anonymous requests.
+func (m *Middleware) RequirePermission(code string, next http.Handler) http.Handler {
+	return m.RequireAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ContextGetPrincipal(r).HasPermission(code) {
+			m.error(w, r, http.StatusForbidden, errors.New("your user account doesn't have the necessary permissions to access this resource"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireRole answers 403 to principals without one of the roles, and 401 to anonymous requests.
+func (m *Middleware) RequireRole(next http.Handler, roles ...string) http.Handler {
+	return m.RequireAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := ContextGetPrincipal(r)
+		for _, role := range roles {
+			if principal.HasRole(role) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		m.error(w, r, http.StatusForbidden, errors.New("your user account doesn't have the necessary permissions to access this resource"))
+	}))
+}
@@ -0,0 +1,345 @@
+package authclient
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// User is a user account.
+type User struct {
+	ID             int64     `json:"id"`
+	FirstName      string    `json:"firstname"`
+	LastName       string    `json:"lastname"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	Active         bool      `json:"active"`
+	ExternalID     string    `json:"external_id,omitempty"`
+	OrganizationID int64     `json:"organization_id"`
+	CreatedAt      time.Time `json:"CreatedAt"`
+	UpdatedAt      time.Time `json:"UpdatedAt"`
+
+	// Roles, Permissions and Groups are only returned by token introspection.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+}
+
+// Metadata describes a page of results.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records"`
+}
+
+// Page selects a page of results. Zero values use the server's defaults.
+type Page struct {
+	Page     int
+	PageSize int
+}
+
+func (p Page) values() url.Values {
+	qs := url.Values{}
+	if p.Page > 0 {
+		qs.Set("page", strconv.Itoa(p.Page))
+	}
+	if p.PageSize > 0 {
+		qs.Set("page_size", strconv.Itoa(p.PageSize))
+	}
+	return qs
+}
+
+// UserFilters filters user lists and exports. Nil and zero fields don't filter.
+type UserFilters struct {
+	Search        string
+	Active        *bool
+	Role          *int
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string
+	Page
+}
+
+func (f UserFilters) values() url.Values {
+	qs := f.Page.values()
+	if f.Search != "" {
+		qs.Set("q", f.Search)
+	}
+	if f.Active != nil {
+		qs.Set("active", strconv.FormatBool(*f.Active))
+	}
+	if f.Role != nil {
+		qs.Set("role", strconv.Itoa(*f.Role))
+	}
+	if f.CreatedAfter != nil {
+		qs.Set("created_after", f.CreatedAfter.Format(time.RFC3339))
+	}
+	if f.CreatedBefore != nil {
+		qs.Set("created_before", f.CreatedBefore.Format(time.RFC3339))
+	}
+	if f.Sort != "" {
+		qs.Set("sort", f.Sort)
+	}
+	return qs
+}
+
+// AuthenticationToken is the result of logging in.
+type AuthenticationToken struct {
+	Token       string    `json:"token"`
+	Expiry      time.Time `json:"expiry"`
+	Roles       []string  `json:"roles"`
+	Permissions []string  `json:"permissions"`
+	Groups      []string  `json:"groups"`
+}
+
+// Registration holds the details of a new account.
+type Registration struct {
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+}
+
+// UserUpdate holds the user fields to change. Nil fields are left as they are.
+type UserUpdate struct {
+	FirstName *string `json:"firstname,omitempty"`
+	LastName  *string `json:"lastname,omitempty"`
+	Username  *string `json:"username,omitempty"`
+	Email     *string `json:"email,omitempty"`
+}
+
+// SearchResult is a user matching a search, with the matched text highlighted per field.
+type SearchResult struct {
+	User       *User             `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// AuditEntry records an admin action on a user.
+type AuditEntry struct {
+	ID           int64                  `json:"id"`
+	ActorID      int64                  `json:"actor_id"`
+	Action       string                 `json:"action"`
+	TargetUserID int64                  `json:"target_user_id"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	CreatedAt    time.Time              `json:"CreatedAt"`
+}
+
+// Session is an authentication token as seen by its owner.
+type Session struct {
+	ID         int64      `json:"id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	Current    bool       `json:"current"`
+}
+
+// PasswordFeedback explains why the service rejected a new password.
+type PasswordFeedback struct {
+	Violations []PasswordViolation `json:"violations"`
+	Strength   PasswordStrength    `json:"strength"`
+}
+
+// PasswordViolation is a rule of the password policy a password breaks, such as too_short.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordStrength estimates how hard a password is to guess, Score going from 0 to 4.
+type PasswordStrength struct {
+	GuessesLog10 float64  `json:"guesses_log10"`
+	Score        int      `json:"score"`
+	Warning      string   `json:"warning"`
+	Suggestions  []string `json:"suggestions"`
+}
+
+// Access lists the roles, permissions and groups of a user.
+type Access struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Groups      []string `json:"groups"`
+}
+
+// ImportResult reports which rows of an import created users and which were rejected.
+type ImportResult struct {
+	Imported []struct {
+		ID       int64  `json:"id"`
+		Email    string `json:"email"`
+		Username string `json:"username"`
+		Line     int    `json:"line"`
+	} `json:"imported"`
+	Errors []struct {
+		Line   int               `json:"line"`
+		Email  string            `json:"email,omitempty"`
+		Errors map[string]string `json:"errors"`
+	} `json:"errors"`
+}
+
+// Role grants a set of permissions.
+type Role struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BuiltIn     bool      `json:"built_in"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+}
+
+// RoleUpdate holds the role fields to change. Nil fields are left as they are.
+type RoleUpdate struct {
+	Name        *string   `json:"name,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Permissions *[]string `json:"permissions,omitempty"`
+}
+
+// Group is a group of users and other groups.
+type Group struct {
+	ID          int64          `json:"id"`
+	DisplayName string         `json:"display_name"`
+	ExternalID  string         `json:"external_id,omitempty"`
+	Members     []*GroupMember `json:"members"`
+	Subgroups   []*Subgroup    `json:"groups"`
+	Roles       []string       `json:"roles,omitempty"`
+	CreatedAt   time.Time      `json:"CreatedAt"`
+	UpdatedAt   time.Time      `json:"UpdatedAt"`
+}
+
+// GroupMember is a user in a group.
+type GroupMember struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Subgroup is a group in a group.
+type Subgroup struct {
+	GroupID     int64  `json:"group_id"`
+	DisplayName string `json:"display_name"`
+}
+
+// SCIMClient is an identity provider allowed to provision users over SCIM.
+type SCIMClient struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Organization is a tenant of the service.
+type Organization struct {
+	ID        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// NewOrganization holds the details of a new organization. Admin, when set, is invited as its first admin.
+type NewOrganization struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Admin *struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	} `json:"admin,omitempty"`
+}
+
+// OrganizationUpdate holds the organization fields to change. Nil fields are left as they are.
+type OrganizationUpdate struct {
+	Slug *string `json:"slug,omitempty"`
+	Name *string `json:"name,omitempty"`
+}
+
+// CheckRequest asks whether Subject has Relation to Object, e.g. "user:10", "viewer", "doc:readme".
+type CheckRequest struct {
+	Object           string `json:"object"`
+	Relation         string `json:"relation"`
+	Subject          string `json:"subject"`
+	ConsistencyToken string `json:"consistency_token,omitempty"`
+}
+
+// CheckResult is the answer to a CheckRequest and the snapshot it was evaluated at.
+type CheckResult struct {
+	Allowed   bool   `json:"allowed"`
+	CheckedAt string `json:"checked_at"`
+}
+
+// Tree is the userset tree returned by Expand.
+type Tree struct {
+	Operation string   `json:"operation"`
+	Userset   string   `json:"userset,omitempty"`
+	Subjects  []string `json:"subjects,omitempty"`
+	Children  []*Tree  `json:"children,omitempty"`
+}
+
+// TupleFilter filters the relation tuples listed. Empty fields don't filter.
+type TupleFilter struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+	Subject   string
+	Page
+}
+
+/*
+Namespace is the configuration of a namespace of relation tuples. The rewrite rules of each
+relation are kept as JSON, in the format described in the service's README.
+*/
+type Namespace struct {
+	Name      string                     `json:"name"`
+	Relations map[string]json.RawMessage `json:"relations"`
+}
+
+// Policy is an attribute-based access policy.
+type Policy struct {
+	ID          int64     `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Effect      string    `json:"effect"`
+	Actions     []string  `json:"actions"`
+	Resources   []string  `json:"resources"`
+	Condition   string    `json:"condition"`
+	Mode        string    `json:"mode"`
+	Source      string    `json:"source,omitempty"`
+	CreatedAt   time.Time `json:"CreatedAt,omitempty"`
+	UpdatedAt   time.Time `json:"UpdatedAt,omitempty"`
+}
+
+// PolicyUpdate holds the policy fields to change. Nil fields are left as they are.
+type PolicyUpdate struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Effect      *string  `json:"effect,omitempty"`
+	Actions     []string `json:"actions,omitempty"`
+	Resources   []string `json:"resources,omitempty"`
+	Condition   *string  `json:"condition,omitempty"`
+	Mode        *string  `json:"mode,omitempty"`
+}
+
+// EvaluateRequest asks whether a subject, the caller when SubjectID is zero, may perform an action on a resource.
+type EvaluateRequest struct {
+	Action    string `json:"action"`
+	SubjectID int64  `json:"subject_id,omitempty"`
+	Resource  struct {
+		Type       string                 `json:"type"`
+		ID         string                 `json:"id,omitempty"`
+		Attributes map[string]interface{} `json:"attributes,omitempty"`
+	} `json:"resource"`
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// Decision is the outcome of evaluating policies.
+type Decision struct {
+	Allowed  bool      `json:"allowed"`
+	Reason   string    `json:"reason"`
+	Policies []string  `json:"policies"`
+	Errors   []string  `json:"errors,omitempty"`
+	DryRun   *Decision `json:"dry_run,omitempty"`
+}
@@ -0,0 +1,286 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Authenticate logs in with an email and password.
+func (c *Client) Authenticate(ctx context.Context, email, password string) (*AuthenticationToken, error) {
+	var res struct {
+		AuthenticationToken struct {
+			Token  string    `json:"token"`
+			Expiry time.Time `json:"expiry"`
+		} `json:"authentication_token"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+		Groups      []string `json:"groups"`
+	}
+
+	err := c.call(ctx, http.MethodPost, "/v1/token/authenticate", nil, map[string]string{"email": email, "password": password}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthenticationToken{
+		Token:       res.AuthenticationToken.Token,
+		Expiry:      res.AuthenticationToken.Expiry,
+		Roles:       res.Roles,
+		Permissions: res.Permissions,
+		Groups:      res.Groups,
+	}, nil
+}
+
+// Introspect returns the user an authentication token belongs to, with their roles, permissions
+// and groups, and when the token expires.
+func (c *Client) Introspect(ctx context.Context, token string) (*User, time.Time, error) {
+	var user User
+	var metadata struct {
+		TokenExpiry time.Time `json:"token_expiry"`
+	}
+
+	err := c.callData(ctx, http.MethodPost, "/api/v1/user", nil, map[string]string{"token": token}, &user, &metadata)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return &user, metadata.TokenExpiry, nil
+}
+
+// Register creates an account and emails its activation token.
+func (c *Client) Register(ctx context.Context, registration Registration) error {
+	return c.callData(ctx, http.MethodPost, "/v1/users", nil, registration, nil, nil)
+}
+
+// Activate activates the account of an activation token.
+func (c *Client) Activate(ctx context.Context, token string) (*User, error) {
+	var user User
+	err := c.callData(ctx, http.MethodPost, "/v1/users/activated", nil, map[string]string{"token": token}, &user, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ResetPassword sets a new password with a password reset token.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	return c.callData(ctx, http.MethodPut, "/v1/users/password", nil, map[string]string{"token": token, "password": password}, nil, nil)
+}
+
+// ChangePassword changes the password of the client's user, signing out their other sessions.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, password string) error {
+	return c.callData(ctx, http.MethodPut, "/v1/users/me/password", nil, map[string]string{"current_password": currentPassword, "password": password}, nil, nil)
+}
+
+// ChangeExpiredPassword changes an expired password with the PasswordChangeToken of the refused login.
+func (c *Client) ChangeExpiredPassword(ctx context.Context, token, password string) error {
+	return c.callData(ctx, http.MethodPut, "/v1/users/password/expired", nil, map[string]string{"token": token, "password": password}, nil, nil)
+}
+
+// ListUsers lists the users matching filters.
+func (c *Client) ListUsers(ctx context.Context, filters UserFilters) ([]*User, *Metadata, error) {
+	var users []*User
+	var metadata Metadata
+	err := c.callData(ctx, http.MethodGet, "/v1/users", filters.values(), nil, &users, &metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	return users, &metadata, nil
+}
+
+// SearchUsers returns up to limit users best matching term.
+func (c *Client) SearchUsers(ctx context.Context, term string, limit int) ([]*SearchResult, error) {
+	qs := url.Values{"q": {term}}
+	if limit > 0 {
+		qs.Set("limit", strconv.Itoa(limit))
+	}
+
+	var results []*SearchResult
+	err := c.callData(ctx, http.MethodGet, "/v1/admin/users/search", qs, nil, &results, nil)
+	return results, err
+}
+
+// GetUser returns a user.
+func (c *Client) GetUser(ctx context.Context, id int64) (*User, error) {
+	var user User
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/users/%d", id), nil, nil, &user, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser changes the given fields of a user.
+func (c *Client) UpdateUser(ctx context.Context, id int64, update UserUpdate) (*User, error) {
+	var user User
+	err := c.callData(ctx, http.MethodPatch, pathf("/v1/admin/users/%d", id), nil, update, &user, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser deletes a user.
+func (c *Client) DeleteUser(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/users/%d", id), nil, nil, nil, nil)
+}
+
+// ActivateUser activates a user without an activation token.
+func (c *Client) ActivateUser(ctx context.Context, id int64) (*User, error) {
+	var user User
+	err := c.callData(ctx, http.MethodPut, pathf("/v1/admin/users/%d/activate", id), nil, nil, &user, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeactivateUser deactivates a user.
+func (c *Client) DeactivateUser(ctx context.Context, id int64) (*User, error) {
+	var user User
+	err := c.callData(ctx, http.MethodPut, pathf("/v1/admin/users/%d/deactivate", id), nil, nil, &user, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SendPasswordReset emails a user a password reset token.
+func (c *Client) SendPasswordReset(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodPost, pathf("/v1/admin/users/%d/password-reset", id), nil, nil, nil, nil)
+}
+
+// RevokeUserTokens logs a user out everywhere.
+func (c *Client) RevokeUserTokens(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/users/%d/tokens", id), nil, nil, nil, nil)
+}
+
+// ListMySessions returns the sessions of the client's user.
+func (c *Client) ListMySessions(ctx context.Context) ([]*Session, error) {
+	var sessions []*Session
+	err := c.callData(ctx, http.MethodGet, "/v1/users/me/sessions", nil, nil, &sessions, nil)
+	return sessions, err
+}
+
+// RevokeMySession logs the client's user out of one session.
+func (c *Client) RevokeMySession(ctx context.Context, sessionID int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/users/me/sessions/%d", sessionID), nil, nil, nil, nil)
+}
+
+// ListUserSessions returns the sessions of a user.
+func (c *Client) ListUserSessions(ctx context.Context, id int64) ([]*Session, error) {
+	var sessions []*Session
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/users/%d/sessions", id), nil, nil, &sessions, nil)
+	return sessions, err
+}
+
+// RevokeUserSession logs a user out of one session.
+func (c *Client) RevokeUserSession(ctx context.Context, id, sessionID int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/users/%d/sessions/%d", id, sessionID), nil, nil, nil, nil)
+}
+
+// Unlock unlocks an account with the token emailed when it was locked.
+func (c *Client) Unlock(ctx context.Context, token string) error {
+	return c.callData(ctx, http.MethodPost, "/v1/users/unlocked", nil, map[string]string{"token": token}, nil, nil)
+}
+
+// UnlockUser unlocks a user locked out by failed logins.
+func (c *Client) UnlockUser(ctx context.Context, id int64) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/users/%d/lockout", id), nil, nil, nil, nil)
+}
+
+// ListUserAudit returns the audit trail of admin actions on a user.
+func (c *Client) ListUserAudit(ctx context.Context, id int64) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/users/%d/audit", id), nil, nil, &entries, nil)
+	return entries, err
+}
+
+// GetUserAccess returns the roles, permissions and groups of a user.
+func (c *Client) GetUserAccess(ctx context.Context, id int64) (*Access, error) {
+	var access Access
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/users/%d/roles", id), nil, nil, &access, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &access, nil
+}
+
+// AssignUserRole gives a user a role.
+func (c *Client) AssignUserRole(ctx context.Context, id int64, role string) error {
+	return c.callData(ctx, http.MethodPost, pathf("/v1/admin/users/%d/roles", id), nil, map[string]string{"role": role}, nil, nil)
+}
+
+// RemoveUserRole takes a role from a user.
+func (c *Client) RemoveUserRole(ctx context.Context, id int64, role string) error {
+	return c.callData(ctx, http.MethodDelete, pathf("/v1/admin/users/%d/roles/%s", id, role), nil, nil, nil, nil)
+}
+
+// GetUserAttributes returns the attributes policies see for a user.
+func (c *Client) GetUserAttributes(ctx context.Context, id int64) (map[string]interface{}, error) {
+	var attributes map[string]interface{}
+	err := c.callData(ctx, http.MethodGet, pathf("/v1/admin/users/%d/attributes", id), nil, nil, &attributes, nil)
+	return attributes, err
+}
+
+// SetUserAttributes replaces the attributes of a user.
+func (c *Client) SetUserAttributes(ctx context.Context, id int64, attributes map[string]interface{}) error {
+	return c.callData(ctx, http.MethodPut, pathf("/v1/admin/users/%d/attributes", id), nil, attributes, nil, nil)
+}
+
+// ImportUsers creates users from a csv or ndjson file, emailing them invitations when invite is set.
+func (c *Client) ImportUsers(ctx context.Context, src io.Reader, format string, invite bool) (*ImportResult, error) {
+	contentType := "text/csv"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+
+	qs := url.Values{"format": {format}, "invite": {strconv.FormatBool(invite)}}
+
+	res, err := c.send(ctx, http.MethodPost, "/v1/admin/users/import", qs, src, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Data ImportResult `json:"data"`
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// ExportUsers streams the users matching filters as csv or ndjson. The caller must close the reader.
+func (c *Client) ExportUsers(ctx context.Context, filters UserFilters, format string) (io.ReadCloser, error) {
+	qs := filters.values()
+	qs.Set("format", format)
+
+	res, err := c.send(ctx, http.MethodGet, "/v1/admin/users/export", qs, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// StartUserExport starts writing the users matching filters to a file on the server and returns its path.
+func (c *Client) StartUserExport(ctx context.Context, filters UserFilters, format string) (string, error) {
+	qs := filters.values()
+	qs.Set("format", format)
+
+	var data struct {
+		File string `json:"file"`
+	}
+
+	err := c.callData(ctx, http.MethodPost, "/v1/admin/users/export", qs, nil, &data, nil)
+	return data.File, err
+}